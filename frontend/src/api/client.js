@@ -75,6 +75,12 @@ export const api = {
   getDiskUsage: () =>
     request('/api/admin/disk'),
 
+  getCleanupStatus: () =>
+    request('/api/admin/cleanup'),
+
+  runCleanup: (dryRun) =>
+    request('/api/admin/cleanup/run' + (dryRun ? '?dry_run=true' : ''), { method: 'POST' }),
+
   restart: () =>
     request('/api/admin/restart', { method: 'POST' }),
 
@@ -0,0 +1,359 @@
+// Package anomaly learns the normal hourly message volume of every host and
+// syslog tag and flags hours whose volume deviates strongly from it.
+//
+// Each (dimension, key) pair keeps an exponentially weighted moving average
+// (EWMA) of its hourly count together with an EWMA of the variance. When an
+// hour is finished its observed count is compared against the baseline:
+//
+//	score = (observed - expected) / max(stddev, sqrt(expected), 1)
+//
+// The sqrt(expected) floor is the Poisson noise of the expected count; it
+// keeps very stable, low-volume sources from being flagged for a handful of
+// extra messages. Hours with |score| >= Threshold are recorded as anomalies.
+package anomaly
+
+import (
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Dimension names the attribute a baseline is tracked for.
+type Dimension string
+
+const (
+	DimensionHost Dimension = "host" // FromHost
+	DimensionTag  Dimension = "tag"  // ProgramName (SysLogTag without PID)
+)
+
+// dimensionColumns maps each dimension to the SystemEvents column it groups by.
+var dimensionColumns = map[Dimension]string{
+	DimensionHost: "FromHost",
+	DimensionTag:  "ProgramName",
+}
+
+// retention is how long detected anomalies are kept for the API.
+const retention = 48 * time.Hour
+
+// Config holds the detector settings.
+type Config struct {
+	// Enabled enables or disables the detector.
+	Enabled bool
+
+	// Interval is how often the detector checks for newly finished hours.
+	Interval time.Duration
+
+	// Alpha is the EWMA smoothing factor (0-1). Higher values adapt faster.
+	Alpha float64
+
+	// Threshold is the absolute score at which an hour is flagged.
+	Threshold float64
+
+	// MinSamples is the number of hours a baseline must have seen before it
+	// is allowed to flag anomalies.
+	MinSamples int
+
+	// LearnHours is the number of past hours replayed at startup so the
+	// baselines are warm without waiting days for live data.
+	LearnHours int
+}
+
+// Anomaly is a single flagged hour for one host or tag.
+type Anomaly struct {
+	Dimension Dimension `json:"dimension"`
+	Key       string    `json:"key"`
+	Hour      time.Time `json:"hour"` // start of the evaluated hour
+	Observed  int       `json:"observed"`
+	Expected  float64   `json:"expected"`
+	StdDev    float64   `json:"stddev"`
+	Score     float64   `json:"score"`
+	Kind      string    `json:"kind"` // "spike" or "drop"
+}
+
+// baseline is the learned hourly volume of one key.
+type baseline struct {
+	mean     float64
+	variance float64
+	samples  int
+}
+
+type baselineKey struct {
+	dim Dimension
+	key string
+}
+
+// Counter returns per-key message counts for a time range.
+// Both *database.DB and *database.Sources implement it.
+type Counter interface {
+	CountsByColumn(column string, start, end time.Time) (map[string]int, error)
+}
+
+// Detector evaluates hourly message volumes in the background.
+type Detector struct {
+	db     Counter
+	cfg    Config
+	stopCh chan struct{}
+
+	mu        sync.RWMutex
+	baselines map[baselineKey]*baseline
+	anomalies []Anomaly
+	lastHour  time.Time // start of the most recently evaluated hour
+	ready     bool      // startup replay finished
+}
+
+// New creates a new Detector.
+func New(db Counter, cfg Config) *Detector {
+	return &Detector{
+		db:        db,
+		cfg:       cfg,
+		stopCh:    make(chan struct{}),
+		baselines: make(map[baselineKey]*baseline),
+	}
+}
+
+// Enabled reports whether the detector is running.
+func (d *Detector) Enabled() bool {
+	return d != nil && d.cfg.Enabled
+}
+
+// Start launches the detector loop in a background goroutine.
+func (d *Detector) Start() {
+	if !d.cfg.Enabled {
+		log.Println("⏭  Anomaly detection disabled")
+		return
+	}
+
+	log.Printf("✓ Anomaly detection started (alpha: %.2f, threshold: %.1f, learn: %dh)",
+		d.cfg.Alpha, d.cfg.Threshold, d.cfg.LearnHours)
+
+	go d.run()
+}
+
+// Stop signals the detector loop to stop.
+func (d *Detector) Stop() {
+	close(d.stopCh)
+}
+
+// run replays the learning window and then evaluates new hours as they finish.
+func (d *Detector) run() {
+	d.learn()
+
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.catchUp()
+		case <-d.stopCh:
+			log.Println("Anomaly detection stopped")
+			return
+		}
+	}
+}
+
+// learn replays the last LearnHours hours to build the initial baselines.
+func (d *Detector) learn() {
+	current := time.Now().Truncate(time.Hour)
+	d.mu.Lock()
+	d.lastHour = current.Add(-time.Duration(d.cfg.LearnHours+1) * time.Hour)
+	d.mu.Unlock()
+
+	d.catchUp()
+
+	d.mu.Lock()
+	d.ready = true
+	n := len(d.baselines)
+	d.mu.Unlock()
+	log.Printf("✓ Anomaly detection: learned %d baselines from the last %d hours", n, d.cfg.LearnHours)
+}
+
+// catchUp evaluates every finished hour after lastHour.
+func (d *Detector) catchUp() {
+	current := time.Now().Truncate(time.Hour)
+	for {
+		d.mu.RLock()
+		next := d.lastHour.Add(time.Hour)
+		d.mu.RUnlock()
+
+		if !next.Before(current) {
+			return
+		}
+		select {
+		case <-d.stopCh:
+			return
+		default:
+		}
+
+		if err := d.evaluateHour(next); err != nil {
+			log.Printf("⚠️  Anomaly detection: failed to evaluate %s: %v", next.Format(time.RFC3339), err)
+			return // retry on the next tick
+		}
+	}
+}
+
+// evaluateHour scores and learns the counts of the hour starting at hour.
+func (d *Detector) evaluateHour(hour time.Time) error {
+	counts := make(map[Dimension]map[string]int, len(dimensionColumns))
+	for dim, column := range dimensionColumns {
+		c, err := d.db.CountsByColumn(column, hour, hour.Add(time.Hour))
+		if err != nil {
+			return err
+		}
+		counts[dim] = c
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for dim, observed := range counts {
+		// Keys that sent nothing this hour still need to be scored — a
+		// host going silent is exactly the kind of drop we want to see.
+		for k := range d.baselines {
+			if k.dim == dim {
+				if _, ok := observed[k.key]; !ok {
+					observed[k.key] = 0
+				}
+			}
+		}
+
+		for key, n := range observed {
+			bk := baselineKey{dim: dim, key: key}
+			b := d.baselines[bk]
+			if b == nil {
+				b = &baseline{}
+				d.baselines[bk] = b
+			}
+			if a, ok := d.score(b, float64(n)); ok {
+				a.Dimension = dim
+				a.Key = key
+				a.Hour = hour
+				d.anomalies = append(d.anomalies, a)
+			}
+			d.update(b, float64(n))
+
+			// Forget sources that have been silent long enough for their
+			// baseline to decay to nothing.
+			if n == 0 && b.mean < 0.01 {
+				delete(d.baselines, bk)
+			}
+		}
+	}
+
+	d.lastHour = hour
+	d.pruneLocked(hour)
+	return nil
+}
+
+// score compares x against b. Returns ok=false when the baseline is too
+// young or the deviation is below the threshold.
+func (d *Detector) score(b *baseline, x float64) (Anomaly, bool) {
+	if b.samples < d.cfg.MinSamples {
+		return Anomaly{}, false
+	}
+	stddev := math.Sqrt(b.variance)
+	scale := math.Max(stddev, math.Max(math.Sqrt(b.mean), 1))
+	s := (x - b.mean) / scale
+	if math.Abs(s) < d.cfg.Threshold {
+		return Anomaly{}, false
+	}
+	kind := "spike"
+	if s < 0 {
+		kind = "drop"
+	}
+	return Anomaly{
+		Observed: int(x),
+		Expected: round2(b.mean),
+		StdDev:   round2(stddev),
+		Score:    round2(s),
+		Kind:     kind,
+	}, true
+}
+
+// update folds x into the baseline (incremental EWMA mean and variance).
+func (d *Detector) update(b *baseline, x float64) {
+	if b.samples == 0 {
+		b.mean = x
+		b.samples = 1
+		return
+	}
+	diff := x - b.mean
+	incr := d.cfg.Alpha * diff
+	b.mean += incr
+	b.variance = (1 - d.cfg.Alpha) * (b.variance + diff*incr)
+	b.samples++
+}
+
+// pruneLocked drops anomalies older than the retention window. d.mu must be held.
+func (d *Detector) pruneLocked(now time.Time) {
+	cutoff := now.Add(-retention)
+	kept := d.anomalies[:0]
+	for _, a := range d.anomalies {
+		if !a.Hour.Before(cutoff) {
+			kept = append(kept, a)
+		}
+	}
+	d.anomalies = kept
+}
+
+// Status is a snapshot of the detector state.
+type Status struct {
+	Enabled   bool       `json:"enabled"`
+	Ready     bool       `json:"ready"`
+	Baselines int        `json:"baselines"`
+	LastHour  *time.Time `json:"last_evaluated_hour"`
+	Anomalies []Anomaly  `json:"anomalies"`
+}
+
+// Snapshot returns the current anomalies, newest and strongest first.
+// dim filters by dimension when non-empty; minScore filters by |score|.
+func (d *Detector) Snapshot(dim Dimension, minScore float64) Status {
+	if !d.Enabled() {
+		return Status{Anomalies: []Anomaly{}}
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	list := make([]Anomaly, 0, len(d.anomalies))
+	for _, a := range d.anomalies {
+		if dim != "" && a.Dimension != dim {
+			continue
+		}
+		if math.Abs(a.Score) < minScore {
+			continue
+		}
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Hour.Equal(list[j].Hour) {
+			return list[i].Hour.After(list[j].Hour)
+		}
+		return math.Abs(list[i].Score) > math.Abs(list[j].Score)
+	})
+
+	var last *time.Time
+	if d.ready {
+		t := d.lastHour
+		last = &t
+	}
+	return Status{
+		Enabled:   true,
+		Ready:     d.ready,
+		Baselines: len(d.baselines),
+		LastHour:  last,
+		Anomalies: list,
+	}
+}
+
+// IsValidDimension reports whether dim names a tracked dimension.
+func IsValidDimension(dim Dimension) bool {
+	_, ok := dimensionColumns[dim]
+	return ok
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
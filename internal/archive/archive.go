@@ -0,0 +1,332 @@
+// Package archive writes rows to compressed files before cleanup deletes
+// them, and loads them back on request.
+//
+// Every archive holds the rows of one cleanup batch received on one day
+// (UTC) as gzip-compressed NDJSON, one models.LogEntry per line. Archives
+// are stored by date with a JSON manifest next to each file:
+//
+//	<dir>/2026/02/18/2026-02-18_1001-1500.ndjson.gz
+//	<dir>/2026/02/18/2026-02-18_1001-1500.manifest.json
+//
+// The manifest is written last, so an archive without one is incomplete and
+// ignored; its rows were not deleted.
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/database"
+	"github.com/phil-bot/rsyslox/internal/models"
+)
+
+// ErrNotFound is returned for an unknown archive name.
+var ErrNotFound = errors.New("archive not found")
+
+// namePattern matches archive names: day, ID range and an optional suffix
+// for archives whose name was already taken.
+var namePattern = regexp.MustCompile(`^(\d{4})-(\d{2})-(\d{2})_\d+-\d+(\.\d+)?$`)
+
+// Manifest describes one archive file.
+type Manifest struct {
+	Name      string    `json:"name"`
+	File      string    `json:"file"` // relative to the archive directory
+	Rows      int       `json:"rows"`
+	FirstID   int       `json:"first_id"`
+	LastID    int       `json:"last_id"`
+	From      time.Time `json:"from"` // oldest ReceivedAt
+	To        time.Time `json:"to"`   // newest ReceivedAt
+	Bytes     int64     `json:"bytes"`
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RestoreResult reports a restore.
+type RestoreResult struct {
+	Name     string `json:"name"`
+	Rows     int    `json:"rows"`     // rows in the archive
+	Restored int    `json:"restored"` // rows written to SystemEvents
+	Skipped  int    `json:"skipped"`  // rows whose ID already existed
+}
+
+// Store manages the archives in one directory.
+type Store struct {
+	db  *database.DB
+	dir string
+}
+
+// Open returns the Store for dir, creating the directory if needed.
+func Open(db *database.DB, dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &Store{db: db, dir: dir}, nil
+}
+
+// ArchiveOldest archives the n oldest rows matching the WHERE clause and
+// returns their IDs. Only these rows may be deleted: on error the IDs of the
+// archives completed before the error are returned.
+func (s *Store) ArchiveOldest(whereClause string, args []interface{}, n int) ([]int, error) {
+	entries, err := s.db.OldestEntries(whereClause, args, n)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for _, day := range splitByDay(entries) {
+		if _, err := s.write(day); err != nil {
+			return ids, err
+		}
+		for _, e := range day {
+			ids = append(ids, e.ID)
+		}
+	}
+	return ids, nil
+}
+
+// splitByDay groups entries sorted by ReceivedAt by their UTC day.
+func splitByDay(entries []models.LogEntry) [][]models.LogEntry {
+	var groups [][]models.LogEntry
+	start := 0
+	for i := 1; i <= len(entries); i++ {
+		if i == len(entries) || dayOf(entries[i].ReceivedAt) != dayOf(entries[start].ReceivedAt) {
+			groups = append(groups, entries[start:i])
+			start = i
+		}
+	}
+	return groups
+}
+
+func dayOf(t time.Time) string { return t.UTC().Format("2006-01-02") }
+
+// write stores entries of one day as a new archive.
+func (s *Store) write(entries []models.LogEntry) (Manifest, error) {
+	m := Manifest{
+		Rows:      len(entries),
+		FirstID:   entries[0].ID,
+		LastID:    entries[0].ID,
+		From:      entries[0].ReceivedAt,
+		To:        entries[len(entries)-1].ReceivedAt,
+		CreatedAt: time.Now(),
+	}
+	for _, e := range entries {
+		m.FirstID = min(m.FirstID, e.ID)
+		m.LastID = max(m.LastID, e.ID)
+	}
+
+	day := m.From.UTC()
+	rel := filepath.Join(day.Format("2006"), day.Format("01"), day.Format("02"))
+	if err := os.MkdirAll(filepath.Join(s.dir, rel), 0o750); err != nil {
+		return m, err
+	}
+	base := fmt.Sprintf("%s_%d-%d", day.Format("2006-01-02"), m.FirstID, m.LastID)
+	m.Name = base
+	for i := 1; fileExists(filepath.Join(s.dir, rel, m.Name+".ndjson.gz")); i++ {
+		m.Name = base + "." + strconv.Itoa(i)
+	}
+	m.File = filepath.Join(rel, m.Name+".ndjson.gz")
+
+	size, sum, err := writeEntries(filepath.Join(s.dir, m.File), entries)
+	if err != nil {
+		return m, fmt.Errorf("failed to write archive %s: %w", m.Name, err)
+	}
+	m.Bytes, m.SHA256 = size, sum
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return m, err
+	}
+	if err := writeFileSync(s.manifestPath(m.Name), append(data, '\n')); err != nil {
+		return m, fmt.Errorf("failed to write manifest of %s: %w", m.Name, err)
+	}
+	return m, nil
+}
+
+// writeEntries writes entries as gzip-compressed NDJSON and syncs the file.
+// Returns the file size and its SHA-256.
+func writeEntries(path string, entries []models.LogEntry) (int64, string, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(f, hash)}
+	zw := gzip.NewWriter(counter)
+	enc := json.NewEncoder(zw)
+	for _, e := range entries {
+		// Only the stored columns matter; derived fields are recomputed.
+		e.Fields, e.Source = nil, ""
+		if err := enc.Encode(e); err != nil {
+			return 0, "", err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return 0, "", err
+	}
+	if err := f.Sync(); err != nil {
+		return 0, "", err
+	}
+	return counter.n, hex.EncodeToString(hash.Sum(nil)), f.Close()
+}
+
+// List returns the manifests of all complete archives, oldest first.
+func (s *Store) List() ([]Manifest, error) {
+	out := []Manifest{}
+	err := filepath.WalkDir(s.dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		m, err := readManifest(path)
+		if err != nil {
+			return nil // not a manifest
+		}
+		out = append(out, m)
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].From.Equal(out[j].From) {
+			return out[i].From.Before(out[j].From)
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out, err
+}
+
+// Get returns the manifest of the named archive.
+func (s *Store) Get(name string) (Manifest, error) {
+	if !namePattern.MatchString(name) {
+		return Manifest{}, ErrNotFound
+	}
+	m, err := readManifest(s.manifestPath(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return Manifest{}, ErrNotFound
+	}
+	return m, err
+}
+
+// Restore loads the named archive back into SystemEvents. The file is
+// checked against the manifest first; rows that exist already are skipped.
+func (s *Store) Restore(name string) (RestoreResult, error) {
+	m, err := s.Get(name)
+	if err != nil {
+		return RestoreResult{}, err
+	}
+	entries, err := s.read(m)
+	if err != nil {
+		return RestoreResult{}, err
+	}
+	restored, err := s.db.RestoreEntries(entries)
+	if err != nil {
+		return RestoreResult{}, err
+	}
+	return RestoreResult{
+		Name:     m.Name,
+		Rows:     len(entries),
+		Restored: restored,
+		Skipped:  len(entries) - restored,
+	}, nil
+}
+
+// read verifies and decodes an archive file.
+func (s *Store) read(m Manifest) ([]models.LogEntry, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, m.File))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive %s: %w", m.Name, err)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != m.SHA256 {
+		return nil, fmt.Errorf("archive %s does not match its manifest checksum", m.Name)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("archive %s: %w", m.Name, err)
+	}
+	defer zr.Close()
+
+	entries := make([]models.LogEntry, 0, m.Rows)
+	dec := json.NewDecoder(bufio.NewReader(zr))
+	for {
+		var e models.LogEntry
+		if err := dec.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("archive %s, row %d: %w", m.Name, len(entries)+1, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// manifestPath returns the manifest path of a valid archive name.
+func (s *Store) manifestPath(name string) string {
+	p := namePattern.FindStringSubmatch(name)
+	return filepath.Join(s.dir, p[1], p[2], p[3], name+".manifest.json")
+}
+
+func readManifest(path string) (Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Manifest{}, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return Manifest{}, err
+	}
+	if !namePattern.MatchString(m.Name) {
+		return Manifest{}, fmt.Errorf("%s: invalid archive name %q", path, m.Name)
+	}
+	return m, nil
+}
+
+// writeFileSync writes data to path and syncs it.
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -76,6 +76,24 @@ func (m *Manager) VerifyReadOnlyKey(key string) string {
 	return ""
 }
 
+// GenerateWriteKey generates a new random write key and its SHA-256 hash.
+// Write keys have the same format as read-only keys.
+func GenerateWriteKey() (plaintext, hash string, err error) {
+	return GenerateReadOnlyKey()
+}
+
+// VerifyWriteKey checks whether the given API key matches a stored write key.
+// Returns the matching key, or false if none matches.
+func (m *Manager) VerifyWriteKey(key string) (config.WriteKey, bool) {
+	h := hashKey(key)
+	for _, k := range m.cfg.Auth.WriteKeys {
+		if k.KeyHash == h {
+			return k, true
+		}
+	}
+	return config.WriteKey{}, false
+}
+
 // hashKey returns the hex-encoded SHA-256 hash of a key.
 func hashKey(key string) string {
 	h := sha256.Sum256([]byte(key))
@@ -0,0 +1,87 @@
+package cleanup
+
+import (
+	"log"
+	"time"
+)
+
+// Bounds of the adaptive batch size.
+const (
+	minBatch       = 10
+	maxBatchFactor = 10 // times BatchSize
+)
+
+// lowWater returns the usage in percent below which disk cleanup stops:
+// LowWaterPercent, or 5 points below the threshold (100% of MaxTableBytes
+// in table_size mode).
+func (c *Cleaner) lowWater() float64 {
+	if c.cfg.LowWaterPercent > 0 {
+		return c.cfg.LowWaterPercent
+	}
+	high := c.cfg.ThresholdPercent
+	if c.tableSizeMode() {
+		high = 100
+	}
+	return max(high-5, 0)
+}
+
+// batchSize returns the current adaptive batch size.
+func (c *Cleaner) batchSize() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.batch == 0 {
+		return c.cfg.BatchSize
+	}
+	return c.batch
+}
+
+// deleteBatch deletes one batch of the oldest records matching the WHERE
+// clause and adapts the batch size to the time the delete took: halved when
+// it took longer than BatchLatency, doubled when it took less than half.
+// Returns the number of deleted rows and the batch size used.
+func (c *Cleaner) deleteBatch(whereClause string, args []interface{}) (int64, int, error) {
+	size := c.batchSize()
+	start := time.Now()
+	deleted, err := c.deleteOldestRecords(whereClause, args, size)
+	if err != nil || deleted < int64(size) {
+		// Short batches say nothing about the latency of full ones.
+		return deleted, size, err
+	}
+
+	latency := time.Since(start)
+	next := size
+	switch {
+	case latency > c.cfg.BatchLatency:
+		next = max(size/2, minBatch)
+	case latency < c.cfg.BatchLatency/2:
+		next = min(size*2, c.cfg.BatchSize*maxBatchFactor)
+	}
+	if next != size {
+		log.Printf("Cleanup: batch of %d took %s, next batch: %d", size, latency.Round(time.Millisecond), next)
+		c.mu.Lock()
+		c.batch = next
+		c.mu.Unlock()
+	}
+	return deleted, size, nil
+}
+
+// pause sleeps BatchPause between batches so that inserts waiting for the
+// deleted rows' locks get through. Returns false when the service stops.
+func (c *Cleaner) pause() bool {
+	if c.cfg.BatchPause <= 0 {
+		select {
+		case <-c.stopCh:
+			return false
+		default:
+			return true
+		}
+	}
+	timer := time.NewTimer(c.cfg.BatchPause)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-c.stopCh:
+		return false
+	}
+}
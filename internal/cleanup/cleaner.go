@@ -2,16 +2,98 @@ package cleanup
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
+	"sync"
 	"syscall"
 	"time"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/hold"
 )
 
-// Cleaner periodically removes old database entries when disk usage exceeds a threshold.
+// DB runs statements written with "?" placeholders and resolves virtual
+// columns such as Severity and ProgramName to SQL expressions.
+// *database.DB implements it for every supported driver.
+type DB interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	ColumnExpr(column string) string
+
+	// TableSize returns the size of SystemEvents in bytes.
+	TableSize() (int64, error)
+
+	// DataFree returns the space inside SystemEvents freed by deletes, and
+	// ReclaimSpace returns it to the filesystem.
+	DataFree() (int64, error)
+	ReclaimSpace(rebuild bool) error
+
+	// OldestRange counts the rows matching the WHERE clause (only the
+	// limit oldest when limit > 0) and returns their ReceivedAt range.
+	OldestRange(whereClause string, args []interface{}, limit int) (int64, *time.Time, *time.Time, error)
+
+	// OldestIDs returns the IDs of the n oldest rows matching the WHERE
+	// clause.
+	OldestIDs(whereClause string, args []interface{}, n int) ([]int, error)
+}
+
+// Archiver saves rows before they are deleted. ArchiveOldest archives the
+// n oldest rows matching the WHERE clause and returns the IDs it saved;
+// only those are deleted. *archive.Store implements it.
+type Archiver interface {
+	ArchiveOldest(whereClause string, args []interface{}, n int) ([]int, error)
+}
+
+// Holds exempts rows under a legal hold from deletion. Condition returns a
+// WHERE clause matching the held rows, or "" while no hold is active.
+// *hold.Store implements it.
+type Holds interface {
+	Condition(now time.Time) (string, []interface{})
+	Active(now time.Time) []hold.Hold
+}
+
+// Rollups keeps pre-aggregated counts that must not count deleted rows.
+// Forget runs del, which deletes the rows with the given IDs, and removes
+// them from the counts. *rollup.Worker implements it.
+type Rollups interface {
+	Forget(ids []int, del func() (int64, error)) (int64, error)
+}
+
+// deleteChunk is the number of IDs per DELETE statement after archiving.
+const deleteChunk = 500
+
+// stallBatches is the number of consecutive disk-pressure batches that
+// deleted rows without lowering usage after which the cleaner stops deleting.
+const stallBatches = 3
+
+// Cleaner periodically removes database entries that exceed their retention
+// period, and the oldest entries when disk usage exceeds a threshold.
 type Cleaner struct {
-	db           *sql.DB
+	db           DB
 	cfg          Config
 	stopCh       chan struct{}
+
+	runMu    sync.Mutex // serializes scheduled and manual runs
+	pressure pressure   // guarded by runMu
+
+	mu          sync.Mutex // guards the fields below
+	running     bool
+	draining    bool // over the threshold and not yet below the low-water mark
+	batch       int  // adaptive batch size, 0 = BatchSize
+	nextRun     time.Time
+	lastReclaim time.Time
+	history     []Run // newest last
+	held        []HeldRows
+}
+
+// pressure tracks whether disk-pressure deletes lower the usage. InnoDB
+// keeps deleted rows' space in the tablespace (DATA_FREE) and reuses it for
+// new rows, so usage stays flat until the table is rebuilt.
+type pressure struct {
+	deleted  bool    // the previous batch deleted rows for disk pressure
+	percent  float64 // usage before that delete
+	dataFree int64
+	stalls   int  // consecutive deletes without gain
+	stalled  bool // deleting is suspended
 }
 
 // Config holds the cleanup configuration.
@@ -19,6 +101,11 @@ type Config struct {
 	// Enabled enables or disables the cleanup service.
 	Enabled bool
 
+	// Mode selects what is measured: config.CleanupModeDisk (the filesystem
+	// at DiskPath) or config.CleanupModeTableSize (SystemEvents against
+	// MaxTableBytes, for databases on another host).
+	Mode string
+
 	// DiskPath is the filesystem path to monitor for disk usage (e.g. /var/lib/mysql).
 	DiskPath string
 
@@ -26,15 +113,46 @@ type Config struct {
 	// When usage exceeds this value, old records will be deleted.
 	ThresholdPercent float64
 
-	// BatchSize is the number of records to delete per cleanup run.
-	BatchSize int
+	// MaxTableBytes is the size cap of SystemEvents in table_size mode.
+	MaxTableBytes int64
+
+	// BatchSize is the initial number of records per delete statement. The
+	// size adapts to BatchLatency between minBatch and maxBatchFactor times
+	// BatchSize; batches are BatchPause apart.
+	BatchSize    int
+	BatchLatency time.Duration
+	BatchPause   time.Duration
+
+	// LowWaterPercent is the usage below which disk cleanup stops once the
+	// threshold was exceeded; 0 = 5 points below the threshold.
+	LowWaterPercent float64
 
 	// Interval is how often the cleanup check runs.
 	Interval time.Duration
+
+	// Retention rules are applied on every run, whatever the disk usage.
+	Retention []RetentionRule
+
+	// Archiver, when set, receives every batch before it is deleted.
+	Archiver Archiver
+
+	// Holds, when set, exempts rows from every deletion.
+	Holds Holds
+
+	// Rollups, when set, is told about every deleted row. Rows are then
+	// deleted by ID.
+	Rollups Rollups
+
+	// Reclaim is config.ReclaimOptimize or config.ReclaimRebuild to rebuild
+	// the table inside ReclaimWindow once DataFree reaches ReclaimMinFree
+	// bytes; "" never rebuilds.
+	Reclaim        string
+	ReclaimWindow  config.Window
+	ReclaimMinFree int64
 }
 
 // New creates a new Cleaner instance.
-func New(db *sql.DB, cfg Config) *Cleaner {
+func New(db DB, cfg Config) *Cleaner {
 	return &Cleaner{
 		db:     db,
 		cfg:    cfg,
@@ -49,8 +167,15 @@ func (c *Cleaner) Start() {
 		return
 	}
 
-	log.Printf("✓ Cleanup service started (threshold: %.1f%%, interval: %s, batch: %d)",
-		c.cfg.ThresholdPercent, c.cfg.Interval, c.cfg.BatchSize)
+	limit := fmt.Sprintf("threshold: %.1f%%", c.cfg.ThresholdPercent)
+	if c.tableSizeMode() {
+		limit = fmt.Sprintf("max table size: %d bytes", c.cfg.MaxTableBytes)
+	}
+	if c.cfg.Reclaim != "" {
+		limit += fmt.Sprintf(", reclaim: %s %s", c.cfg.Reclaim, c.cfg.ReclaimWindow)
+	}
+	log.Printf("✓ Cleanup service started (%s, low water: %.1f%%, interval: %s, batch: %d, retention rules: %d, archive: %t)",
+		limit, c.lowWater(), c.cfg.Interval, c.cfg.BatchSize, len(c.cfg.Retention), c.cfg.Archiver != nil)
 
 	go c.run()
 }
@@ -64,10 +189,12 @@ func (c *Cleaner) Stop() {
 func (c *Cleaner) run() {
 	ticker := time.NewTicker(c.cfg.Interval)
 	defer ticker.Stop()
+	c.scheduleNext()
 
 	for {
 		select {
 		case <-ticker.C:
+			c.scheduleNext()
 			c.check()
 		case <-c.stopCh:
 			log.Println("Cleanup service stopped")
@@ -76,49 +203,250 @@ func (c *Cleaner) run() {
 	}
 }
 
-// check evaluates the current disk usage and deletes records if necessary.
+func (c *Cleaner) scheduleNext() {
+	c.mu.Lock()
+	c.nextRun = time.Now().Add(c.cfg.Interval)
+	c.mu.Unlock()
+}
+
+// check performs a scheduled run.
 func (c *Cleaner) check() {
-	usedPercent, err := diskUsagePercent(c.cfg.DiskPath)
+	c.execute(TriggerSchedule, false)
+}
+
+// execute performs one run and records it in the history. A dry run
+// only estimates what a real run would delete.
+func (c *Cleaner) execute(trigger string, dryRun bool) Run {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+
+	c.mu.Lock()
+	c.running = true
+	c.mu.Unlock()
+
+	run := Run{StartedAt: time.Now(), Trigger: trigger, DryRun: dryRun}
+	if dryRun {
+		c.estimate(&run)
+	} else {
+		c.clean(&run)
+	}
+	c.countHeld(&run)
+	run.DurationMS = time.Since(run.StartedAt).Milliseconds()
+
+	c.record(run)
+	return run
+}
+
+// clean applies the retention rules, then evaluates the current disk usage
+// and deletes records if necessary.
+func (c *Cleaner) clean(run *Run) {
+	deleted, err := c.applyRetention(time.Now())
+	run.RetentionDeleted = deleted
+	run.Deleted += deleted
 	if err != nil {
-		log.Printf("⚠️  Cleanup: failed to get disk usage for %s: %v", c.cfg.DiskPath, err)
+		run.addError(err)
+	}
+
+	if err := c.measure(run); err != nil {
+		log.Printf("⚠️  Cleanup: %v", err)
+		run.addError(err)
 		return
 	}
 
-	log.Printf("Cleanup: disk usage at %.1f%% (threshold: %.1f%%)", usedPercent, c.cfg.ThresholdPercent)
+	if c.tableSizeMode() {
+		log.Printf("Cleanup: SystemEvents at %d bytes (max: %d, free inside: %d)",
+			run.TableBytes, c.cfg.MaxTableBytes, run.DataFree)
+	} else {
+		log.Printf("Cleanup: disk usage at %.1f%% (threshold: %.1f%%, free inside SystemEvents: %d bytes)",
+			run.DiskPercent, c.cfg.ThresholdPercent, run.DataFree)
+	}
+
+	if c.reclaimDue(run) {
+		c.reclaim(run)
+	}
 
-	if usedPercent < c.cfg.ThresholdPercent {
+	// Hysteresis: start above the threshold, stop below the low-water mark.
+	low := c.lowWater()
+	switch {
+	case run.OverThreshold:
+		c.setDraining(true)
+	case run.DiskPercent < low:
+		c.setDraining(false)
+	}
+	if !c.isDraining() {
+		c.pressure = pressure{}
 		return
 	}
 
-	log.Printf("⚠️  Cleanup: disk usage %.1f%% exceeds threshold %.1f%% — deleting %d old records",
-		usedPercent, c.cfg.ThresholdPercent, c.cfg.BatchSize)
+	if c.tableSizeMode() {
+		log.Printf("⚠️  Cleanup: SystemEvents size %d bytes (%.1f%% of %d) — deleting old records down to %.1f%%",
+			run.TableBytes, run.DiskPercent, c.cfg.MaxTableBytes, low)
+	} else {
+		log.Printf("⚠️  Cleanup: disk usage %.1f%% (threshold %.1f%%) — deleting old records down to %.1f%%",
+			run.DiskPercent, c.cfg.ThresholdPercent, low)
+	}
 
-	deleted, err := c.deleteOldestRecords(c.cfg.BatchSize)
-	if err != nil {
-		log.Printf("❌ Cleanup: failed to delete records: %v", err)
+	if err := c.drain(run, low); err != nil {
+		log.Printf("❌ Cleanup: failed to delete records after %d: %v", run.DiskDeleted, err)
+		run.addError(err)
+		return
+	}
+	log.Printf("✓ Cleanup: deleted %d records in %d batches, usage now %.1f%%",
+		run.DiskDeleted, run.Batches, run.DiskPercent)
+}
+
+// drain deletes the oldest records in adaptive batches until usage falls
+// below low. It also stops when deleting stalls, the table is empty, the
+// service stops or an interval has passed; the next run continues.
+func (c *Cleaner) drain(run *Run, low float64) error {
+	deadline := time.Now().Add(c.cfg.Interval)
+	for {
+		if c.stalled(run) {
+			run.Stalled = true
+			log.Printf("⚠️  Cleanup: deleting does not lower usage, %d bytes are free inside SystemEvents — "+
+				"skipping disk cleanup until the table is rebuilt (see cleanup.reclaim)", run.DataFree)
+			return nil
+		}
+
+		deleted, _, err := c.deleteBatch("1=1", nil)
+		run.Batches++
+		run.DiskDeleted += deleted
+		run.Deleted += deleted
+		c.pressure.deleted = deleted > 0
+		c.pressure.percent = run.DiskPercent
+		c.pressure.dataFree = run.DataFree
+		if err != nil || deleted == 0 {
+			return err
+		}
+
+		if time.Now().After(deadline) || !c.pause() {
+			return nil
+		}
+		if err := c.measure(run); err != nil {
+			return err
+		}
+		if run.DiskPercent < low {
+			c.setDraining(false)
+			return nil
+		}
+	}
+}
+
+func (c *Cleaner) setDraining(v bool) {
+	c.mu.Lock()
+	c.draining = v
+	c.mu.Unlock()
+}
+
+func (c *Cleaner) isDraining() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.draining
+}
+
+// stalled reports whether disk-pressure deletes are suspended. They are after
+// stallBatches consecutive batches deleted rows while usage did not drop and
+// the free space inside the table grew, and resume once usage drops.
+func (c *Cleaner) stalled(run *Run) bool {
+	p := &c.pressure
+	if p.stalled {
+		if run.DiskPercent < p.percent {
+			log.Printf("Cleanup: usage dropped to %.1f%%, resuming disk cleanup", run.DiskPercent)
+			*p = pressure{}
+			return false
+		}
+		return true
+	}
+	if p.deleted && run.DiskPercent >= p.percent && run.DataFree >= p.dataFree {
+		p.stalls++
+	} else {
+		p.stalls = 0
+	}
+	p.stalled = p.stalls >= stallBatches
+	if p.stalled {
+		p.percent = run.DiskPercent
+	}
+	return p.stalled
+}
+
+// reclaimDue reports whether the table should be rebuilt now: inside the
+// window, once per window, with enough free space inside the table or while
+// disk cleanup is stalled (PostgreSQL reports no free space).
+func (c *Cleaner) reclaimDue(run *Run) bool {
+	if c.cfg.Reclaim == "" {
+		return false
+	}
+	enough := run.DataFree > 0 && run.DataFree >= c.cfg.ReclaimMinFree
+	if !enough && !c.pressure.stalled {
+		return false
+	}
+	now := time.Now()
+	if !c.cfg.ReclaimWindow.Contains(now) {
+		return false
+	}
+	c.mu.Lock()
+	last := c.lastReclaim
+	c.mu.Unlock()
+	return now.Sub(last) >= c.cfg.ReclaimWindow.Length()
+}
+
+// reclaim rebuilds SystemEvents and measures again.
+func (c *Cleaner) reclaim(run *Run) {
+	log.Printf("Cleanup: reclaiming %d free bytes inside SystemEvents (%s)", run.DataFree, c.cfg.Reclaim)
+	start := time.Now()
+	c.mu.Lock()
+	c.lastReclaim = start
+	c.mu.Unlock()
+
+	if err := c.db.ReclaimSpace(c.cfg.Reclaim == config.ReclaimRebuild); err != nil {
+		log.Printf("❌ Cleanup: %v", err)
+		run.addError(err)
 		return
 	}
+	run.Reclaimed = run.DataFree
+	log.Printf("✓ Cleanup: SystemEvents rebuilt in %s", time.Since(start).Round(time.Second))
 
-	log.Printf("✓ Cleanup: deleted %d records", deleted)
+	c.pressure = pressure{}
+	if err := c.measure(run); err != nil {
+		log.Printf("⚠️  Cleanup: %v", err)
+		run.addError(err)
+	}
 }
 
-// deleteOldestRecords removes the oldest N records from SystemEvents.
-// Returns the number of actually deleted rows.
-func (c *Cleaner) deleteOldestRecords(n int) (int64, error) {
+// deleteOldestRecords removes the oldest N records matching the WHERE
+// clause from SystemEvents. Returns the number of actually deleted rows.
+func (c *Cleaner) deleteOldestRecords(whereClause string, args []interface{}, n int) (int64, error) {
+	whereClause, args = c.withoutHeld(whereClause, args)
+	if c.cfg.Archiver != nil {
+		return c.archiveAndDelete(whereClause, args, n)
+	}
+	if c.cfg.Rollups != nil {
+		ids, err := c.db.OldestIDs(whereClause, args, n)
+		if err != nil {
+			return 0, err
+		}
+		return c.deleteIDs(ids)
+	}
+
 	// Use a subquery with a derived table to work around MySQL's limitation
 	// of not being able to reference the target table in a DELETE subquery directly.
-	query := `
+	// PostgreSQL accepts the same statement.
+	query := fmt.Sprintf(`
 		DELETE FROM SystemEvents
 		WHERE ID IN (
 			SELECT id FROM (
 				SELECT ID as id FROM SystemEvents
+				WHERE %s
 				ORDER BY ReceivedAt ASC, ID ASC
 				LIMIT ?
 			) AS oldest
 		)
-	`
+	`, whereClause)
 
-	result, err := c.db.Exec(query, n)
+	queryArgs := make([]interface{}, 0, len(args)+1)
+	queryArgs = append(queryArgs, args...)
+	queryArgs = append(queryArgs, n)
+	result, err := c.db.Exec(query, queryArgs...)
 	if err != nil {
 		return 0, err
 	}
@@ -126,6 +454,90 @@ func (c *Cleaner) deleteOldestRecords(n int) (int64, error) {
 	return result.RowsAffected()
 }
 
+// archiveAndDelete archives the oldest N matching records and deletes the
+// archived ones. Rows that could not be archived stay in the table.
+func (c *Cleaner) archiveAndDelete(whereClause string, args []interface{}, n int) (int64, error) {
+	ids, archiveErr := c.cfg.Archiver.ArchiveOldest(whereClause, args, n)
+
+	deleted, err := c.deleteIDs(ids)
+	if err != nil {
+		return deleted, err
+	}
+	if archiveErr != nil {
+		return deleted, fmt.Errorf("archiving failed (%d archived records deleted): %w", deleted, archiveErr)
+	}
+	return deleted, nil
+}
+
+// deleteIDs deletes the rows with the given IDs in chunks of deleteChunk.
+func (c *Cleaner) deleteIDs(ids []int) (int64, error) {
+	var deleted int64
+	for start := 0; start < len(ids); start += deleteChunk {
+		chunk := ids[start:min(start+deleteChunk, len(ids))]
+		del := func() (int64, error) {
+			args := make([]interface{}, len(chunk))
+			for i, id := range chunk {
+				args[i] = id
+			}
+			result, err := c.db.Exec("DELETE FROM SystemEvents WHERE ID IN ("+
+				placeholders(len(chunk))+")", args...)
+			if err != nil {
+				return 0, err
+			}
+			return result.RowsAffected()
+		}
+		var affected int64
+		var err error
+		if c.cfg.Rollups != nil {
+			affected, err = c.cfg.Rollups.Forget(chunk, del)
+		} else {
+			affected, err = del()
+		}
+		deleted += affected
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+func (c *Cleaner) tableSizeMode() bool {
+	return c.cfg.Mode == config.CleanupModeTableSize
+}
+
+// measure fills the usage of the run: disk usage in percent, or in
+// table_size mode the size of SystemEvents and its percentage of the cap,
+// and the free space inside the table. The free space only serves stall
+// detection and reclaiming; when it cannot be read it is logged and left
+// at 0, so that deleting goes on.
+func (c *Cleaner) measure(run *Run) error {
+	run.DataFree = 0
+	if free, err := c.db.DataFree(); err != nil {
+		log.Printf("⚠️  Cleanup: free space of SystemEvents: %v", err)
+	} else {
+		run.DataFree = free
+	}
+
+	if c.tableSizeMode() {
+		size, err := c.db.TableSize()
+		if err != nil {
+			return fmt.Errorf("size of SystemEvents: %w", err)
+		}
+		run.TableBytes = size
+		run.DiskPercent = float64(size) / float64(c.cfg.MaxTableBytes) * 100
+		run.OverThreshold = size > c.cfg.MaxTableBytes
+		return nil
+	}
+
+	usedPercent, err := diskUsagePercent(c.cfg.DiskPath)
+	if err != nil {
+		return fmt.Errorf("disk usage of %s: %w", c.cfg.DiskPath, err)
+	}
+	run.DiskPercent = usedPercent
+	run.OverThreshold = usedPercent >= c.cfg.ThresholdPercent
+	return nil
+}
+
 // diskUsagePercent returns the used disk space as a percentage for the given path.
 func diskUsagePercent(path string) (float64, error) {
 	var stat syscall.Statfs_t
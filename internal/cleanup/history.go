@@ -0,0 +1,179 @@
+package cleanup
+
+import (
+	"fmt"
+	"time"
+)
+
+// historySize is the number of runs kept in memory.
+const historySize = 50
+
+// Run triggers.
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// Run describes one cleanup run.
+type Run struct {
+	StartedAt        time.Time `json:"started_at"`
+	Trigger          string    `json:"trigger"` // TriggerSchedule or TriggerManual
+	DryRun           bool      `json:"dry_run"`
+	DiskPercent      float64   `json:"disk_percent"` // of max_table_bytes in table_size mode
+	TableBytes       int64     `json:"table_bytes,omitempty"`
+	OverThreshold    bool      `json:"over_threshold"`
+	DataFree         int64     `json:"data_free"`           // free bytes inside SystemEvents
+	Stalled          bool      `json:"stalled,omitempty"`   // disk cleanup suspended, see Cleaner.stalled
+	Reclaimed        int64     `json:"reclaimed,omitempty"` // DataFree before the table was rebuilt
+	RetentionDeleted int64     `json:"retention_deleted"`
+	DiskDeleted      int64     `json:"disk_deleted"`
+	Batches          int       `json:"batches,omitempty"` // disk-pressure delete statements
+	Deleted          int64     `json:"deleted"`
+	DurationMS       int64     `json:"duration_ms"`
+	Error            string    `json:"error,omitempty"`
+
+	// Dry runs only: the rows a real run would delete.
+	Retention *Estimate `json:"retention,omitempty"`
+	Disk      *Estimate `json:"disk,omitempty"`
+}
+
+// Estimate is the number and ReceivedAt range of the rows a run would
+// delete.
+type Estimate struct {
+	Rows   int64      `json:"rows"`
+	Oldest *time.Time `json:"oldest,omitempty"`
+	Newest *time.Time `json:"newest,omitempty"`
+}
+
+// Status is the state of the cleanup service, as returned by the admin API.
+type Status struct {
+	Enabled          bool       `json:"enabled"`
+	Running          bool       `json:"running"`
+	Mode             string     `json:"mode"`
+	IntervalSeconds  int        `json:"interval_seconds"`
+	ThresholdPercent float64    `json:"threshold_percent"`
+	MaxTableBytes    int64      `json:"max_table_bytes,omitempty"`
+	LowWaterPercent  float64    `json:"low_water_percent"`
+	Draining         bool       `json:"draining"` // deleting until usage is below the low-water mark
+	BatchSize        int        `json:"batch_size"`
+	CurrentBatch     int        `json:"current_batch"` // adapted to the delete latency
+	RetentionRules   int        `json:"retention_rules"`
+	Archive          bool       `json:"archive"`
+	Reclaim          string     `json:"reclaim,omitempty"`
+	ReclaimWindow    string     `json:"reclaim_window,omitempty"`
+	Stalled          bool       `json:"stalled"`
+	LastReclaimAt    *time.Time `json:"last_reclaim_at,omitempty"`
+	NextRunAt        *time.Time `json:"next_run_at,omitempty"`
+	Holds            []HeldRows `json:"holds"` // active legal holds, counted on the latest run
+	Runs             []Run      `json:"runs"`  // newest first
+}
+
+func (r *Run) addError(err error) {
+	if r.Error != "" {
+		r.Error += "; "
+	}
+	r.Error += err.Error()
+}
+
+// RunNow performs a run immediately, waiting for a scheduled run in
+// progress. A dry run deletes nothing and reports what would be deleted.
+// Manual runs work even while the scheduled service is disabled.
+func (c *Cleaner) RunNow(dryRun bool) Run {
+	return c.execute(TriggerManual, dryRun)
+}
+
+// record appends run to the history.
+func (c *Cleaner) record(run Run) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running = false
+	c.history = append(c.history, run)
+	if len(c.history) > historySize {
+		c.history = c.history[len(c.history)-historySize:]
+	}
+}
+
+// Status returns the configuration, next scheduled run and recent runs.
+// It is safe to call on a nil Cleaner.
+func (c *Cleaner) Status() Status {
+	if c == nil {
+		return Status{Holds: []HeldRows{}, Runs: []Run{}}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := Status{
+		Enabled:          c.cfg.Enabled,
+		Running:          c.running,
+		Mode:             c.cfg.Mode,
+		IntervalSeconds:  int(c.cfg.Interval.Seconds()),
+		ThresholdPercent: c.cfg.ThresholdPercent,
+		MaxTableBytes:    c.cfg.MaxTableBytes,
+		LowWaterPercent:  c.lowWater(),
+		Draining:         c.draining,
+		BatchSize:        c.cfg.BatchSize,
+		CurrentBatch:     c.cfg.BatchSize,
+		RetentionRules:   len(c.cfg.Retention),
+		Archive:          c.cfg.Archiver != nil,
+		Holds:            append([]HeldRows{}, c.held...),
+		Runs:             make([]Run, 0, len(c.history)),
+	}
+	if c.batch > 0 {
+		s.CurrentBatch = c.batch
+	}
+	if c.cfg.Reclaim != "" {
+		s.Reclaim = c.cfg.Reclaim
+		s.ReclaimWindow = c.cfg.ReclaimWindow.String()
+	}
+	if !c.lastReclaim.IsZero() {
+		t := c.lastReclaim
+		s.LastReclaimAt = &t
+	}
+	if n := len(c.history); n > 0 {
+		s.Stalled = c.history[n-1].Stalled
+	}
+	if c.cfg.Enabled && !c.nextRun.IsZero() {
+		next := c.nextRun
+		s.NextRunAt = &next
+	}
+	for i := len(c.history) - 1; i >= 0; i-- {
+		s.Runs = append(s.Runs, c.history[i])
+	}
+	return s
+}
+
+// estimate fills a dry run: the expired rows of the retention rules, and
+// the first batch that disk pressure would delete after them. Held rows
+// are excluded from both.
+func (c *Cleaner) estimate(run *Run) {
+	diskWhere, diskArgs := c.withoutHeld("1=1", nil)
+	if len(c.cfg.Retention) > 0 {
+		where, args := c.retentionCondition(time.Now())
+		expired, expiredArgs := c.withoutHeld(where, args)
+		rows, oldest, newest, err := c.db.OldestRange(expired, expiredArgs, 0)
+		if err != nil {
+			run.addError(fmt.Errorf("retention estimate: %w", err))
+			return
+		}
+		run.Retention = &Estimate{Rows: rows, Oldest: oldest, Newest: newest}
+		diskWhere, diskArgs = c.withoutHeld("NOT ("+where+")", args)
+	}
+
+	if err := c.measure(run); err != nil {
+		run.addError(err)
+		return
+	}
+	pressure := run.OverThreshold || (c.isDraining() && run.DiskPercent >= c.lowWater())
+	if !pressure || c.pressure.stalled {
+		run.Stalled = pressure
+		run.Disk = &Estimate{}
+		return
+	}
+
+	rows, oldest, newest, err := c.db.OldestRange(diskWhere, diskArgs, c.batchSize())
+	if err != nil {
+		run.addError(fmt.Errorf("disk estimate: %w", err))
+		return
+	}
+	run.Disk = &Estimate{Rows: rows, Oldest: oldest, Newest: newest}
+}
@@ -0,0 +1,53 @@
+package cleanup
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/hold"
+)
+
+// HeldRows is the number of rows under one legal hold, counted on the
+// latest run.
+type HeldRows struct {
+	ID        string     `json:"id"`
+	Reason    string     `json:"reason"`
+	Rows      int64      `json:"rows"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// withoutHeld narrows a WHERE clause to the rows under no active hold.
+func (c *Cleaner) withoutHeld(whereClause string, args []interface{}) (string, []interface{}) {
+	if c.cfg.Holds == nil {
+		return whereClause, args
+	}
+	held, heldArgs := c.cfg.Holds.Condition(time.Now())
+	if held == "" {
+		return whereClause, args
+	}
+	all := make([]interface{}, 0, len(args)+len(heldArgs))
+	all = append(all, args...)
+	all = append(all, heldArgs...)
+	return "(" + whereClause + ") AND NOT (" + held + ")", all
+}
+
+// countHeld counts the rows under each active hold for the status. Each
+// hold costs one COUNT query.
+func (c *Cleaner) countHeld(run *Run) {
+	if c.cfg.Holds == nil {
+		return
+	}
+	var held []HeldRows
+	for _, h := range c.cfg.Holds.Active(time.Now()) {
+		where, args := hold.Match(h)
+		rows, _, _, err := c.db.OldestRange(where, args, 0)
+		if err != nil {
+			run.addError(fmt.Errorf("counting rows of hold %s: %w", h.ID, err))
+			return
+		}
+		held = append(held, HeldRows{ID: h.ID, Reason: h.Reason, Rows: rows, ExpiresAt: h.ExpiresAt})
+	}
+	c.mu.Lock()
+	c.held = held
+	c.mu.Unlock()
+}
@@ -0,0 +1,136 @@
+package cleanup
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/hold"
+)
+
+// RetentionRule deletes matching rows once they are older than MaxAge.
+// Values within a list are ORed, lists are ANDed; a rule without criteria
+// matches every row.
+type RetentionRule struct {
+	Name        string
+	MaxAge      time.Duration
+	Severity    []int
+	Facility    []int
+	FromHost    []string // "*" matches any characters
+	ProgramName []string
+}
+
+// applyRetention deletes the rows whose retention period has expired, in
+// adaptive batches until none are left. Returns the number of deleted rows.
+func (c *Cleaner) applyRetention(now time.Time) (int64, error) {
+	if len(c.cfg.Retention) == 0 {
+		return 0, nil
+	}
+	where, args := c.retentionCondition(now)
+
+	var total int64
+	for {
+		deleted, size, err := c.deleteBatch(where, args)
+		total += deleted
+		if err != nil {
+			log.Printf("❌ Cleanup: retention failed after %d records: %v", total, err)
+			return total, fmt.Errorf("retention: %w", err)
+		}
+		if deleted < int64(size) {
+			break
+		}
+		if !c.pause() {
+			return total, nil
+		}
+	}
+	if total > 0 {
+		log.Printf("✓ Cleanup: retention deleted %d expired records", total)
+	}
+	return total, nil
+}
+
+// retentionCondition returns the WHERE clause selecting expired rows. A row
+// is expired when it matches at least one rule and is older than the
+// period of every rule it matches, so the longest period wins:
+//
+//	ReceivedAt < <newest cutoff>
+//	AND (match1 OR match2 …)
+//	AND (NOT match1 OR ReceivedAt < cutoff1) AND (NOT match2 OR ReceivedAt < cutoff2) …
+func (c *Cleaner) retentionCondition(now time.Time) (string, []interface{}) {
+	var (
+		matches     []string
+		matchArgs   [][]interface{}
+		newestLimit time.Time
+	)
+	for _, r := range c.cfg.Retention {
+		m, a := c.ruleMatch(r)
+		matches = append(matches, m)
+		matchArgs = append(matchArgs, a)
+		if cutoff := now.Add(-r.MaxAge); cutoff.After(newestLimit) {
+			newestLimit = cutoff
+		}
+	}
+
+	conditions := []string{"ReceivedAt < ?"}
+	args := []interface{}{newestLimit}
+
+	alternatives := make([]string, len(matches))
+	for i, m := range matches {
+		alternatives[i] = "(" + m + ")"
+		args = append(args, matchArgs[i]...)
+	}
+	conditions = append(conditions, "("+strings.Join(alternatives, " OR ")+")")
+
+	for i, r := range c.cfg.Retention {
+		conditions = append(conditions, fmt.Sprintf("(NOT (%s) OR ReceivedAt < ?)", matches[i]))
+		args = append(args, matchArgs[i]...)
+		args = append(args, now.Add(-r.MaxAge))
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// ruleMatch returns the condition matching the rows a rule applies to.
+// Nullable columns are coalesced so that NOT (…) never yields NULL.
+func (c *Cleaner) ruleMatch(r RetentionRule) (string, []interface{}) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	if len(r.Severity) > 0 {
+		conds = append(conds, fmt.Sprintf("COALESCE(%s, -1) IN (%s)",
+			c.db.ColumnExpr("Severity"), placeholders(len(r.Severity))))
+		for _, v := range r.Severity {
+			args = append(args, v)
+		}
+	}
+	if len(r.Facility) > 0 {
+		conds = append(conds, fmt.Sprintf("COALESCE(Facility, -1) IN (%s)", placeholders(len(r.Facility))))
+		for _, v := range r.Facility {
+			args = append(args, v)
+		}
+	}
+	if len(r.FromHost) > 0 {
+		likes := make([]string, len(r.FromHost))
+		for i, pattern := range r.FromHost {
+			likes[i] = "COALESCE(FromHost, '') LIKE ? ESCAPE '!'"
+			args = append(args, hold.LikePattern(pattern))
+		}
+		conds = append(conds, "("+strings.Join(likes, " OR ")+")")
+	}
+	if len(r.ProgramName) > 0 {
+		conds = append(conds, fmt.Sprintf("COALESCE(%s, '') IN (%s)",
+			c.db.ColumnExpr("ProgramName"), placeholders(len(r.ProgramName))))
+		for _, v := range r.ProgramName {
+			args = append(args, v)
+		}
+	}
+	if len(conds) == 0 {
+		return "1=1", nil
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
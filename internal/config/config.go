@@ -6,9 +6,13 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/BurntSushi/toml"
 )
@@ -86,17 +90,30 @@ func Save(cfg *Config) error {
 
 // Validate checks that all required fields are set and values are in range.
 func (c *Config) Validate() error {
-	if c.Database.Host == "" {
-		return fmt.Errorf("database.host is required")
-	}
-	if c.Database.Name == "" {
-		return fmt.Errorf("database.name is required")
-	}
-	if c.Database.User == "" {
-		return fmt.Errorf("database.user is required")
+	if len(c.Databases) == 0 {
+		if err := c.Database.validate("database"); err != nil {
+			return err
+		}
 	}
-	if c.Database.Password == "" {
-		return fmt.Errorf("database.password is required")
+	names := make(map[string]bool, len(c.Databases))
+	for i, src := range c.Databases {
+		if src.Name == "" {
+			return fmt.Errorf("databases[%d].name is required", i)
+		}
+		if names[src.Name] {
+			return fmt.Errorf("databases[%d]: duplicate name %q", i, src.Name)
+		}
+		names[src.Name] = true
+		if src.Database == "" && !src.Connection().IsFileBased() {
+			return fmt.Errorf("databases[%d].database is required", i)
+		}
+		if err := src.Connection().validate(fmt.Sprintf("databases[%d]", i)); err != nil {
+			return err
+		}
+		// The WHERE clause of a request is built once for all sources.
+		if src.Connection().DriverName() != c.Databases[0].Connection().DriverName() {
+			return fmt.Errorf("databases[%d].driver: all databases must use the same driver", i)
+		}
 	}
 	if c.Auth.AdminPasswordHash == "" {
 		return fmt.Errorf("auth.admin_password_hash is required")
@@ -107,22 +124,291 @@ func (c *Config) Validate() error {
 	if c.Cleanup.ThresholdPercent <= 0 || c.Cleanup.ThresholdPercent > 100 {
 		return fmt.Errorf("cleanup.threshold_percent must be between 1 and 100")
 	}
+	switch c.Cleanup.Mode {
+	case CleanupModeDisk:
+	case CleanupModeTableSize:
+		if c.Cleanup.MaxTableBytes <= 0 {
+			return fmt.Errorf("cleanup.max_table_bytes must be greater than 0 in table_size mode")
+		}
+	default:
+		return fmt.Errorf("cleanup.mode must be %q or %q", CleanupModeDisk, CleanupModeTableSize)
+	}
+	if c.Cleanup.HoldsFile == "" {
+		return fmt.Errorf("cleanup.holds_file is required")
+	}
+	high := c.Cleanup.ThresholdPercent
+	if c.Cleanup.Mode == CleanupModeTableSize {
+		high = 100 // percent of max_table_bytes
+	}
+	if c.Cleanup.LowWaterPercent < 0 || c.Cleanup.LowWaterPercent >= high {
+		return fmt.Errorf("cleanup.low_water_percent must be between 0 and %.1f", high)
+	}
+	if c.Cleanup.BatchLatency <= 0 {
+		return fmt.Errorf("cleanup.batch_latency must be greater than 0")
+	}
+	if c.Cleanup.BatchPause < 0 {
+		return fmt.Errorf("cleanup.batch_pause must not be negative")
+	}
+	switch c.Cleanup.Reclaim {
+	case "":
+	case ReclaimOptimize, ReclaimRebuild:
+		if _, err := ParseWindow(c.Cleanup.ReclaimWindow); err != nil {
+			return fmt.Errorf("cleanup.reclaim_window: %w", err)
+		}
+		if c.Cleanup.ReclaimMinFreeMB < 0 {
+			return fmt.Errorf("cleanup.reclaim_min_free_mb must not be negative")
+		}
+	default:
+		return fmt.Errorf("cleanup.reclaim must be empty, %q or %q", ReclaimOptimize, ReclaimRebuild)
+	}
+	ruleNames := make(map[string]bool, len(c.Cleanup.Retention))
+	for i, r := range c.Cleanup.Retention {
+		if r.Name == "" {
+			return fmt.Errorf("cleanup.retention[%d].name is required", i)
+		}
+		if ruleNames[r.Name] {
+			return fmt.Errorf("cleanup.retention[%d]: duplicate name %q", i, r.Name)
+		}
+		ruleNames[r.Name] = true
+		if r.Days <= 0 {
+			return fmt.Errorf("cleanup.retention[%d].days must be greater than 0", i)
+		}
+		for _, s := range r.Severity {
+			if s < 0 || s > 7 {
+				return fmt.Errorf("cleanup.retention[%d].severity must be between 0 and 7", i)
+			}
+		}
+		for _, f := range r.Facility {
+			if f < 0 || f > 23 {
+				return fmt.Errorf("cleanup.retention[%d].facility must be between 0 and 23", i)
+			}
+		}
+	}
+	if p := c.Partitions; p.Enabled {
+		if c.DatabaseSources()[0].Connection().DriverName() != DriverMySQL {
+			return fmt.Errorf("partitions: only supported with driver %q", DriverMySQL)
+		}
+		if p.RetentionDays < 0 {
+			return fmt.Errorf("partitions.retention_days must not be negative")
+		}
+		if p.FutureDays < 1 || p.Interval <= 0 || p.ChunkSize <= 0 {
+			return fmt.Errorf("partitions.future_days, partitions.interval and partitions.chunk_size must be greater than 0")
+		}
+	}
+	if r := c.Rollups; r.Enabled {
+		if r.Interval <= 0 || r.ChunkSize <= 0 {
+			return fmt.Errorf("rollups.interval and rollups.chunk_size must be greater than 0")
+		}
+		if r.MinuteRetention < time.Hour {
+			return fmt.Errorf("rollups.minute_retention must be at least 1h")
+		}
+	}
+	if c.QueryLog.SlowThreshold < 0 || c.QueryLog.Size < 0 {
+		return fmt.Errorf("query_log.slow_threshold and query_log.size must not be negative")
+	}
+	if l := c.QueryLimit; l.Enabled {
+		if l.LookupSlots < 1 || l.MaxWait <= 0 {
+			return fmt.Errorf("query_limits.lookup_slots and query_limits.max_wait must be greater than 0")
+		}
+		// A log page runs a scan (1) and two counts (2 each) at once.
+		if l.ScanSlots < 5 || (l.KeyScanSlots != 0 && l.KeyScanSlots < 5) {
+			return fmt.Errorf("query_limits.scan_slots and query_limits.key_scan_slots must be at least 5, the weight of one /api/logs request")
+		}
+		if l.KeyScanSlots < 0 || l.KeyLookupSlots < 0 {
+			return fmt.Errorf("query_limits.key_scan_slots and query_limits.key_lookup_slots must not be negative")
+		}
+	}
+	seen := make(map[string]bool, len(c.Parsers))
+	for i, p := range c.Parsers {
+		if p.Name == "" {
+			return fmt.Errorf("parsers[%d].name is required", i)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("parsers[%d]: duplicate name %q", i, p.Name)
+		}
+		seen[p.Name] = true
+		if p.MatchTag == "" {
+			return fmt.Errorf("parsers[%d].match_tag is required", i)
+		}
+		if p.Pattern == "" {
+			return fmt.Errorf("parsers[%d].pattern is required", i)
+		}
+	}
+	if c.Anomaly.Enabled {
+		if c.Anomaly.Alpha <= 0 || c.Anomaly.Alpha >= 1 {
+			return fmt.Errorf("anomaly.alpha must be between 0 and 1 (exclusive)")
+		}
+		if c.Anomaly.Threshold <= 0 {
+			return fmt.Errorf("anomaly.threshold must be greater than 0")
+		}
+		if c.Anomaly.Interval <= 0 {
+			return fmt.Errorf("anomaly.interval must be greater than 0")
+		}
+		if c.Anomaly.MinSamples < 1 {
+			return fmt.Errorf("anomaly.min_samples must be at least 1")
+		}
+	}
+	fwdNames := make(map[string]bool, len(c.Forwarders))
+	for i, f := range c.Forwarders {
+		if f.Name == "" {
+			return fmt.Errorf("forwarders[%d].name is required", i)
+		}
+		if fwdNames[f.Name] {
+			return fmt.Errorf("forwarders[%d]: duplicate name %q", i, f.Name)
+		}
+		fwdNames[f.Name] = true
+		switch f.Format {
+		case "cef", "leef", "json":
+		default:
+			return fmt.Errorf("forwarders[%d].format must be \"cef\", \"leef\" or \"json\"", i)
+		}
+		switch f.Transport {
+		case "tcp", "tls", "udp":
+		default:
+			return fmt.Errorf("forwarders[%d].transport must be \"tcp\", \"tls\" or \"udp\"", i)
+		}
+		if _, _, err := net.SplitHostPort(f.Address); err != nil {
+			return fmt.Errorf("forwarders[%d].address must be host:port", i)
+		}
+		if f.StartAt != "" && f.StartAt != "end" && f.StartAt != "beginning" {
+			return fmt.Errorf("forwarders[%d].start_at must be \"end\" or \"beginning\"", i)
+		}
+	}
+	if len(c.Forwarders) > 0 && (c.Forwarding.StateDir == "" || c.Forwarding.BatchSize <= 0) {
+		return fmt.Errorf("forwarding.state_dir and forwarding.batch_size are required")
+	}
+	if c.Receiver.Enabled {
+		r := c.Receiver
+		if r.UDP == "" && r.TCP == "" && r.TLS == "" {
+			return fmt.Errorf("receiver: at least one of udp, tcp or tls must be set")
+		}
+		if r.TLS != "" && (r.TLSCertFile == "" || r.TLSKeyFile == "") {
+			return fmt.Errorf("receiver.tls_cert and receiver.tls_key are required for receiver.tls")
+		}
+		if r.BatchSize <= 0 {
+			return fmt.Errorf("receiver.batch_size must be greater than 0")
+		}
+		if r.RateLimit < 0 || r.RateBurst < 0 {
+			return fmt.Errorf("receiver.rate_limit and receiver.rate_burst must not be negative")
+		}
+	}
 	return nil
 }
 
-// DSN builds a MySQL DSN string from the database configuration.
+// validate checks the connection fields of one database section.
+// prefix names the section in error messages.
+func (d DatabaseConfig) validate(prefix string) error {
+	switch d.DriverName() {
+	case DriverMySQL, DriverPostgres:
+	case DriverSQLite:
+		if d.Path == "" {
+			return fmt.Errorf("%s.path is required for driver %q", prefix, DriverSQLite)
+		}
+		return nil
+	case DriverFile:
+		if d.Path == "" {
+			return fmt.Errorf("%s.path (index file) is required for driver %q", prefix, DriverFile)
+		}
+		if len(d.Files) == 0 {
+			return fmt.Errorf("%s.files is required for driver %q", prefix, DriverFile)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%s.driver must be %q, %q, %q or %q",
+			prefix, DriverMySQL, DriverPostgres, DriverSQLite, DriverFile)
+	}
+	if d.Host == "" {
+		return fmt.Errorf("%s.host is required", prefix)
+	}
+	if d.Name == "" {
+		return fmt.Errorf("%s.name is required", prefix)
+	}
+	if d.User == "" {
+		return fmt.Errorf("%s.user is required", prefix)
+	}
+	if d.Password == "" {
+		return fmt.Errorf("%s.password is required", prefix)
+	}
+	return nil
+}
+
+// DSN builds the driver DSN string from the primary database configuration.
 // The password is decrypted if it has the "enc:" prefix.
 func (c *Config) DSN() (string, error) {
-	pass, err := DecryptPassword(c.Database.Password)
+	return c.Database.DSN()
+}
+
+// DriverName returns the configured driver, defaulting to DriverMySQL.
+func (d DatabaseConfig) DriverName() string {
+	if d.Driver == "" {
+		return DriverMySQL
+	}
+	return d.Driver
+}
+
+// IsFileBased reports whether the database is a local SQLite file, either
+// read directly or maintained as the index of log files.
+func (d DatabaseConfig) IsFileBased() bool {
+	return d.DriverName() == DriverSQLite || d.DriverName() == DriverFile
+}
+
+// DSN builds the DSN string for this database in the format of its driver.
+// The password is decrypted if it has the "enc:" prefix.
+func (d DatabaseConfig) DSN() (string, error) {
+	switch d.DriverName() {
+	case DriverSQLite:
+		// Wait for rsyslog's write lock instead of failing with SQLITE_BUSY.
+		return "file:" + d.Path + "?_pragma=busy_timeout(5000)", nil
+	case DriverFile:
+		// The index is written while queries run; WAL lets both proceed.
+		return "file:" + d.Path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", nil
+	}
+
+	pass, err := DecryptPassword(d.Password)
 	if err != nil {
 		return "", fmt.Errorf("failed to decrypt database password: %w", err)
 	}
-	port := c.Database.Port
+
+	if d.DriverName() == DriverPostgres {
+		port := d.Port
+		if port == 0 {
+			port = 5432
+		}
+		u := url.URL{
+			Scheme: "postgres",
+			User:   url.UserPassword(d.User, pass),
+			Host:   net.JoinHostPort(d.Host, strconv.Itoa(port)),
+			Path:   "/" + d.Name,
+		}
+		// Give up on an unreachable host instead of waiting for the OS.
+		params := url.Values{"connect_timeout": {"5"}}
+		if d.SSLMode != "" {
+			params.Set("sslmode", d.SSLMode)
+		}
+		u.RawQuery = params.Encode()
+		return u.String(), nil
+	}
+
+	port := d.Port
 	if port == 0 {
 		port = 3306
 	}
-	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true&loc=Local",
-		c.Database.User, pass, c.Database.Host, port, c.Database.Name), nil
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true&loc=Local&timeout=5s",
+		d.User, pass, d.Host, port, d.Name), nil
+}
+
+// DatabaseSources returns the databases to query. With [[databases]] the
+// configured entries are returned; otherwise the single [database] section
+// as an unnamed source.
+func (c *Config) DatabaseSources() []DatabaseSource {
+	if len(c.Databases) > 0 {
+		return c.Databases
+	}
+	d := c.Database
+	return []DatabaseSource{{
+		Driver: d.Driver, Path: d.Path, Files: d.Files, Host: d.Host, Port: d.Port, Database: d.Name,
+		User: d.User, Password: d.Password, SSLMode: d.SSLMode,
+	}}
 }
 
 // configPath returns the active configuration file path.
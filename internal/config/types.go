@@ -6,8 +6,25 @@ import "time"
 type Config struct {
 	Server   ServerConfig   `toml:"server"`
 	Database DatabaseConfig `toml:"database"`
-	Auth     AuthConfig     `toml:"auth"`
-	Cleanup  CleanupConfig  `toml:"cleanup"`
+
+	// Databases lists several named rsyslog databases that are queried
+	// together. When empty, the single [database] section is used.
+	Databases []DatabaseSource `toml:"databases"`
+
+	Auth    AuthConfig     `toml:"auth"`
+	Cleanup CleanupConfig  `toml:"cleanup"`
+	Anomaly AnomalyConfig  `toml:"anomaly"`
+	Parsers []ParserConfig `toml:"parsers"`
+
+	Partitions PartitionsConfig `toml:"partitions"`
+	Rollups    RollupsConfig    `toml:"rollups"`
+	QueryLog   QueryLogConfig   `toml:"query_log"`
+	QueryLimit QueryLimitConfig `toml:"query_limits"`
+
+	Receiver ReceiverConfig `toml:"receiver"`
+
+	Forwarding ForwardingConfig  `toml:"forwarding"`
+	Forwarders []ForwarderConfig `toml:"forwarders"`
 
 	// Runtime-only fields (not persisted to TOML)
 	InstallPath string `toml:"-"`
@@ -25,14 +42,50 @@ type ServerConfig struct {
 	AutoRefreshInterval int      `toml:"auto_refresh_interval"` // seconds
 }
 
+// Supported values of database.driver.
+const (
+	DriverMySQL    = "mysql"    // rsyslog ommysql (MySQL / MariaDB)
+	DriverPostgres = "postgres" // rsyslog ompgsql
+	DriverSQLite   = "sqlite"   // rsyslog omlibdbi, or a file created by rsyslox
+	DriverFile     = "file"     // rsyslog omfile text files, indexed into an SQLite file
+)
+
 // DatabaseConfig holds database connection settings.
 // Password is stored AES-GCM encrypted with prefix "enc:".
 type DatabaseConfig struct {
-	Host     string `toml:"host"`
-	Port     int    `toml:"port"`
-	Name     string `toml:"name"`
-	User     string `toml:"user"`
-	Password string `toml:"password"` // may be "enc:<base64>" or plaintext during setup
+	Driver   string   `toml:"driver"` // DriverMySQL (default), DriverPostgres, DriverSQLite or DriverFile
+	Path     string   `toml:"path"`   // SQLite: database file, file: index file; host, user and password are ignored
+	Files    []string `toml:"files"`  // file only: log files to read, e.g. /var/log/syslog
+	Host     string   `toml:"host"`
+	Port     int      `toml:"port"`
+	Name     string   `toml:"name"`
+	User     string   `toml:"user"`
+	Password string   `toml:"password"` // may be "enc:<base64>" or plaintext during setup
+	SSLMode  string   `toml:"sslmode"`  // PostgreSQL only: disable, require, verify-ca, verify-full
+}
+
+// DatabaseSource is one named entry of [[databases]]. The keys match
+// [database] except that the database name is given as "database",
+// because "name" names the source.
+type DatabaseSource struct {
+	Name     string   `toml:"name"`
+	Driver   string   `toml:"driver"`
+	Path     string   `toml:"path"`
+	Files    []string `toml:"files"`
+	Host     string   `toml:"host"`
+	Port     int      `toml:"port"`
+	Database string   `toml:"database"`
+	User     string   `toml:"user"`
+	Password string   `toml:"password"` // may be "enc:<base64>" or plaintext
+	SSLMode  string   `toml:"sslmode"`
+}
+
+// Connection returns the connection settings of the source.
+func (s DatabaseSource) Connection() DatabaseConfig {
+	return DatabaseConfig{
+		Driver: s.Driver, Path: s.Path, Files: s.Files, Host: s.Host, Port: s.Port, Name: s.Database,
+		User: s.User, Password: s.Password, SSLMode: s.SSLMode,
+	}
 }
 
 // ReadOnlyKey is a named API key for read-only access.
@@ -42,19 +95,177 @@ type ReadOnlyKey struct {
 	KeyHash string `toml:"key_hash"` // sha256 hex
 }
 
+// WriteKey is a named API key that may only submit log entries
+// (POST /api/ingest). Quotas of 0 are unlimited.
+type WriteKey struct {
+	Name           string `toml:"name"`
+	KeyHash        string `toml:"key_hash"`         // sha256 hex
+	QuotaPerMinute int    `toml:"quota_per_minute"` // entries per minute
+	QuotaPerDay    int    `toml:"quota_per_day"`    // entries per calendar day (local time)
+}
+
 // AuthConfig holds authentication settings.
 type AuthConfig struct {
 	AdminPasswordHash string        `toml:"admin_password_hash"` // bcrypt
 	ReadOnlyKeys      []ReadOnlyKey `toml:"read_only_keys"`
+	WriteKeys         []WriteKey    `toml:"write_keys"`
 }
 
+// Supported values of cleanup.mode.
+const (
+	CleanupModeDisk      = "disk"       // usage of the filesystem at disk_path
+	CleanupModeTableSize = "table_size" // size of SystemEvents as reported by the database
+)
+
+// Supported values of cleanup.reclaim.
+const (
+	ReclaimOptimize = "optimize" // OPTIMIZE TABLE (VACUUM on SQLite, VACUUM FULL on PostgreSQL)
+	ReclaimRebuild  = "rebuild"  // ALTER TABLE … FORCE
+)
+
 // CleanupConfig holds the log cleanup / housekeeping settings.
 type CleanupConfig struct {
 	Enabled          bool          `toml:"enabled"`
+	Mode             string        `toml:"mode"` // CleanupMode*
 	DiskPath         string        `toml:"disk_path"`
 	ThresholdPercent float64       `toml:"threshold_percent"`
+	MaxTableBytes    int64         `toml:"max_table_bytes"` // size cap in table_size mode
 	BatchSize        int           `toml:"batch_size"`
 	Interval         time.Duration `toml:"interval"`
+	ArchiveDir       string        `toml:"archive_dir"` // archive rows here before deleting; "" = delete only
+	HoldsFile        string        `toml:"holds_file"`  // legal holds, managed via /api/admin/holds
+
+	// Once over the threshold, disk cleanup deletes until usage falls below
+	// LowWaterPercent (0 = 5 points below the threshold), in batches sized
+	// to take about BatchLatency each, BatchPause apart.
+	LowWaterPercent float64       `toml:"low_water_percent"`
+	BatchLatency    time.Duration `toml:"batch_latency"`
+	BatchPause      time.Duration `toml:"batch_pause"`
+
+	// Reclaim returns the free space inside SystemEvents to the filesystem
+	// once it exceeds ReclaimMinFreeMB, inside ReclaimWindow ("HH:MM-HH:MM").
+	Reclaim          string `toml:"reclaim"` // "", ReclaimOptimize or ReclaimRebuild
+	ReclaimWindow    string `toml:"reclaim_window"`
+	ReclaimMinFreeMB int    `toml:"reclaim_min_free_mb"`
+
+	// Retention rules are enforced every interval, independent of disk
+	// usage. A row matching several rules is kept for the longest of
+	// their periods; rows matching none are only removed under disk pressure.
+	Retention []RetentionRule `toml:"retention"`
+}
+
+// RetentionRule deletes matching rows older than Days. Values within a list
+// are ORed, lists are ANDed; a rule without criteria matches every row.
+type RetentionRule struct {
+	Name        string   `toml:"name"`
+	Days        int      `toml:"days"`
+	Severity    []int    `toml:"severity"`
+	Facility    []int    `toml:"facility"`
+	FromHost    []string `toml:"host"` // "*" matches any characters, e.g. "dmz-*"
+	ProgramName []string `toml:"program"`
+}
+
+// PartitionsConfig holds the settings of the partition manager, which keeps
+// SystemEvents partitioned by day (MySQL only) and drops expired days.
+type PartitionsConfig struct {
+	Enabled       bool          `toml:"enabled"`
+	RetentionDays int           `toml:"retention_days"` // drop partitions older than this, 0 = keep all
+	FutureDays    int           `toml:"future_days"`    // partitions created ahead of today
+	Interval      time.Duration `toml:"interval"`       // how often partitions are created and dropped
+	ChunkSize     int           `toml:"chunk_size"`     // rows copied per statement during migration
+}
+
+// RollupsConfig holds the settings of the rollup worker, which keeps
+// per-minute and per-hour entry counts for fast statistics.
+type RollupsConfig struct {
+	Enabled         bool          `toml:"enabled"`
+	Interval        time.Duration `toml:"interval"`         // how often new rows are counted
+	ChunkSize       int           `toml:"chunk_size"`       // rows read per query
+	MinuteRetention time.Duration `toml:"minute_retention"` // how long minute buckets are kept
+}
+
+// QueryLogConfig holds the settings of the slow query log, which times
+// every database call.
+type QueryLogConfig struct {
+	SlowThreshold time.Duration `toml:"slow_threshold"` // calls at least this slow are kept
+	Size          int           `toml:"size"`           // slow calls kept, 0 = none
+}
+
+// QueryLimitConfig bounds the database calls that API requests run at the
+// same time, per database. The pool of each database has 25 connections.
+type QueryLimitConfig struct {
+	Enabled        bool          `toml:"enabled"`
+	ScanSlots      int           `toml:"scan_slots"`       // concurrent log pages (1 each) and counts (2 each)
+	LookupSlots    int           `toml:"lookup_slots"`     // concurrent metadata and single-row lookups
+	KeyScanSlots   int           `toml:"key_scan_slots"`   // scan slots one API key may use, 0 = all
+	KeyLookupSlots int           `toml:"key_lookup_slots"` // lookup slots one API key may use, 0 = all
+	MaxWait        time.Duration `toml:"max_wait"`         // wait for a slot before answering 503
+}
+
+// AnomalyConfig holds the settings of the message-rate anomaly detector.
+type AnomalyConfig struct {
+	Enabled    bool          `toml:"enabled"`
+	Interval   time.Duration `toml:"interval"`    // how often finished hours are evaluated
+	Alpha      float64       `toml:"alpha"`       // EWMA smoothing factor (0-1)
+	Threshold  float64       `toml:"threshold"`   // |score| at which an hour is flagged
+	MinSamples int           `toml:"min_samples"` // hours a baseline needs before it can flag
+	LearnHours int           `toml:"learn_hours"` // history replayed at startup
+}
+
+// ReceiverConfig holds the settings of the built-in syslog receiver.
+// An empty listen address disables that listener.
+type ReceiverConfig struct {
+	Enabled       bool          `toml:"enabled"`
+	UDP           string        `toml:"udp"`      // e.g. ":514"
+	TCP           string        `toml:"tcp"`      // e.g. ":514", octet-counted or newline framing
+	TLS           string        `toml:"tls"`      // e.g. ":6514"
+	TLSCertFile   string        `toml:"tls_cert"` // required when tls is set
+	TLSKeyFile    string        `toml:"tls_key"`
+	BatchSize     int           `toml:"batch_size"`     // rows per INSERT
+	FlushInterval time.Duration `toml:"flush_interval"` // max delay before a partial batch is written
+	RateLimit     float64       `toml:"rate_limit"`     // messages/s per sender address, 0 = unlimited
+	RateBurst     int           `toml:"rate_burst"`     // messages a sender may send at once
+}
+
+// ForwardingConfig holds the settings shared by all [[forwarders]].
+type ForwardingConfig struct {
+	StateDir   string        `toml:"state_dir"`    // checkpoints and disk queues
+	Interval   time.Duration `toml:"interval"`     // how often new rows are read
+	BatchSize  int           `toml:"batch_size"`   // rows read per query
+	MaxQueueMB int           `toml:"max_queue_mb"` // disk queue limit per forwarder
+}
+
+// ForwarderConfig defines one SIEM destination. New SystemEvents rows that
+// match Filter are formatted and sent to Address.
+type ForwarderConfig struct {
+	Name          string          `toml:"name"`
+	Format        string          `toml:"format"`    // "cef", "leef" or "json"
+	Transport     string          `toml:"transport"` // "tcp", "tls" or "udp"
+	Address       string          `toml:"address"`   // host:port
+	Syslog        bool            `toml:"syslog"`    // wrap each event in an RFC 5424 header
+	TLSCAFile     string          `toml:"tls_ca"`    // CA bundle for tls; system roots when empty
+	TLSSkipVerify bool            `toml:"tls_skip_verify"`
+	StartAt       string          `toml:"start_at"` // "end" (default) or "beginning" on first start
+	Filter        ForwarderFilter `toml:"filter"`
+}
+
+// ForwarderFilter selects the rows a forwarder sends. Values within a list
+// are ORed, lists are ANDed; empty lists match everything.
+type ForwarderFilter struct {
+	Facility    []int    `toml:"facility"`
+	Severity    []int    `toml:"severity"`
+	FromHost    []string `toml:"host"`
+	ProgramName []string `toml:"program"`
+	Message     []string `toml:"message"` // substrings, all must match
+}
+
+// ParserConfig defines a named Grok-style parser. Its pattern is applied to
+// messages whose program name (SysLogTag without PID) equals MatchTag, and
+// every %{PATTERN:field} becomes a typed virtual field of those entries.
+type ParserConfig struct {
+	Name     string `toml:"name"`
+	MatchTag string `toml:"match_tag"`
+	Pattern  string `toml:"pattern"`
 }
 
 // defaults returns a Config pre-filled with sensible defaults.
@@ -76,13 +287,65 @@ func defaults() *Config {
 		},
 		Auth: AuthConfig{
 			ReadOnlyKeys: []ReadOnlyKey{},
+			WriteKeys:    []WriteKey{},
 		},
 		Cleanup: CleanupConfig{
 			Enabled:          false,
+			Mode:             CleanupModeDisk,
 			DiskPath:         "/var/lib/mysql",
 			ThresholdPercent: 85.0,
 			BatchSize:        1000,
 			Interval:         15 * time.Minute,
+			BatchLatency:     500 * time.Millisecond,
+			BatchPause:       time.Second,
+			HoldsFile:        "/var/lib/rsyslox/holds.json",
+			ReclaimWindow:    "02:00-05:00",
+			ReclaimMinFreeMB: 1024,
+		},
+		Anomaly: AnomalyConfig{
+			Enabled:    false,
+			Interval:   5 * time.Minute,
+			Alpha:      0.1,
+			Threshold:  4.0,
+			MinSamples: 24,
+			LearnHours: 168,
+		},
+		Partitions: PartitionsConfig{
+			Enabled:    false,
+			FutureDays: 7,
+			Interval:   time.Hour,
+			ChunkSize:  5000,
+		},
+		Rollups: RollupsConfig{
+			Enabled:         false,
+			Interval:        time.Minute,
+			ChunkSize:       10000,
+			MinuteRetention: 7 * 24 * time.Hour,
+		},
+		QueryLog: QueryLogConfig{
+			SlowThreshold: 500 * time.Millisecond,
+			Size:          200,
+		},
+		QueryLimit: QueryLimitConfig{
+			Enabled:        false,
+			ScanSlots:      16,
+			LookupSlots:    8,
+			KeyScanSlots:   8,
+			KeyLookupSlots: 4,
+			MaxWait:        10 * time.Second,
+		},
+		Forwarding: ForwardingConfig{
+			StateDir:   "/var/lib/rsyslox/forwarders",
+			Interval:   2 * time.Second,
+			BatchSize:  500,
+			MaxQueueMB: 256,
+		},
+		Receiver: ReceiverConfig{
+			Enabled:       false,
+			UDP:           ":514",
+			TCP:           ":514",
+			BatchSize:     500,
+			FlushInterval: time.Second,
 		},
 	}
 }
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a daily time window in local time, e.g. "02:00-04:30". A window
+// whose end is before its start spans midnight.
+type Window struct {
+	Start time.Duration // since midnight
+	End   time.Duration
+}
+
+// ParseWindow parses "HH:MM-HH:MM".
+func ParseWindow(s string) (Window, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return Window{}, fmt.Errorf("invalid window %q, expected HH:MM-HH:MM", s)
+	}
+	start, err := parseClock(strings.TrimSpace(from))
+	if err != nil {
+		return Window{}, err
+	}
+	end, err := parseClock(strings.TrimSpace(to))
+	if err != nil {
+		return Window{}, err
+	}
+	if start == end {
+		return Window{}, fmt.Errorf("invalid window %q: start and end are equal", s)
+	}
+	return Window{Start: start, End: end}, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains reports whether t falls inside the window.
+func (w Window) Contains(t time.Time) bool {
+	d := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+	if w.Start < w.End {
+		return d >= w.Start && d < w.End
+	}
+	return d >= w.Start || d < w.End
+}
+
+// Length returns the duration of the window.
+func (w Window) Length() time.Duration {
+	if w.Start < w.End {
+		return w.End - w.Start
+	}
+	return 24*time.Hour - w.Start + w.End
+}
+
+func (w Window) String() string {
+	clock := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return clock(w.Start) + "-" + clock(w.End)
+}
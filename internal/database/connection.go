@@ -4,10 +4,15 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/fields"
+	"github.com/phil-bot/rsyslox/internal/querylimit"
+	"github.com/phil-bot/rsyslox/internal/querylog"
 )
 
 // DB wraps the database connection and provides helper methods.
@@ -16,16 +21,38 @@ type DB struct {
 	AvailableColumns []string
 	PriorityMode     PriorityMode
 	MetaCache        *MetaCache
+	Fields           *fields.Extractor   // configured parsers + generic field extraction
+	Dialect          Dialect             // SQL differences of the configured driver
+	Queries          *querylog.Recorder  // times every call; may be nil
+	Limits           *querylimit.Limiter // bounds concurrent calls of API requests; nil = unlimited
+
+	indexMu  sync.Mutex
+	indexJob *IndexJob // current or last index job, see StartIndexJob
 }
 
-// Connect establishes a connection to the database using the TOML-based config.
-func Connect(cfg *config.Config) (*DB, error) {
-	dsn, err := cfg.DSN()
+// Connect establishes a connection to one rsyslog database.
+// cfg supplies the settings shared by all databases (e.g. parsers);
+// queries records the timings of the calls and may be nil.
+func Connect(cfg *config.Config, dbCfg config.DatabaseConfig, queries *querylog.Recorder) (*DB, error) {
+	dialect, err := newDialect(dbCfg.DriverName())
+	if err != nil {
+		return nil, err
+	}
+	dsn, err := dbCfg.DSN()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build DSN: %w", err)
 	}
 
-	sqlDB, err := sql.Open("mysql", dsn)
+	parsers := make([]fields.Parser, len(cfg.Parsers))
+	for i, p := range cfg.Parsers {
+		parsers[i] = fields.Parser{Name: p.Name, MatchTag: p.MatchTag, Pattern: p.Pattern}
+	}
+	extractor, err := fields.NewExtractor(parsers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile parsers: %w", err)
+	}
+
+	sqlDB, err := sql.Open(dialect.driverName(), dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -35,13 +62,24 @@ func Connect(cfg *config.Config) (*DB, error) {
 	sqlDB.SetConnMaxLifetime(5 * time.Minute)
 
 	if err := sqlDB.Ping(); err != nil {
+		sqlDB.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	log.Println("✓ Database connection established")
-
-	db := &DB{DB: sqlDB, MetaCache: NewMetaCache()}
+	log.Printf("✓ Database connection established (%s)", dialect.Name())
+
+	db := &DB{DB: sqlDB, MetaCache: NewMetaCache(), Fields: extractor, Dialect: dialect, Queries: queries}
+	if l := cfg.QueryLimit; l.Enabled {
+		db.Limits = querylimit.New(querylimit.Config{
+			LookupSlots:    l.LookupSlots,
+			ScanSlots:      l.ScanSlots,
+			KeyLookupSlots: l.KeyLookupSlots,
+			KeyScanSlots:   l.KeyScanSlots,
+			MaxWait:        l.MaxWait,
+		})
+	}
 	if err := db.initialize(); err != nil {
+		sqlDB.Close()
 		return nil, err
 	}
 
@@ -50,9 +88,10 @@ func Connect(cfg *config.Config) (*DB, error) {
 
 // initialize performs initial database setup.
 func (db *DB) initialize() error {
-	if err := db.createIndexes(); err != nil {
+	if err := db.Dialect.prepare(db.DB); err != nil {
 		return err
 	}
+	db.createIndexes()
 	if err := db.loadColumns(); err != nil {
 		return err
 	}
@@ -61,41 +100,34 @@ func (db *DB) initialize() error {
 }
 
 // loadColumns loads all column names from the SystemEvents table.
-// "Severity" is added as a virtual computed column.
+// Virtual columns (Severity, ProgramName, ProcessID) are appended after the
+// real ones.
 func (db *DB) loadColumns() error {
-	rows, err := db.Query("SHOW COLUMNS FROM SystemEvents")
+	columns, err := db.Dialect.columns(db.DB)
 	if err != nil {
 		return fmt.Errorf("failed to query columns: %w", err)
 	}
-	defer rows.Close()
-
-	db.AvailableColumns = []string{}
-	for rows.Next() {
-		var field, colType, null, key, def, extra sql.NullString
-		if err := rows.Scan(&field, &colType, &null, &key, &def, &extra); err != nil {
-			log.Printf("Warning: failed to scan column info: %v", err)
-			continue
-		}
-		if field.Valid {
-			db.AvailableColumns = append(db.AvailableColumns, field.String)
-		}
-	}
+	db.AvailableColumns = columns
 
-	// Virtual column derived from Priority MOD 8
-	db.AvailableColumns = append(db.AvailableColumns, "Severity")
+	realCount := len(db.AvailableColumns)
+	db.AvailableColumns = append(db.AvailableColumns, virtualColumns...)
 
-	log.Printf("✓ Loaded %d columns from SystemEvents (+ virtual: Severity)",
-		len(db.AvailableColumns)-1)
+	log.Printf("✓ Loaded %d columns from SystemEvents (+ virtual: %s)",
+		realCount, strings.Join(virtualColumns, ", "))
 	return nil
 }
 
-// IsValidColumn checks if a column name is valid (real or virtual).
+// IsValidColumn checks if a column name is valid (real, virtual or a
+// parser field of the form "field.<name>").
 func (db *DB) IsValidColumn(column string) bool {
 	for _, col := range db.AvailableColumns {
 		if col == column {
 			return true
 		}
 	}
+	if name, ok := strings.CutPrefix(column, fields.QueryPrefix); ok {
+		return db.Fields.HasField(name)
+	}
 	return false
 }
 
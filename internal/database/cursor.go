@@ -0,0 +1,58 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/models"
+)
+
+// Cursor marks the last entry of a page. Entries are ordered by ReceivedAt
+// (newest first), then by source rank, then by ID (descending), so the
+// position is stable while new rows are being inserted.
+type Cursor struct {
+	ReceivedAt time.Time `json:"t"`
+	Source     string    `json:"s,omitempty"`
+	ID         int       `json:"id"`
+}
+
+// ParseCursor decodes the opaque cursor string returned as next_cursor.
+func ParseCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, models.NewValidationError("cursor", "malformed cursor")
+	}
+	var c Cursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.ReceivedAt.IsZero() {
+		return nil, models.NewValidationError("cursor", "malformed cursor")
+	}
+	return &c, nil
+}
+
+// String encodes the cursor for the API.
+func (c Cursor) String() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// cursorAfter returns the cursor pointing behind entry.
+func cursorAfter(entry models.LogEntry) string {
+	return Cursor{ReceivedAt: entry.ReceivedAt, Source: entry.Source, ID: entry.ID}.String()
+}
+
+// condition returns the WHERE condition selecting the entries of the source
+// with the given rank that come after the cursor.
+func (c *Cursor) condition(rank, cursorRank int) (string, []interface{}) {
+	switch {
+	case rank < cursorRank:
+		// Ties on ReceivedAt were already returned for this source.
+		return "ReceivedAt < ?", []interface{}{c.ReceivedAt}
+	case rank > cursorRank:
+		// Ties on ReceivedAt sort after the cursor's source.
+		return "ReceivedAt <= ?", []interface{}{c.ReceivedAt}
+	default:
+		return "(ReceivedAt < ? OR (ReceivedAt = ? AND ID < ?))",
+			[]interface{}{c.ReceivedAt, c.ReceivedAt, c.ID}
+	}
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/phil-bot/rsyslox/internal/querylimit"
+)
+
+// Diagnostics describes the database server and SystemEvents, for
+// GET /api/admin/db.
+type Diagnostics struct {
+	Driver       string `json:"driver"`
+	Version      string `json:"version,omitempty"`
+	PriorityMode string `json:"priority_mode"`
+	// TableRows is an estimate on MySQL and PostgreSQL.
+	TableRows   int64              `json:"table_rows"`
+	TableBytes  int64              `json:"table_bytes"`
+	DataFree    int64              `json:"data_free_bytes"`
+	Variables   map[string]string  `json:"variables"`
+	Recommended []RecommendedIndex `json:"recommended_indexes"`
+	Indexes     []IndexInfo        `json:"indexes"`
+	IndexJob    *IndexJob          `json:"index_job,omitempty"`
+	// QueryLimits is omitted when [query_limits] is disabled.
+	QueryLimits *querylimit.Status `json:"query_limits,omitempty"`
+	// Errors lists the parts that could not be read; the others are
+	// reported anyway.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Diagnostics collects the state of the database server and SystemEvents.
+func (db *DB) Diagnostics() *Diagnostics {
+	d := &Diagnostics{
+		Driver:       db.Dialect.Name(),
+		PriorityMode: db.PriorityMode.String(),
+		Variables:    map[string]string{},
+		Indexes:      []IndexInfo{},
+		IndexJob:     db.IndexJob(),
+		QueryLimits:  db.Limits.Status(),
+	}
+	fail := func(err error) { d.Errors = append(d.Errors, err.Error()) }
+
+	if err := db.DB.QueryRow(db.Dialect.versionQuery()).Scan(&d.Version); err != nil {
+		fail(fmt.Errorf("version query failed: %v", err))
+	}
+	if err := db.DB.QueryRow(db.Dialect.tableRowsQuery()).Scan(&d.TableRows); err != nil {
+		fail(fmt.Errorf("table rows query failed: %v", err))
+	}
+	var err error
+	if d.TableBytes, err = db.TableSize(); err != nil {
+		fail(err)
+	}
+	if d.DataFree, err = db.DataFree(); err != nil {
+		fail(err)
+	}
+	if err := db.loadVariables(d.Variables); err != nil {
+		fail(err)
+	}
+
+	indexes, err := db.Indexes()
+	if err != nil {
+		fail(err)
+	} else if indexes != nil {
+		d.Indexes = indexes
+	}
+	d.Recommended = db.RecommendedIndexes(indexes)
+	return d
+}
+
+// loadVariables reads the server variables relevant to rsyslox into vars.
+func (db *DB) loadVariables(vars map[string]string) error {
+	rows, err := db.DB.Query(db.Dialect.variablesQuery())
+	if err != nil {
+		return fmt.Errorf("variables query failed: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, value sql.NullString
+		if err := rows.Scan(&name, &value); err != nil {
+			return fmt.Errorf("variables query failed: %v", err)
+		}
+		vars[name.String] = value.String
+	}
+	return rows.Err()
+}
@@ -0,0 +1,347 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/fields"
+)
+
+// Dialect hides the SQL differences between the supported databases.
+//
+// Queries in this package are written once, with "?" placeholders and
+// unquoted identifiers (SystemEvents, ReceivedAt, …). DB.Query, DB.QueryRow
+// and DB.Exec rebind them for the dialect; everything that is not portable
+// (column discovery, indexes, severity arithmetic, text search, the virtual
+// column expressions) is provided by the dialect.
+type Dialect interface {
+	// Name returns the config.Driver* value of the dialect.
+	Name() string
+
+	// SeverityExpr returns the expression deriving Severity from Priority.
+	SeverityExpr() string
+
+	// MessageSearch returns the condition for a text search in Message.
+	MessageSearch(term string) (string, []interface{})
+
+	driverName() string
+	prepare(db *sql.DB) error
+	rebind(query string) string
+	bindArg(v interface{}) interface{}
+	scanTime(t time.Time) time.Time
+	timeBucketExpr(unit string) (expr string, epoch bool)
+	columns(db *sql.DB) ([]string, error)
+	indexes(partitioned bool) []index
+	partitionsQuery() string
+	programNameExpr() string
+	processIDExpr() string
+	fieldFilterSQL(f fields.Filter) (string, []interface{})
+	tableSizeQuery() string
+	dataFreeQuery() string
+	reclaimQuery(rebuild bool) string
+	tableRowsQuery() string
+	indexListQuery() string
+	dropIndexQuery(name string) string
+	versionQuery() string
+	variablesQuery() string
+	explain(db *sql.DB, query string, args []interface{}) (plan json.RawMessage, hints []string, err error)
+}
+
+// index is a recommended index of SystemEvents and the statement creating
+// it. An existing index with the same name or on the same columns
+// satisfies it.
+type index struct {
+	name    string
+	columns []string // nil: matched by name only
+	query   string
+}
+
+// newDialect returns the dialect for a config.Driver* value.
+func newDialect(driver string) (Dialect, error) {
+	switch driver {
+	case config.DriverMySQL:
+		return mysqlDialect{}, nil
+	case config.DriverPostgres:
+		return &postgresDialect{}, nil
+	case config.DriverSQLite, config.DriverFile:
+		return sqliteDialect{}, nil
+	}
+	return nil, fmt.Errorf("unsupported database driver %q", driver)
+}
+
+// systemEventsColumns are the columns of the rsyslog SystemEvents schema in
+// their canonical spelling. Databases that fold identifiers to lower case
+// report them in lower case; canonicalColumn restores the spelling.
+var systemEventsColumns = []string{
+	"ID", "CustomerID", "ReceivedAt", "DeviceReportedTime", "Facility", "Priority",
+	"FromHost", "Message", "NTSeverity", "Importance", "EventSource", "EventUser",
+	"EventCategory", "EventID", "EventBinaryData", "MaxAvailable", "CurrUsage",
+	"MinUsage", "MaxUsage", "InfoUnitID", "SysLogTag", "EventLogType",
+	"GenericFileName", "SystemID",
+}
+
+// canonicalColumn returns the canonical spelling of a SystemEvents column,
+// or name unchanged for columns outside the rsyslog schema.
+func canonicalColumn(name string) string {
+	for _, c := range systemEventsColumns {
+		if strings.EqualFold(c, name) {
+			return c
+		}
+	}
+	return name
+}
+
+// defaultIndexes are the indexes created on every dialect.
+var defaultIndexes = []index{
+	{"idx_receivedat", []string{"ReceivedAt"}, "CREATE INDEX IF NOT EXISTS idx_receivedat ON SystemEvents (ReceivedAt)"},
+	{"idx_host_time", []string{"FromHost", "ReceivedAt"}, "CREATE INDEX IF NOT EXISTS idx_host_time ON SystemEvents (FromHost, ReceivedAt)"},
+	{"idx_priority", []string{"Priority"}, "CREATE INDEX IF NOT EXISTS idx_priority ON SystemEvents (Priority)"},
+	{"idx_facility", []string{"Facility"}, "CREATE INDEX IF NOT EXISTS idx_facility ON SystemEvents (Facility)"},
+	{"idx_syslogtag", []string{"SysLogTag"}, "CREATE INDEX IF NOT EXISTS idx_syslogtag ON SystemEvents (SysLogTag)"},
+}
+
+// Query runs a query written with "?" placeholders in the dialect of db.
+func (db *DB) Query(query string, args ...interface{}) (*Rows, error) {
+	return db.QueryContext(context.Background(), query, args...)
+}
+
+// QueryRow runs a single-row query written with "?" placeholders.
+func (db *DB) QueryRow(query string, args ...interface{}) *Row {
+	return db.QueryRowContext(context.Background(), query, args...)
+}
+
+// Exec runs a statement written with "?" placeholders.
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.ExecContext(context.Background(), query, args...)
+}
+
+// QueryContext is Query for a request: ctx cancels the query and carries
+// the trace the query is recorded for (see querylog) and its class for the
+// query limits (see querylimit). The limit is held until the rows are closed.
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	release, err := db.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	rows, err := db.DB.QueryContext(ctx, db.Dialect.rebind(query), db.bindArgs(args)...)
+	if err != nil {
+		release()
+		db.record(ctx, query, start, 0, err)
+		return nil, err
+	}
+	return &Rows{Rows: rows, db: db, ctx: ctx, query: query, start: start, release: release}, nil
+}
+
+// QueryRowContext is QueryRow for a request. The limit is held until the
+// row is scanned.
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *Row {
+	release, err := db.acquire(ctx)
+	if err != nil {
+		return &Row{err: err}
+	}
+	start := time.Now()
+	row := db.DB.QueryRowContext(ctx, db.Dialect.rebind(query), db.bindArgs(args)...)
+	return &Row{Row: row, db: db, ctx: ctx, query: query, start: start, release: release}
+}
+
+// ExecContext is Exec for a request.
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	release, err := db.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	start := time.Now()
+	result, err := db.DB.ExecContext(ctx, db.Dialect.rebind(query), db.bindArgs(args)...)
+	var affected int64
+	if err == nil {
+		affected, _ = result.RowsAffected()
+	}
+	db.record(ctx, query, start, affected, err)
+	return result, err
+}
+
+// bindArgs converts args for the dialect without modifying the caller's slice.
+func (db *DB) bindArgs(args []interface{}) []interface{} {
+	out := make([]interface{}, len(args))
+	for i, a := range args {
+		out[i] = db.Dialect.bindArg(a)
+	}
+	return out
+}
+
+// ---- MySQL / MariaDB (rsyslog ommysql) ----
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string       { return config.DriverMySQL }
+func (mysqlDialect) driverName() string { return "mysql" }
+
+func (mysqlDialect) prepare(*sql.DB) error { return nil }
+
+func (mysqlDialect) rebind(query string) string        { return query }
+func (mysqlDialect) bindArg(v interface{}) interface{} { return v }
+func (mysqlDialect) scanTime(t time.Time) time.Time    { return t }
+
+// timeBucketFormat is the layout of the text returned by timeBucketExpr.
+const timeBucketFormat = "2006-01-02 15:04:05"
+
+// timeBucketExpr truncates the stored wall-clock time, which the driver
+// reads as local time (loc=Local).
+func (mysqlDialect) timeBucketExpr(unit string) (string, bool) {
+	layout := map[string]string{
+		"minute": "%Y-%m-%d %H:%i:00",
+		"hour":   "%Y-%m-%d %H:00:00",
+		"day":    "%Y-%m-%d 00:00:00",
+	}[unit]
+	return "DATE_FORMAT(ReceivedAt, '" + layout + "')", false
+}
+
+// SeverityExpr works for legacy (Priority = Severity) and modern
+// (Priority = Facility*8 + Severity) rows.
+func (mysqlDialect) SeverityExpr() string { return "Priority MOD 8" }
+
+// MessageSearch uses LIKE; the default collation makes it case-insensitive.
+func (mysqlDialect) MessageSearch(term string) (string, []interface{}) {
+	return "Message LIKE ?", []interface{}{"%" + term + "%"}
+}
+
+// programNameExpr strips the PID and trailing colon from SysLogTag:
+// "sshd[1234]:" → "sshd", "kernel:" → "kernel".
+func (mysqlDialect) programNameExpr() string {
+	return "TRIM(TRAILING ':' FROM SUBSTRING_INDEX(SysLogTag, '[', 1))"
+}
+
+// processIDExpr extracts the PID between the brackets of SysLogTag, or
+// NULL when the tag carries no numeric PID: "CRON[99]:" → 99, "kernel:" and
+// "app[main]:" → NULL.
+func (mysqlDialect) processIDExpr() string {
+	pid := "SUBSTRING_INDEX(SUBSTRING_INDEX(SysLogTag, '[', -1), ']', 1)"
+	return "CASE WHEN SysLogTag LIKE '%[%]%' AND " + pid + " REGEXP '^[0-9]{1,18}$' " +
+		"THEN CAST(" + pid + " AS UNSIGNED) END"
+}
+
+func (mysqlDialect) fieldFilterSQL(f fields.Filter) (string, []interface{}) {
+	return f.SQL()
+}
+
+// tableSizeQuery reads data and index size from the table statistics, which
+// InnoDB updates in the background; the value lags inserts and deletes.
+func (mysqlDialect) tableSizeQuery() string {
+	return `SELECT COALESCE(SUM(data_length + index_length), 0) FROM information_schema.TABLES
+		WHERE table_schema = DATABASE() AND table_name = 'SystemEvents'`
+}
+
+// dataFreeQuery reads the allocated but unused space of the table: deleted
+// rows stay in the InnoDB tablespace until the table is rebuilt.
+func (mysqlDialect) dataFreeQuery() string {
+	return `SELECT COALESCE(SUM(data_free), 0) FROM information_schema.TABLES
+		WHERE table_schema = DATABASE() AND table_name = 'SystemEvents'`
+}
+
+// reclaimQuery rebuilds the table online. OPTIMIZE TABLE maps to a rebuild
+// plus ANALYZE on InnoDB.
+func (mysqlDialect) reclaimQuery(rebuild bool) string {
+	if rebuild {
+		return "ALTER TABLE SystemEvents FORCE"
+	}
+	return "OPTIMIZE TABLE SystemEvents"
+}
+
+// indexes drops IF NOT EXISTS, which MySQL (unlike MariaDB) does not
+// support for CREATE INDEX; only missing indexes are created. Partitioned
+// InnoDB tables do not support FULLTEXT indexes.
+func (mysqlDialect) indexes(partitioned bool) []index {
+	result := make([]index, 0, len(defaultIndexes)+1)
+	for _, idx := range defaultIndexes {
+		idx.query = strings.Replace(idx.query, "IF NOT EXISTS ", "", 1)
+		result = append(result, idx)
+	}
+	if partitioned {
+		return result
+	}
+	return append(result, index{"fulltext", []string{"Message"}, "ALTER TABLE SystemEvents ADD FULLTEXT(Message)"})
+}
+
+// partitionsQuery counts the partitions of the table; 0 when it is not
+// partitioned.
+func (mysqlDialect) partitionsQuery() string {
+	return `SELECT COUNT(*) FROM information_schema.PARTITIONS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'SystemEvents' AND PARTITION_NAME IS NOT NULL`
+}
+
+// tableRowsQuery reads the row estimate of the table statistics.
+func (mysqlDialect) tableRowsQuery() string {
+	return `SELECT COALESCE(SUM(table_rows), 0) FROM information_schema.TABLES
+		WHERE table_schema = DATABASE() AND table_name = 'SystemEvents'`
+}
+
+// indexListQuery returns one row per index column: index name, column,
+// non-unique, type and cardinality (an estimate, NULL when unknown).
+func (mysqlDialect) indexListQuery() string {
+	return `SELECT INDEX_NAME, COLUMN_NAME, NON_UNIQUE, INDEX_TYPE, CARDINALITY
+		FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'SystemEvents'
+		ORDER BY INDEX_NAME, SEQ_IN_INDEX`
+}
+
+func (mysqlDialect) dropIndexQuery(name string) string {
+	return "DROP INDEX `" + name + "` ON SystemEvents"
+}
+
+func (mysqlDialect) versionQuery() string { return "SELECT VERSION()" }
+
+// explain runs EXPLAIN FORMAT=JSON. A table accessed with type ALL is
+// read completely; a filesort sorts the rows instead of reading them in
+// index order.
+func (mysqlDialect) explain(db *sql.DB, query string, args []interface{}) (json.RawMessage, []string, error) {
+	var plan string
+	if err := db.QueryRow("EXPLAIN FORMAT=JSON "+query, args...).Scan(&plan); err != nil {
+		return nil, nil, err
+	}
+	var hints []string
+	walkPlan(json.RawMessage(plan), func(node map[string]interface{}) {
+		if node["access_type"] == "ALL" {
+			hints = append(hints, fmt.Sprintf(hintFullScan, node["table_name"]))
+		}
+		if node["using_filesort"] == true {
+			hints = append(hints, hintSort)
+		}
+	})
+	return json.RawMessage(plan), hints, nil
+}
+
+// variablesQuery returns the server variables relevant to rsyslox.
+func (mysqlDialect) variablesQuery() string {
+	return `SHOW VARIABLES WHERE Variable_name IN (
+		'version_comment', 'max_connections', 'innodb_buffer_pool_size',
+		'innodb_file_per_table', 'innodb_ft_min_token_size', 'long_query_time', 'time_zone')`
+}
+
+func (mysqlDialect) columns(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("SHOW COLUMNS FROM SystemEvents")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := []string{}
+	for rows.Next() {
+		var field, colType, null, key, def, extra sql.NullString
+		if err := rows.Scan(&field, &colType, &null, &key, &def, &extra); err != nil {
+			log.Printf("Warning: failed to scan column info: %v", err)
+			continue
+		}
+		if field.Valid {
+			columns = append(columns, field.String)
+		}
+	}
+	return columns, rows.Err()
+}
@@ -0,0 +1,236 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	_ "github.com/lib/pq"
+	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/fields"
+)
+
+// messageTSVector is the text-search vector of Message. The GIN index and
+// MessageSearch must use the identical expression for the index to apply.
+const messageTSVector = "to_tsvector('simple', COALESCE(Message, ''))"
+
+// postgresDialect implements rsyslog's ompgsql schema. PostgreSQL folds the
+// unquoted identifiers of the shared queries to lower case, which matches
+// the table created by rsyslog's createDB.sql.
+type postgresDialect struct {
+	// localTimes is set when ReceivedAt is "timestamp without time zone":
+	// rsyslog stores local wall-clock time, which lib/pq returns as UTC.
+	localTimes bool
+}
+
+func (*postgresDialect) Name() string       { return config.DriverPostgres }
+func (*postgresDialect) driverName() string { return "postgres" }
+
+func (*postgresDialect) prepare(*sql.DB) error { return nil }
+
+// rebind replaces "?" placeholders with $1, $2, … outside string literals.
+func (*postgresDialect) rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	b.Grow(len(query) + 16)
+	n, inQuote := 0, false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			inQuote = !inQuote
+		case c == '?' && !inQuote:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// bindArg passes times as local wall-clock time, which is what a
+// "timestamp without time zone" column compares against.
+func (*postgresDialect) bindArg(v interface{}) interface{} {
+	if t, ok := v.(time.Time); ok {
+		return t.In(time.Local)
+	}
+	return v
+}
+
+func (d *postgresDialect) scanTime(t time.Time) time.Time {
+	if !d.localTimes {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(),
+		t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local)
+}
+
+// timeBucketExpr truncates local wall-clock times as text. A "timestamp
+// with time zone" would be truncated in the session's time zone, which need
+// not be the server's, so it is floored in Unix seconds instead; days then
+// come from hours.
+func (d *postgresDialect) timeBucketExpr(unit string) (string, bool) {
+	if d.localTimes {
+		return "to_char(date_trunc('" + unit + "', ReceivedAt), 'YYYY-MM-DD HH24:MI:SS')", false
+	}
+	step := "60"
+	if unit != "minute" {
+		step = "3600"
+	}
+	return "CAST(floor(extract(epoch FROM ReceivedAt) / " + step + ") * " + step + " AS BIGINT)", true
+}
+
+func (*postgresDialect) SeverityExpr() string { return "Priority % 8" }
+
+// MessageSearch uses the full-text index to pre-select messages containing
+// every word of term as a word prefix, and ILIKE for the exact,
+// case-insensitive substring match. Terms with characters other than letters,
+// digits and spaces (IP addresses, key=value, …) fall back to ILIKE alone,
+// since the text-search parser splits them differently.
+func (*postgresDialect) MessageSearch(term string) (string, []interface{}) {
+	like := "%" + term + "%"
+	words := strings.Fields(term)
+	if len(words) == 0 || strings.IndexFunc(term, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+	}) >= 0 {
+		return "Message ILIKE ?", []interface{}{like}
+	}
+	for i, w := range words {
+		words[i] = w + ":*"
+	}
+	return "(" + messageTSVector + " @@ to_tsquery('simple', ?) AND Message ILIKE ?)",
+		[]interface{}{strings.Join(words, " & "), like}
+}
+
+func (*postgresDialect) programNameExpr() string {
+	return "RTRIM(SPLIT_PART(SysLogTag, '[', 1), ':')"
+}
+
+// processIDExpr takes the digits of the last "[…]" group; NULL without one.
+func (*postgresDialect) processIDExpr() string {
+	return `CAST(SUBSTRING(SysLogTag FROM '\[([0-9]{1,18})\][^\[]*$') AS BIGINT)`
+}
+
+// fieldFilterSQL pre-selects with the regular expression only: messages are
+// not guaranteed to be valid JSON and a failing ::jsonb cast aborts the query.
+// The expression also matches "key": value inside JSON messages.
+func (*postgresDialect) fieldFilterSQL(f fields.Filter) (string, []interface{}) {
+	re := f.Regexp()
+	if re == "" {
+		return "", nil
+	}
+	return "Message ~ ?", []interface{}{re}
+}
+
+// tableSizeQuery includes indexes and TOAST data.
+func (*postgresDialect) tableSizeQuery() string {
+	return "SELECT pg_total_relation_size('systemevents')"
+}
+
+// dataFreeQuery reports no free space: PostgreSQL reuses dead tuples after
+// VACUUM, and measuring them needs the pgstattuple extension.
+func (*postgresDialect) dataFreeQuery() string {
+	return "SELECT 0"
+}
+
+// reclaimQuery rewrites the table; VACUUM FULL locks it exclusively.
+func (*postgresDialect) reclaimQuery(bool) string {
+	return "VACUUM FULL SystemEvents"
+}
+
+func (*postgresDialect) indexes(bool) []index {
+	return append(defaultIndexes[:len(defaultIndexes):len(defaultIndexes)],
+		index{"idx_message_fts", nil, "CREATE INDEX IF NOT EXISTS idx_message_fts ON SystemEvents USING GIN (" + messageTSVector + ")"})
+}
+
+// partitionsQuery is empty: the partition manager supports MySQL only.
+func (*postgresDialect) partitionsQuery() string { return "" }
+
+// tableRowsQuery reads the row estimate of the last ANALYZE.
+func (*postgresDialect) tableRowsQuery() string {
+	return "SELECT GREATEST(reltuples, 0)::bigint FROM pg_class WHERE oid = to_regclass('systemevents')"
+}
+
+// indexListQuery returns one row per index column, in the shape of
+// MySQL's information_schema.STATISTICS. Expression columns are returned
+// as their definition; cardinality is not available.
+func (*postgresDialect) indexListQuery() string {
+	return `SELECT i.relname, pg_get_indexdef(ix.indexrelid, k, true), NOT ix.indisunique,
+		       upper(am.amname), NULL::bigint
+		FROM pg_index ix
+		JOIN pg_class i ON i.oid = ix.indexrelid
+		JOIN pg_am am ON am.oid = i.relam
+		CROSS JOIN generate_series(1, ix.indnatts) AS k
+		WHERE ix.indrelid = to_regclass('systemevents')
+		ORDER BY i.relname, k`
+}
+
+func (*postgresDialect) dropIndexQuery(name string) string {
+	return "DROP INDEX IF EXISTS " + name
+}
+
+func (*postgresDialect) versionQuery() string { return "SHOW server_version" }
+
+// explain runs EXPLAIN (FORMAT JSON) without executing the query.
+func (*postgresDialect) explain(db *sql.DB, query string, args []interface{}) (json.RawMessage, []string, error) {
+	var plan string
+	if err := db.QueryRow("EXPLAIN (FORMAT JSON) "+query, args...).Scan(&plan); err != nil {
+		return nil, nil, err
+	}
+	var hints []string
+	walkPlan(json.RawMessage(plan), func(node map[string]interface{}) {
+		switch node["Node Type"] {
+		case "Seq Scan":
+			hints = append(hints, fmt.Sprintf(hintFullScan, node["Relation Name"]))
+		case "Sort":
+			hints = append(hints, hintSort)
+		}
+	})
+	return json.RawMessage(plan), hints, nil
+}
+
+func (*postgresDialect) variablesQuery() string {
+	return `SELECT name, current_setting(name) FROM pg_settings WHERE name IN (
+		'max_connections', 'shared_buffers', 'work_mem', 'effective_cache_size',
+		'random_page_cost', 'default_statistics_target', 'TimeZone')`
+}
+
+func (d *postgresDialect) columns(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT column_name, data_type FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'systemevents'
+		ORDER BY ordinal_position`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := []string{}
+	for rows.Next() {
+		var name, dataType string
+		if err := rows.Scan(&name, &dataType); err != nil {
+			continue
+		}
+		name = canonicalColumn(name)
+		if name == "ReceivedAt" {
+			d.localTimes = dataType == "timestamp without time zone"
+		}
+		columns = append(columns, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("table SystemEvents not found in the current schema")
+	}
+	return columns, nil
+}
@@ -0,0 +1,263 @@
+package database
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/fields"
+	"modernc.org/sqlite"
+)
+
+// sqliteTimeFormat is how rsyslog (omlibdbi) stores DATETIME values in
+// SQLite. Text in this format sorts chronologically.
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+// sqliteSchema is rsyslog's SystemEvents table, created when missing so an
+// empty file can be used as a target for rsyslog or an import.
+const sqliteSchema = `
+	CREATE TABLE IF NOT EXISTS SystemEvents (
+		ID                 INTEGER PRIMARY KEY AUTOINCREMENT,
+		CustomerID         BIGINT,
+		ReceivedAt         DATETIME,
+		DeviceReportedTime DATETIME,
+		Facility           SMALLINT,
+		Priority           SMALLINT,
+		FromHost           VARCHAR(60),
+		Message            TEXT,
+		NTSeverity         INT,
+		Importance         INT,
+		EventSource        VARCHAR(60),
+		EventUser          VARCHAR(60),
+		EventCategory      INT,
+		EventID            INT,
+		EventBinaryData    TEXT,
+		MaxAvailable       INT,
+		CurrUsage          INT,
+		MinUsage           INT,
+		MaxUsage           INT,
+		InfoUnitID         INT,
+		SysLogTag          VARCHAR(60),
+		EventLogType       VARCHAR(60),
+		GenericFileName    VARCHAR(60),
+		SystemID           INT
+	)`
+
+// sqliteRegexps caches the compiled patterns of the REGEXP function.
+var sqliteRegexps sync.Map // pattern → *regexp.Regexp
+
+func init() {
+	// SQLite parses "x REGEXP y" as regexp(y, x) but ships no implementation.
+	sqlite.MustRegisterDeterministicScalarFunction("regexp", 2,
+		func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			pattern, ok1 := args[0].(string)
+			text, ok2 := args[1].(string)
+			if !ok1 || !ok2 {
+				return false, nil
+			}
+			re, ok := sqliteRegexps.Load(pattern)
+			if !ok {
+				compiled, err := regexp.Compile(pattern)
+				if err != nil {
+					return nil, err
+				}
+				re, _ = sqliteRegexps.LoadOrStore(pattern, compiled)
+			}
+			return re.(*regexp.Regexp).MatchString(text), nil
+		})
+}
+
+// sqliteDialect reads a SystemEvents table in an SQLite file, as written by
+// rsyslog's omlibdbi or created by rsyslox.
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string       { return config.DriverSQLite }
+func (sqliteDialect) driverName() string { return "sqlite" }
+
+func (sqliteDialect) rebind(query string) string { return query }
+
+// bindArg passes times as local time text, so they compare correctly with
+// the DATETIME text stored by rsyslog.
+func (sqliteDialect) bindArg(v interface{}) interface{} {
+	if t, ok := v.(time.Time); ok {
+		return t.In(time.Local).Format(sqliteTimeFormat)
+	}
+	return v
+}
+
+// scanTime treats times without zone, which the driver returns as UTC, as
+// local wall-clock time.
+func (sqliteDialect) scanTime(t time.Time) time.Time {
+	if t.Location() != time.UTC {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(),
+		t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local)
+}
+
+// timeBucketExpr truncates the local time text stored by rsyslog.
+func (sqliteDialect) timeBucketExpr(unit string) (string, bool) {
+	layout := map[string]string{
+		"minute": "%Y-%m-%d %H:%M:00",
+		"hour":   "%Y-%m-%d %H:00:00",
+		"day":    "%Y-%m-%d 00:00:00",
+	}[unit]
+	return "strftime('" + layout + "', ReceivedAt)", false
+}
+
+func (sqliteDialect) SeverityExpr() string { return "Priority % 8" }
+
+// MessageSearch uses LIKE, which SQLite compares case-insensitively for ASCII.
+func (sqliteDialect) MessageSearch(term string) (string, []interface{}) {
+	return "Message LIKE ?", []interface{}{"%" + term + "%"}
+}
+
+func (sqliteDialect) programNameExpr() string {
+	return "RTRIM(CASE WHEN INSTR(SysLogTag, '[') > 0 " +
+		"THEN SUBSTR(SysLogTag, 1, INSTR(SysLogTag, '[') - 1) ELSE SysLogTag END, ':')"
+}
+
+// processIDExpr takes the first "[…]" group (SQLite has no reverse search);
+// tags carry at most one in practice. NULL unless it is all digits.
+func (sqliteDialect) processIDExpr() string {
+	pid := "SUBSTR(SysLogTag, INSTR(SysLogTag, '[') + 1, INSTR(SUBSTR(SysLogTag, INSTR(SysLogTag, '[') + 1), ']') - 1)"
+	return "CASE WHEN SysLogTag LIKE '%[%]%' AND " + pid + " GLOB '[0-9]*' AND " + pid + " NOT GLOB '*[^0-9]*' " +
+		"THEN CAST(" + pid + " AS INTEGER) END"
+}
+
+func (sqliteDialect) fieldFilterSQL(f fields.Filter) (string, []interface{}) {
+	re := f.Regexp()
+	if re == "" {
+		return "", nil
+	}
+	return "Message REGEXP ?", []interface{}{re}
+}
+
+// tableSizeQuery returns the used pages of the whole file: SQLite keeps
+// no per-table statistics without the optional dbstat table.
+func (sqliteDialect) tableSizeQuery() string {
+	return "SELECT (page_count - freelist_count) * page_size FROM pragma_page_count(), pragma_freelist_count(), pragma_page_size()"
+}
+
+// dataFreeQuery returns the free pages of the whole file.
+func (sqliteDialect) dataFreeQuery() string {
+	return "SELECT freelist_count * page_size FROM pragma_freelist_count(), pragma_page_size()"
+}
+
+// reclaimQuery rewrites the whole file.
+func (sqliteDialect) reclaimQuery(bool) string {
+	return "VACUUM"
+}
+
+func (sqliteDialect) indexes(bool) []index {
+	return defaultIndexes
+}
+
+// partitionsQuery is empty: SQLite has no partitions.
+func (sqliteDialect) partitionsQuery() string { return "" }
+
+// tableRowsQuery counts exactly; SQLite keeps no row estimate.
+func (sqliteDialect) tableRowsQuery() string {
+	return "SELECT COUNT(*) FROM SystemEvents"
+}
+
+// indexListQuery returns one row per index column, in the shape of
+// MySQL's information_schema.STATISTICS. Cardinality is not available.
+func (sqliteDialect) indexListQuery() string {
+	return `SELECT il.name, ii.name, NOT il."unique", 'BTREE', NULL
+		FROM pragma_index_list('SystemEvents') il, pragma_index_info(il.name) ii
+		ORDER BY il.name, ii.seqno`
+}
+
+func (sqliteDialect) dropIndexQuery(name string) string {
+	return "DROP INDEX IF EXISTS " + name
+}
+
+func (sqliteDialect) versionQuery() string { return "SELECT sqlite_version()" }
+
+// explain runs EXPLAIN QUERY PLAN and returns its rows as a JSON array.
+// "SCAN <table>" without an index reads the whole table; a temporary
+// B-tree for ORDER BY sorts the rows.
+func (sqliteDialect) explain(db *sql.DB, query string, args []interface{}) (json.RawMessage, []string, error) {
+	rows, err := db.Query("EXPLAIN QUERY PLAN "+query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	type step struct {
+		ID     int    `json:"id"`
+		Parent int    `json:"parent"`
+		Detail string `json:"detail"`
+	}
+	steps := []step{}
+	var hints []string
+	for rows.Next() {
+		var st step
+		var unused int
+		if err := rows.Scan(&st.ID, &st.Parent, &unused, &st.Detail); err != nil {
+			return nil, nil, err
+		}
+		steps = append(steps, st)
+		if table, ok := strings.CutPrefix(st.Detail, "SCAN "); ok && !strings.Contains(table, " USING ") {
+			hints = append(hints, fmt.Sprintf(hintFullScan, table))
+		}
+		if strings.HasPrefix(st.Detail, "USE TEMP B-TREE FOR ORDER BY") {
+			hints = append(hints, hintSort)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	plan, err := json.Marshal(steps)
+	return plan, hints, err
+}
+
+func (sqliteDialect) variablesQuery() string {
+	return `SELECT 'journal_mode', journal_mode FROM pragma_journal_mode()
+		UNION ALL SELECT 'page_size', page_size FROM pragma_page_size()
+		UNION ALL SELECT 'cache_size', cache_size FROM pragma_cache_size()
+		UNION ALL SELECT 'synchronous', synchronous FROM pragma_synchronous()
+		UNION ALL SELECT 'auto_vacuum', auto_vacuum FROM pragma_auto_vacuum()`
+}
+
+// prepare creates the SystemEvents table in a new file.
+func (sqliteDialect) prepare(db *sql.DB) error {
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		return fmt.Errorf("failed to create SystemEvents: %w", err)
+	}
+	return nil
+}
+
+func (sqliteDialect) columns(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("PRAGMA table_info(SystemEvents)")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := []string{}
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var def sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &def, &pk); err != nil {
+			continue
+		}
+		columns = append(columns, canonicalColumn(name))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("table SystemEvents not found")
+	}
+	return columns, nil
+}
@@ -0,0 +1,167 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/querylog"
+)
+
+// Hints added to a query plan by the dialects.
+const (
+	hintScanPrefix = "Full scan of "
+	hintFullScan   = hintScanPrefix + "%v: no index is used for this filter"
+	hintSort       = "Rows are sorted without an index: ORDER BY ReceivedAt cannot use an index for this filter"
+)
+
+// QueryPlan is the plan of one of the queries behind GET /api/logs.
+type QueryPlan struct {
+	Name  string          `json:"name"` // "data", "count" or "total"
+	SQL   string          `json:"sql"`
+	Args  []interface{}   `json:"args"`
+	Plan  json.RawMessage `json:"plan,omitempty"`
+	Hints []string        `json:"hints"`
+	Error string          `json:"error,omitempty"`
+}
+
+// LogsExplain is the plan of a log query on one source.
+type LogsExplain struct {
+	Source  string      `json:"source"`
+	Driver  string      `json:"driver,omitempty"`
+	Queries []QueryPlan `json:"queries,omitempty"`
+	Error   string      `json:"error,omitempty"` // source unreachable
+}
+
+// ExplainLogs returns the plans of the data, count and total queries that
+// StreamLogs runs on every source for the same arguments; match tells
+// whether StreamLogs is given a match function. The queries are not
+// executed.
+func (s *Sources) ExplainLogs(whereClause string, args []interface{}, limit, offset int, cursor *Cursor, match bool) ([]LogsExplain, error) {
+	if cursor != nil {
+		offset = 0
+		if _, ok := s.byName[cursor.Source]; !ok {
+			return nil, models.NewValidationError("cursor", "unknown source "+cursor.Source)
+		}
+	}
+	var fetch int
+	if match {
+		fetch, offset = maxFieldScan, 0
+	} else {
+		var err error
+		if fetch, _, offset, err = s.window(limit, offset); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]LogsExplain, len(s.list))
+	s.each(func(i int, src *Source, db *DB, err error) {
+		result[i].Source = src.label()
+		if err != nil {
+			result[i].Error = err.Error()
+			return
+		}
+		pageClause, pageArgs := s.pageClause(src, whereClause, args, cursor)
+		result[i].Driver = db.Dialect.Name()
+		result[i].Queries = db.explainPage(whereClause, args, pageClause, pageArgs, fetch, offset, !match)
+	})
+	return result, nil
+}
+
+// explainPage explains the queries of openPage.
+func (db *DB) explainPage(whereClause string, args []interface{}, pageClause string, pageArgs []interface{}, limit, offset int, count bool) []QueryPlan {
+	dataArgs := append(append(make([]interface{}, 0, len(pageArgs)+2), pageArgs...), limit, offset)
+	plans := []QueryPlan{db.explain("data", selectLogsQuery(pageClause, "ReceivedAt DESC, ID DESC"), dataArgs)}
+	if count {
+		plans = append(plans, db.explain("count", countLogsQuery(whereClause), args))
+	}
+	plans = append(plans, db.explain("total", totalCountQuery, nil))
+
+	// Point the scanning queries at the missing recommended indexes.
+	scans := make([]bool, len(plans))
+	anyScan := false
+	for i, p := range plans {
+		for _, h := range p.Hints {
+			scans[i] = scans[i] || strings.HasPrefix(h, hintScanPrefix)
+		}
+		anyScan = anyScan || scans[i]
+	}
+	if !anyScan {
+		return plans
+	}
+	existing, err := db.Indexes()
+	if err != nil {
+		return plans
+	}
+	var missing []string
+	for _, rec := range db.RecommendedIndexes(existing) {
+		if !rec.Exists {
+			missing = append(missing, rec.Name)
+		}
+	}
+	if len(missing) > 0 {
+		hint := fmt.Sprintf("Recommended indexes are missing: %s (create them with POST /api/admin/db/indexes)",
+			strings.Join(missing, ", "))
+		for i := range plans {
+			if scans[i] {
+				plans[i].Hints = append(plans[i].Hints, hint)
+			}
+		}
+	}
+	return plans
+}
+
+// explain returns the plan of query without executing it.
+func (db *DB) explain(name, query string, args []interface{}) QueryPlan {
+	query = db.Dialect.rebind(query)
+	p := QueryPlan{Name: name, SQL: querylog.CompactSQL(query), Args: args, Hints: []string{}}
+	if p.Args == nil {
+		p.Args = []interface{}{}
+	}
+	plan, hints, err := db.Dialect.explain(db.DB, query, db.bindArgs(args))
+	if err != nil {
+		p.Error = err.Error()
+		return p
+	}
+	p.Plan = plan
+	if hints != nil {
+		p.Hints = dedupe(hints)
+	}
+	return p
+}
+
+// walkPlan calls fn for every JSON object in plan.
+func walkPlan(plan json.RawMessage, fn func(node map[string]interface{})) {
+	var v interface{}
+	if json.Unmarshal(plan, &v) != nil {
+		return
+	}
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			fn(t)
+			for _, c := range t {
+				walk(c)
+			}
+		case []interface{}:
+			for _, c := range t {
+				walk(c)
+			}
+		}
+	}
+	walk(v)
+}
+
+func dedupe(list []string) []string {
+	seen := make(map[string]bool, len(list))
+	out := list[:0]
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+// maxOpenGaps bounds the missing IDs an IDGaps waits for; the lowest are
+// given up first. Gaps near the end of the table are few, but a reader
+// passing deleted rows finds many.
+const maxOpenGaps = 500
+
+// IDGaps remembers the IDs that a reader following SystemEvents by ID has
+// passed without seeing a row. An ID is assigned when a row is inserted,
+// but the row only becomes visible when its transaction commits, so a row
+// can appear below IDs that were already read. Each missing ID is checked
+// again until it is older than the wait; then it is taken for a rolled-back
+// insert or a deleted row. The zero value is not usable; see NewIDGaps.
+type IDGaps struct {
+	wait time.Duration
+	open map[int]time.Time // missing ID → when it was passed
+}
+
+// NewIDGaps creates an IDGaps that waits wait for every missing ID.
+func NewIDGaps(wait time.Duration) *IDGaps {
+	return &IDGaps{wait: wait, open: make(map[int]time.Time)}
+}
+
+// Pass records the IDs in (after, upTo] that are not in ids as missing.
+func (g *IDGaps) Pass(after, upTo int, ids []int) {
+	present := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		present[id] = true
+	}
+	now := time.Now()
+	// From the top: a long run of deleted rows only adds its last IDs.
+	added := 0
+	for id := upTo; id > after && added < maxOpenGaps; id-- {
+		if !present[id] {
+			g.open[id] = now
+			added++
+		}
+	}
+	if len(g.open) > maxOpenGaps {
+		open := g.sorted()
+		for _, id := range open[:len(open)-maxOpenGaps] {
+			delete(g.open, id)
+		}
+	}
+}
+
+// Open returns the missing IDs that are still waited for, in ascending
+// order, and forgets those older than the wait.
+func (g *IDGaps) Open() []int {
+	for id, passed := range g.open {
+		if time.Since(passed) > g.wait {
+			delete(g.open, id)
+		}
+	}
+	return g.sorted()
+}
+
+// Missing reports whether id is waited for.
+func (g *IDGaps) Missing(id int) bool {
+	_, ok := g.open[id]
+	return ok
+}
+
+// Found removes ids that appeared.
+func (g *IDGaps) Found(ids []int) {
+	for _, id := range ids {
+		delete(g.open, id)
+	}
+}
+
+// Reset forgets all missing IDs.
+func (g *IDGaps) Reset() {
+	g.open = make(map[int]time.Time)
+}
+
+func (g *IDGaps) sorted() []int {
+	ids := make([]int, 0, len(g.open))
+	for id := range g.open {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
@@ -1,46 +1,293 @@
 package database
 
-import "log"
-
-// createIndexes creates necessary database indexes for optimal query performance
-func (db *DB) createIndexes() error {
-	indexes := []struct {
-		name  string
-		query string
-	}{
-		{
-			name:  "idx_receivedat",
-			query: "CREATE INDEX IF NOT EXISTS idx_receivedat ON SystemEvents (ReceivedAt)",
-		},
-		{
-			name:  "idx_host_time",
-			query: "CREATE INDEX IF NOT EXISTS idx_host_time ON SystemEvents (FromHost, ReceivedAt)",
-		},
-		{
-			name:  "idx_priority",
-			query: "CREATE INDEX IF NOT EXISTS idx_priority ON SystemEvents (Priority)",
-		},
-		{
-			name:  "idx_facility",
-			query: "CREATE INDEX IF NOT EXISTS idx_facility ON SystemEvents (Facility)",
-		},
-		{
-			name:  "idx_syslogtag",
-			query: "CREATE INDEX IF NOT EXISTS idx_syslogtag ON SystemEvents (SysLogTag)",
-		},
-	}
-
-	for _, idx := range indexes {
-		if _, err := db.Exec(idx.query); err != nil {
-			log.Printf("Index creation info (%s): %v", idx.name, err)
-		}
-	}
-
-	// Try to create fulltext index (may fail if already exists)
-	if _, err := db.Exec("ALTER TABLE SystemEvents ADD FULLTEXT(Message)"); err != nil {
-		log.Printf("Fulltext index info: %v", err)
-	}
-
-	log.Println("✓ Database indexes created/verified")
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Index job actions.
+const (
+	IndexActionCreate = "create"
+	IndexActionDrop   = "drop"
+)
+
+var (
+	// ErrIndexJobRunning is returned by StartIndexJob while a job runs.
+	ErrIndexJobRunning = errors.New("an index job is already running")
+	// ErrUnknownIndex is returned by StartIndexJob for a name that is not
+	// a recommended index.
+	ErrUnknownIndex = errors.New("unknown index")
+)
+
+// IndexInfo is an index of SystemEvents as reported by the database.
+type IndexInfo struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Type    string   `json:"type"`
+	Unique  bool     `json:"unique"`
+	// Cardinality is the estimated number of distinct values (MySQL only).
+	Cardinality *int64 `json:"cardinality,omitempty"`
+}
+
+// RecommendedIndex is one of the indexes rsyslox creates, and whether an
+// index satisfying it exists.
+type RecommendedIndex struct {
+	Name        string   `json:"name"`
+	Columns     []string `json:"columns,omitempty"`
+	Exists      bool     `json:"exists"`
+	Index       string   `json:"index,omitempty"` // existing index satisfying it
+	Cardinality *int64   `json:"cardinality,omitempty"`
+}
+
+// IndexJob is the state of a background job creating or dropping indexes.
+type IndexJob struct {
+	Action     string            `json:"action"`
+	Indexes    []string          `json:"indexes"`
+	Running    bool              `json:"running"`
+	Current    string            `json:"current,omitempty"`
+	Done       []string          `json:"done"`
+	Failed     map[string]string `json:"failed,omitempty"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+}
+
+// Indexes lists the indexes of SystemEvents.
+func (db *DB) Indexes() ([]IndexInfo, error) {
+	rows, err := db.DB.Query(db.Dialect.indexListQuery())
+	if err != nil {
+		return nil, fmt.Errorf("index list query failed: %v", err)
+	}
+	defer rows.Close()
+
+	var list []IndexInfo
+	for rows.Next() {
+		var (
+			name, column, typ string
+			nonUnique         bool
+			cardinality       sql.NullInt64
+		)
+		if err := rows.Scan(&name, &column, &nonUnique, &typ, &cardinality); err != nil {
+			return nil, fmt.Errorf("index list query failed: %v", err)
+		}
+		if len(list) == 0 || list[len(list)-1].Name != name {
+			list = append(list, IndexInfo{Name: name, Type: typ, Unique: !nonUnique})
+		}
+		idx := &list[len(list)-1]
+		idx.Columns = append(idx.Columns, column)
+		// MySQL reports the cardinality of each column prefix; the
+		// largest is that of the whole index.
+		if cardinality.Valid && (idx.Cardinality == nil || cardinality.Int64 > *idx.Cardinality) {
+			c := cardinality.Int64
+			idx.Cardinality = &c
+		}
+	}
+	return list, rows.Err()
+}
+
+// RecommendedIndexes reports which of the dialect's indexes exist.
+// existing is the result of Indexes.
+func (db *DB) RecommendedIndexes(existing []IndexInfo) []RecommendedIndex {
+	recommended := db.recommended()
+	result := make([]RecommendedIndex, 0, len(recommended))
+	for _, rec := range recommended {
+		r := RecommendedIndex{Name: rec.name, Columns: rec.columns}
+		if idx := satisfying(rec, existing); idx != nil {
+			r.Exists = true
+			r.Index = idx.Name
+			r.Cardinality = idx.Cardinality
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+// recommended returns the dialect's indexes for the current table, which
+// may have been partitioned since the start. When the partitions cannot be
+// read, the table is taken as not partitioned.
+func (db *DB) recommended() []index {
+	var n int
+	if query := db.Dialect.partitionsQuery(); query != "" {
+		if err := db.QueryRow(query).Scan(&n); err != nil {
+			log.Printf("⚠️  Reading partitions of SystemEvents: %v", err)
+		}
+	}
+	return db.Dialect.indexes(n > 0)
+}
+
+// satisfying returns the existing index with the name or the columns of
+// rec, or nil.
+func satisfying(rec index, existing []IndexInfo) *IndexInfo {
+	for i := range existing {
+		if strings.EqualFold(existing[i].Name, rec.name) {
+			return &existing[i]
+		}
+	}
+	if rec.columns == nil {
+		return nil
+	}
+	for i := range existing {
+		if sameColumns(existing[i].Columns, rec.columns) {
+			return &existing[i]
+		}
+	}
 	return nil
 }
+
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// createIndexes creates the missing recommended indexes in the background,
+// so that large tables do not delay startup. The progress is reported by
+// IndexJob.
+func (db *DB) createIndexes() {
+	job, err := db.StartIndexJob(IndexActionCreate, nil)
+	if err != nil {
+		log.Printf("Index creation info: %v", err)
+		return
+	}
+	if len(job.Indexes) == 0 {
+		log.Println("✓ Database indexes verified")
+		return
+	}
+	log.Printf("✓ Creating database indexes in the background: %s", strings.Join(job.Indexes, ", "))
+}
+
+// IndexJob returns the state of the current or last index job, or nil.
+func (db *DB) IndexJob() *IndexJob {
+	db.indexMu.Lock()
+	defer db.indexMu.Unlock()
+	if db.indexJob == nil {
+		return nil
+	}
+	return db.indexJob.snapshot()
+}
+
+// StartIndexJob creates or drops recommended indexes in the background.
+// With no names, create means all missing recommended indexes; drop
+// requires names. Indexes that are already present (create) or absent
+// (drop) are skipped. It returns the state of the started job.
+func (db *DB) StartIndexJob(action string, names []string) (*IndexJob, error) {
+	if action != IndexActionCreate && action != IndexActionDrop {
+		return nil, fmt.Errorf("unknown action %q (allowed: %s, %s)", action, IndexActionCreate, IndexActionDrop)
+	}
+	if action == IndexActionDrop && len(names) == 0 {
+		return nil, errors.New("drop requires the names of the indexes")
+	}
+
+	recommended := db.recommended()
+	byName := make(map[string]index)
+	for _, rec := range recommended {
+		byName[rec.name] = rec
+	}
+	var selected []index
+	if len(names) == 0 {
+		selected = recommended
+	}
+	for _, name := range names {
+		rec, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownIndex, name)
+		}
+		selected = append(selected, rec)
+	}
+
+	// Without the list of existing indexes, create tries every statement
+	// and logs the failures, as before the list was available.
+	existing, err := db.Indexes()
+	if err != nil && action == IndexActionDrop {
+		return nil, err
+	}
+
+	db.indexMu.Lock()
+	defer db.indexMu.Unlock()
+	if db.indexJob != nil && db.indexJob.Running {
+		return nil, ErrIndexJobRunning
+	}
+
+	var statements []index
+	for _, rec := range selected {
+		idx := satisfying(rec, existing)
+		switch {
+		case action == IndexActionCreate && (err != nil || idx == nil):
+			statements = append(statements, rec)
+		case action == IndexActionDrop && idx != nil:
+			statements = append(statements, index{name: rec.name, query: db.Dialect.dropIndexQuery(idx.Name)})
+		}
+	}
+
+	job := &IndexJob{Action: action, Indexes: []string{}, Done: []string{}, StartedAt: time.Now()}
+	for _, stmt := range statements {
+		job.Indexes = append(job.Indexes, stmt.name)
+	}
+	if len(statements) == 0 {
+		job.FinishedAt = &job.StartedAt
+	} else {
+		job.Running = true
+		go db.runIndexJob(job, statements)
+	}
+	db.indexJob = job
+	return job.snapshot(), nil
+}
+
+// runIndexJob executes the statements one by one; a failure does not stop
+// the others.
+func (db *DB) runIndexJob(job *IndexJob, statements []index) {
+	for _, stmt := range statements {
+		db.indexMu.Lock()
+		job.Current = stmt.name
+		db.indexMu.Unlock()
+
+		start := time.Now()
+		_, err := db.Exec(stmt.query)
+
+		db.indexMu.Lock()
+		if err != nil {
+			if job.Failed == nil {
+				job.Failed = make(map[string]string)
+			}
+			job.Failed[stmt.name] = err.Error()
+		} else {
+			job.Done = append(job.Done, stmt.name)
+		}
+		db.indexMu.Unlock()
+
+		if err != nil {
+			log.Printf("Index %s info (%s): %v", job.Action, stmt.name, err)
+		} else {
+			log.Printf("✓ Index %s: %s (%s)", job.Action, stmt.name, time.Since(start).Round(time.Millisecond))
+		}
+	}
+
+	db.indexMu.Lock()
+	now := time.Now()
+	job.Running = false
+	job.Current = ""
+	job.FinishedAt = &now
+	db.indexMu.Unlock()
+}
+
+func (j *IndexJob) snapshot() *IndexJob {
+	c := *j
+	c.Indexes = append([]string{}, j.Indexes...)
+	c.Done = append([]string{}, j.Done...)
+	if j.Failed != nil {
+		c.Failed = make(map[string]string, len(j.Failed))
+		for k, v := range j.Failed {
+			c.Failed[k] = v
+		}
+	}
+	return &c
+}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/syslog"
+)
+
+// insertBatchSize is the number of rows per INSERT statement; it keeps the
+// placeholder count well below the limits of all drivers.
+const insertBatchSize = 500
+
+// insertColumns are the SystemEvents columns written by InsertEvents, the
+// same set rsyslog's ommysql template fills.
+const insertColumns = "ReceivedAt, DeviceReportedTime, Facility, Priority, FromHost, Message, InfoUnitID, SysLogTag"
+
+// InsertEvents writes messages to SystemEvents in one transaction.
+// Priority is stored in the format the table already uses (see PriorityMode),
+// so rows written by rsyslox look like rows written by rsyslog.
+func (db *DB) InsertEvents(msgs []syslog.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin insert: %w", err)
+	}
+	defer tx.Rollback()
+
+	for start := 0; start < len(msgs); start += insertBatchSize {
+		batch := msgs[start:min(start+insertBatchSize, len(msgs))]
+
+		placeholders := make([]string, len(batch))
+		args := make([]interface{}, 0, len(batch)*8)
+		for i, m := range batch {
+			placeholders[i] = "(?, ?, ?, ?, ?, ?, ?, ?)"
+			args = append(args, m.ReceivedAt, m.DeviceReportedTime, m.Facility,
+				db.storedPriority(m.Facility, m.Severity), m.FromHost, m.Message, 1, m.SysLogTag)
+		}
+		query := "INSERT INTO SystemEvents (" + insertColumns + ") VALUES " +
+			strings.Join(placeholders, ", ")
+		if _, err := tx.Exec(db.Dialect.rebind(query), db.bindArgs(args)...); err != nil {
+			return fmt.Errorf("failed to insert events: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit events: %w", err)
+	}
+	return nil
+}
+
+// restoreColumns are all stored SystemEvents columns, written by
+// RestoreEntries.
+var restoreColumns = []string{
+	"ID", "CustomerID", "ReceivedAt", "DeviceReportedTime", "Facility", "Priority",
+	"FromHost", "Message", "NTSeverity", "Importance", "EventSource", "EventUser",
+	"EventCategory", "EventID", "EventBinaryData", "MaxAvailable", "CurrUsage",
+	"MinUsage", "MaxUsage", "InfoUnitID", "SysLogTag", "EventLogType",
+	"GenericFileName", "SystemID",
+}
+
+// restoreBatchSize keeps RestoreEntries below the placeholder limits.
+const restoreBatchSize = 200
+
+// RestoreEntries writes previously deleted rows back to SystemEvents with
+// their original IDs and column values, in one transaction. Priority is
+// stored in the format the table uses, as by InsertEvents, since the entries
+// were read with the RFC value. Rows whose ID already exists are skipped.
+// Returns the number of rows written.
+func (db *DB) RestoreEntries(entries []models.LogEntry) (int, error) {
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin restore: %w", err)
+	}
+	defer tx.Rollback()
+
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(restoreColumns)), ", ") + ")"
+	restored := 0
+	for start := 0; start < len(entries); start += restoreBatchSize {
+		batch := entries[start:min(start+restoreBatchSize, len(entries))]
+
+		// Skip IDs that are still (or again) present.
+		ids := make([]interface{}, len(batch))
+		for i, e := range batch {
+			ids[i] = e.ID
+		}
+		query := "SELECT ID FROM SystemEvents WHERE ID IN (" +
+			strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",") + ")"
+		rows, err := tx.Query(db.Dialect.rebind(query), db.bindArgs(ids)...)
+		if err != nil {
+			return 0, fmt.Errorf("failed to check existing rows: %w", err)
+		}
+		existing := make(map[int]bool)
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err == nil {
+				existing[id] = true
+			}
+		}
+		rows.Close()
+
+		placeholders := make([]string, 0, len(batch))
+		args := make([]interface{}, 0, len(batch)*len(restoreColumns))
+		for _, e := range batch {
+			if existing[e.ID] {
+				continue
+			}
+			existing[e.ID] = true // duplicates within the archive
+			placeholders = append(placeholders, row)
+			args = append(args, e.ID, e.CustomerID, e.ReceivedAt, timeArg(e.DeviceReportedTime),
+				e.Facility, db.storedPriority(e.Facility, e.Severity), e.FromHost, e.Message,
+				e.NTSeverity, e.Importance, e.EventSource, e.EventUser, e.EventCategory,
+				e.EventID, e.EventBinaryData,
+				e.MaxAvailable, e.CurrUsage, e.MinUsage, e.MaxUsage, e.InfoUnitID,
+				e.SysLogTag, e.EventLogType, e.GenericFileName, e.SystemID)
+		}
+		if len(placeholders) == 0 {
+			continue
+		}
+		query = "INSERT INTO SystemEvents (" + strings.Join(restoreColumns, ", ") + ") VALUES " +
+			strings.Join(placeholders, ", ")
+		if _, err := tx.Exec(db.Dialect.rebind(query), db.bindArgs(args)...); err != nil {
+			return 0, fmt.Errorf("failed to restore rows: %w", err)
+		}
+		restored += len(placeholders)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit restore: %w", err)
+	}
+	return restored, nil
+}
+
+// timeArg dereferences a nullable time so bindArg can convert it.
+func timeArg(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return *t
+}
+
+// storedPriority returns the Priority column value for facility and severity.
+func (db *DB) storedPriority(facility, severity int) int {
+	if db.PriorityMode == PriorityModeLegacy {
+		return severity
+	}
+	return facility*8 + severity
+}
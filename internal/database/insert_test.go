@@ -0,0 +1,58 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/syslog"
+)
+
+// Restored rows keep the Priority format of a legacy table (Priority =
+// Severity), although they were read with the RFC value.
+func TestRestoreEntriesLegacyPriority(t *testing.T) {
+	db, err := Connect(&config.Config{},
+		config.DatabaseConfig{Driver: config.DriverSQLite, Path: filepath.Join(t.TempDir(), "logs.db")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if db.PriorityMode != PriorityModeLegacy {
+		t.Fatalf("empty table: priority mode %s, want legacy", db.PriorityMode)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	msgs := []syslog.Message{
+		{ReceivedAt: now.Add(-2 * time.Hour), DeviceReportedTime: now, Facility: 4, Severity: 3, FromHost: "a", Message: "old"},
+		{ReceivedAt: now, DeviceReportedTime: now, Facility: 3, Severity: 6, FromHost: "b", Message: "new"},
+	}
+	if err := db.InsertEvents(msgs); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := db.QueryLogs("FromHost = ?", []interface{}{"a"}, 10, 0)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("QueryLogs = %v, %v", entries, err)
+	}
+	if e := entries[0]; e.Priority != 35 || e.Severity != 3 || e.Facility != 4 {
+		t.Fatalf("read Priority %d, Severity %d, Facility %d, want 35, 3, 4", e.Priority, e.Severity, e.Facility)
+	}
+	if _, err := db.Exec("DELETE FROM SystemEvents WHERE ID = ?", entries[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := db.RestoreEntries(entries)
+	if err != nil || n != 1 {
+		t.Fatalf("RestoreEntries = %d, %v", n, err)
+	}
+	var stored int
+	if err := db.QueryRow("SELECT Priority FROM SystemEvents WHERE ID = ?", entries[0].ID).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored != 3 {
+		t.Errorf("restored Priority = %d, want 3", stored)
+	}
+	if mode := db.detectPriorityMode(); mode != PriorityModeLegacy {
+		t.Errorf("priority mode after restore: %s, want legacy", mode)
+	}
+}
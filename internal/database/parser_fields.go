@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/phil-bot/rsyslox/internal/fields"
+	"github.com/phil-bot/rsyslox/internal/models"
+)
+
+// fieldSampleRows caps the number of recent messages scanned to collect the
+// distinct values of a parser field.
+const fieldSampleRows = 10000
+
+// fieldValueLimit caps the number of distinct values returned for a field.
+const fieldValueLimit = 1000
+
+// FieldColumns returns the parser fields as "field.<name>" column names.
+func (db *DB) FieldColumns() []string {
+	seen := map[string]bool{}
+	cols := []string{}
+	for _, fi := range db.Fields.Fields() {
+		if !seen[fi.Name] {
+			seen[fi.Name] = true
+			cols = append(cols, fields.QueryPrefix+fi.Name)
+		}
+	}
+	return cols
+}
+
+// FieldFilterSQL returns the SQL pre-selection for a field filter.
+// Fields produced by a configured parser cannot be found with the generic
+// REGEXP, so the rows of the parser's program are always included; the
+// exact match happens after extraction.
+func (db *DB) FieldFilterSQL(f fields.Filter) (string, []interface{}) {
+	cond, args := db.Dialect.fieldFilterSQL(f)
+	tags := db.Fields.TagsForField(f.Key)
+	if cond == "" || len(tags) == 0 {
+		return cond, args
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(tags)), ",")
+	tagCond := fmt.Sprintf("%s IN (%s)", db.ColumnExpr("ProgramName"), placeholders)
+	combined := make([]interface{}, 0, len(args)+len(tags))
+	combined = append(combined, args...)
+	for _, t := range tags {
+		combined = append(combined, t)
+	}
+	return "(" + cond + " OR " + tagCond + ")", combined
+}
+
+// queryDistinctFieldValues collects the distinct values of a parser field
+// from the most recent matching messages of the parser's programs.
+func (db *DB) queryDistinctFieldValues(ctx context.Context, name, whereClause string, args []interface{}) (interface{}, error) {
+	tags := db.Fields.TagsForField(name)
+	if len(tags) == 0 {
+		return []string{}, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(tags)), ",")
+	query := fmt.Sprintf(
+		"SELECT SysLogTag, Message FROM SystemEvents WHERE %s AND %s IN (%s) ORDER BY ReceivedAt DESC LIMIT %d",
+		whereClause, db.ColumnExpr("ProgramName"), placeholders, fieldSampleRows,
+	)
+	queryArgs := make([]interface{}, 0, len(args)+len(tags))
+	queryArgs = append(queryArgs, args...)
+	for _, t := range tags {
+		queryArgs = append(queryArgs, t)
+	}
+
+	rows, err := db.QueryContext(ctx, query, queryArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("field meta query failed: %w", err)
+	}
+	defer rows.Close()
+
+	seen := map[string]bool{}
+	values := []string{}
+	for rows.Next() && len(values) < fieldValueLimit {
+		var tag, msg string
+		if err := rows.Scan(&tag, &msg); err != nil {
+			continue
+		}
+		program, _ := models.ParseSysLogTag(tag)
+		v, ok := db.Fields.Extract(program, msg)[name]
+		if !ok {
+			continue
+		}
+		s := fmt.Sprint(v)
+		if !seen[s] {
+			seen[s] = true
+			values = append(values, s)
+		}
+	}
+	sort.Strings(values)
+	return values, nil
+}
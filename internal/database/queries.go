@@ -1,22 +1,86 @@
 package database
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/phil-bot/rsyslox/internal/fields"
 	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/querylimit"
 )
 
 // QueryLogs executes a paginated log query with the given WHERE clause and args.
 // A copy of args is made internally so the caller's slice is never mutated.
 func (db *DB) QueryLogs(whereClause string, args []interface{}, limit, offset int) ([]models.LogEntry, error) {
-	return db.queryLogsRaw(whereClause, args, limit, offset)
+	return db.queryLogsRaw(context.Background(), whereClause, args, limit, offset)
 }
 
 // queryLogsRaw executes the SELECT without mutating the caller's args slice.
-func (db *DB) queryLogsRaw(whereClause string, args []interface{}, limit, offset int) ([]models.LogEntry, error) {
-	query := fmt.Sprintf(`
+func (db *DB) queryLogsRaw(ctx context.Context, whereClause string, args []interface{}, limit, offset int) ([]models.LogEntry, error) {
+	return db.selectLogs(ctx, whereClause, args, "ReceivedAt DESC, ID DESC", limit, offset)
+}
+
+// QueryAfterID returns up to limit entries with an ID in (afterID, upToID]
+// that match the WHERE clause, in insertion (ID) order. Used to follow new
+// rows, together with IDsAfter and IDGaps.
+func (db *DB) QueryAfterID(whereClause string, args []interface{}, afterID, upToID, limit int) ([]models.LogEntry, error) {
+	queryArgs := make([]interface{}, 0, len(args)+2)
+	queryArgs = append(queryArgs, afterID, upToID)
+	queryArgs = append(queryArgs, args...)
+	return db.selectLogs(context.Background(), "ID > ? AND ID <= ? AND ("+whereClause+")", queryArgs, "ID ASC", limit, 0)
+}
+
+// QueryIDs returns the entries with one of ids that match the WHERE
+// clause, in ID order. Used to read rows that committed late (see IDGaps).
+func (db *DB) QueryIDs(whereClause string, args []interface{}, ids []int) ([]models.LogEntry, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	queryArgs := make([]interface{}, 0, len(ids)+len(args))
+	for _, id := range ids {
+		queryArgs = append(queryArgs, id)
+	}
+	queryArgs = append(queryArgs, args...)
+	in := "ID IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+	return db.selectLogs(context.Background(), in+" AND ("+whereClause+")", queryArgs, "ID ASC", len(ids), 0)
+}
+
+// IDsAfter returns up to limit IDs above afterID in ascending order,
+// without a filter, so that a reader can tell the IDs that have no row.
+func (db *DB) IDsAfter(afterID, limit int) ([]int, error) {
+	rows, err := db.Query("SELECT ID FROM SystemEvents WHERE ID > ? ORDER BY ID LIMIT ?", afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ID query failed: %w", err)
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("ID scan failed: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// MaxID returns the highest ID in SystemEvents, or 0 for an empty table.
+func (db *DB) MaxID() (int, error) {
+	var id *int
+	if err := db.QueryRow("SELECT MAX(ID) FROM SystemEvents").Scan(&id); err != nil || id == nil {
+		return 0, err
+	}
+	return *id, nil
+}
+
+// selectLogsQuery is the SELECT of selectLogs; limit and offset are the
+// last two placeholders.
+func selectLogsQuery(whereClause, orderBy string) string {
+	return fmt.Sprintf(`
 		SELECT ID, CustomerID, ReceivedAt, DeviceReportedTime, Facility, Priority,
 		       FromHost, Message, NTSeverity, Importance, EventSource, EventUser,
 		       EventCategory, EventID, EventBinaryData, MaxAvailable, CurrUsage,
@@ -24,76 +88,249 @@ func (db *DB) queryLogsRaw(whereClause string, args []interface{}, limit, offset
 		       GenericFileName, SystemID
 		FROM SystemEvents
 		WHERE %s
-		ORDER BY ReceivedAt DESC
+		ORDER BY %s
 		LIMIT ? OFFSET ?
-	`, whereClause)
-
-	// Build a fresh slice — do not append to the caller's args.
-	queryArgs := make([]interface{}, len(args)+2)
-	copy(queryArgs, args)
-	queryArgs[len(args)] = limit
-	queryArgs[len(args)+1] = offset
+	`, whereClause, orderBy)
+}
 
-	rows, err := db.Query(query, queryArgs...)
+// selectLogs selects full entries in the given order.
+func (db *DB) selectLogs(ctx context.Context, whereClause string, args []interface{}, orderBy string, limit, offset int) ([]models.LogEntry, error) {
+	rows, err := db.openLogs(ctx, whereClause, args, orderBy, limit, offset)
 	if err != nil {
-		return nil, fmt.Errorf("query failed: %v", err)
+		return nil, err
 	}
-	defer rows.Close()
+	return collectLogs(rows)
+}
 
+// collectLogs reads and closes rows. Rows that fail to scan are logged and
+// left out.
+func collectLogs(rows *LogRows) ([]models.LogEntry, error) {
+	defer rows.Close()
 	entries := []models.LogEntry{}
 	for rows.Next() {
-		var entry models.LogEntry
-		if err := entry.ScanFromRows(rows); err != nil {
-			continue
-		}
-		entries = append(entries, entry)
+		entries = append(entries, rows.Entry())
+	}
+	if msg := rows.Skipped(); msg != "" {
+		log.Printf("⚠️  Log query: %s", msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
 	}
-
 	return entries, nil
 }
 
 // CountLogs counts the total number of rows matching the given WHERE clause.
-func (db *DB) CountLogs(whereClause string, args []interface{}) (int, error) {
-	query := fmt.Sprintf("SELECT COUNT(*) FROM SystemEvents WHERE %s", whereClause)
+func (db *DB) CountLogs(ctx context.Context, whereClause string, args []interface{}) (int, error) {
 	var total int
-	if err := db.QueryRow(query, args...).Scan(&total); err != nil {
-		return 0, fmt.Errorf("count query failed: %v", err)
+	ctx = querylimit.WithClass(ctx, querylimit.Count)
+	if err := db.QueryRowContext(ctx, countLogsQuery(whereClause), args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("count query failed: %w", err)
 	}
 	return total, nil
 }
 
+func countLogsQuery(whereClause string) string {
+	return fmt.Sprintf("SELECT COUNT(*) FROM SystemEvents WHERE %s", whereClause)
+}
+
+// totalCountQuery counts all rows of SystemEvents.
+const totalCountQuery = "SELECT COUNT(*) FROM SystemEvents"
+
 // TotalCount returns the total number of rows in SystemEvents (no filter applied).
-func (db *DB) TotalCount() (int, error) {
+// It is a lookup for the query limits unless ctx says otherwise, so that
+// GET /api/meta is not held up by searches.
+func (db *DB) TotalCount(ctx context.Context) (int, error) {
 	var total int
-	if err := db.QueryRow("SELECT COUNT(*) FROM SystemEvents").Scan(&total); err != nil {
-		return 0, fmt.Errorf("total count query failed: %v", err)
+	if err := db.QueryRowContext(ctx, totalCountQuery).Scan(&total); err != nil {
+		return 0, fmt.Errorf("total count query failed: %w", err)
 	}
 	return total, nil
 }
 
+// TableSize returns the size of SystemEvents including its indexes, in
+// bytes, as reported by the database.
+func (db *DB) TableSize() (int64, error) {
+	var size int64
+	if err := db.QueryRow(db.Dialect.tableSizeQuery()).Scan(&size); err != nil {
+		return 0, fmt.Errorf("table size query failed: %v", err)
+	}
+	return size, nil
+}
+
+// DataFree returns the space allocated to SystemEvents but not used by rows,
+// in bytes. Deleting rows grows it; the space is returned to the filesystem
+// only by ReclaimSpace.
+func (db *DB) DataFree() (int64, error) {
+	var free int64
+	if err := db.QueryRow(db.Dialect.dataFreeQuery()).Scan(&free); err != nil {
+		return 0, fmt.Errorf("free space query failed: %v", err)
+	}
+	return free, nil
+}
+
+// ReclaimSpace rebuilds SystemEvents to return its free space to the
+// filesystem: OPTIMIZE TABLE, or ALTER TABLE … FORCE when rebuild is set.
+// It can take a long time on large tables.
+func (db *DB) ReclaimSpace(rebuild bool) error {
+	rows, err := db.Query(db.Dialect.reclaimQuery(rebuild))
+	if err != nil {
+		return fmt.Errorf("reclaiming space failed: %v", err)
+	}
+	defer rows.Close()
+
+	// OPTIMIZE TABLE reports errors as rows (Table, Op, Msg_type, Msg_text).
+	cols, err := rows.Columns()
+	if err != nil || len(cols) != 4 {
+		return err
+	}
+	for rows.Next() {
+		var table, op, msgType, msgText string
+		if err := rows.Scan(&table, &op, &msgType, &msgText); err != nil {
+			return err
+		}
+		if msgType == "error" {
+			return fmt.Errorf("reclaiming space failed: %s", msgText)
+		}
+	}
+	return rows.Err()
+}
+
 // OldestEntryTime returns the ReceivedAt timestamp of the oldest log entry.
 // Returns nil when the table is empty.
-func (db *DB) OldestEntryTime() (*time.Time, error) {
+func (db *DB) OldestEntryTime(ctx context.Context) (*time.Time, error) {
 	var t time.Time
-	err := db.QueryRow("SELECT MIN(ReceivedAt) FROM SystemEvents").Scan(&t)
+	// ORDER BY instead of MIN() keeps the column type, which SQLite needs to
+	// return a time; both use the ReceivedAt index.
+	err := db.QueryRowContext(ctx,
+		"SELECT ReceivedAt FROM SystemEvents WHERE ReceivedAt IS NOT NULL ORDER BY ReceivedAt ASC LIMIT 1",
+	).Scan(&t)
 	if err != nil || t.IsZero() {
 		return nil, nil
 	}
+	t = db.Dialect.scanTime(t)
 	return &t, nil
 }
 
+// OldestEntries returns the n oldest rows matching the WHERE clause, in the
+// order cleanup deletes them.
+func (db *DB) OldestEntries(whereClause string, args []interface{}, n int) ([]models.LogEntry, error) {
+	return db.selectLogs(context.Background(), whereClause, args, "ReceivedAt ASC, ID ASC", n, 0)
+}
+
+// OldestIDs returns the IDs of the n oldest rows matching the WHERE clause,
+// oldest first.
+func (db *DB) OldestIDs(whereClause string, args []interface{}, n int) ([]int, error) {
+	rows, err := db.Query(fmt.Sprintf(
+		"SELECT ID FROM SystemEvents WHERE %s ORDER BY ReceivedAt ASC, ID ASC LIMIT ?", whereClause),
+		append(append([]interface{}{}, args...), n)...)
+	if err != nil {
+		return nil, fmt.Errorf("ID query failed: %w", err)
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("ID scan failed: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// OldestRange counts the rows matching the WHERE clause, or only the limit
+// oldest of them when limit > 0, and returns their ReceivedAt range. Used to
+// report what cleanup would delete.
+func (db *DB) OldestRange(whereClause string, args []interface{}, limit int) (int64, *time.Time, *time.Time, error) {
+	var rows int64
+	var err error
+	if limit > 0 {
+		err = db.QueryRow(fmt.Sprintf(`
+			SELECT COUNT(*) FROM (
+				SELECT ID FROM SystemEvents WHERE %s ORDER BY ReceivedAt ASC, ID ASC LIMIT ?
+			) AS oldest`, whereClause), append(append([]interface{}{}, args...), limit)...).Scan(&rows)
+	} else {
+		err = db.QueryRow("SELECT COUNT(*) FROM SystemEvents WHERE "+whereClause, args...).Scan(&rows)
+	}
+	if err != nil || rows == 0 {
+		return 0, nil, nil, err
+	}
+
+	// ORDER BY instead of MIN()/MAX() keeps the column type (see OldestEntryTime).
+	at := func(order string, offset int64) (*time.Time, error) {
+		var t time.Time
+		err := db.QueryRow(fmt.Sprintf(
+			"SELECT ReceivedAt FROM SystemEvents WHERE %s ORDER BY ReceivedAt %s, ID %s LIMIT 1 OFFSET ?",
+			whereClause, order, order), append(append([]interface{}{}, args...), offset)...).Scan(&t)
+		if err != nil {
+			return nil, err
+		}
+		t = db.Dialect.scanTime(t)
+		return &t, nil
+	}
+	oldest, err := at("ASC", 0)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	var newest *time.Time
+	if limit > 0 {
+		newest, err = at("ASC", rows-1)
+	} else {
+		newest, err = at("DESC", 0)
+	}
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return rows, oldest, newest, nil
+}
+
 // QueryLogsWithTotal runs CountLogs, QueryLogs and TotalCount in parallel.
 // Returns (entries, filteredTotal, dbTotal, error).
 func (db *DB) QueryLogsWithTotal(whereClause string, args []interface{}, limit, offset int) ([]models.LogEntry, int, int, error) {
+	return db.queryPage(context.Background(), whereClause, args, whereClause, args, limit, offset)
+}
+
+// queryPage is QueryLogsWithTotal with a separate WHERE clause for the page
+// itself: the filtered total is counted with whereClause while the rows are
+// selected with pageClause (whereClause plus a pagination cursor condition).
+func (db *DB) queryPage(ctx context.Context, whereClause string, args []interface{}, pageClause string, pageArgs []interface{}, limit, offset int) ([]models.LogEntry, int, int, error) {
+	rows, filtered, dbTotal, err := db.openPage(ctx, whereClause, args, pageClause, pageArgs, limit, offset, true)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	entries, err := collectLogs(rows)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return entries, filtered, dbTotal, nil
+}
+
+// openPage runs the count queries of queryPage and opens its SELECT, all in
+// parallel. The filtered total is only counted when count is set. The
+// caller reads and closes the rows.
+func (db *DB) openPage(ctx context.Context, whereClause string, args []interface{}, pageClause string, pageArgs []interface{}, limit, offset int, count bool) (*LogRows, int, int, error) {
 	type countResult struct {
 		n   int
 		err error
 	}
 	type entriesResult struct {
-		rows []models.LogEntry
+		rows *LogRows
 		err  error
 	}
 
+	// Take the weight of all three calls at once: taken one by one, pages
+	// running together could each hold a scan while waiting for counts that
+	// no longer fit the budget.
+	scanWeight, counts := querylimit.Scan.Weight(), 1
+	if count {
+		counts++
+	}
+	permit, err := db.reserve(ctx, querylimit.Scan, scanWeight+counts*querylimit.Count.Weight())
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	ctx = querylimit.WithReserved(ctx)
+
 	filteredCh := make(chan countResult, 1)
 	dbTotalCh  := make(chan countResult, 1)
 	entriesCh  := make(chan entriesResult, 1)
@@ -103,20 +340,24 @@ func (db *DB) QueryLogsWithTotal(whereClause string, args []interface{}, limit,
 
 	go func() {
 		defer wg.Done()
-		n, err := db.CountLogs(whereClause, args)
+		if !count {
+			filteredCh <- countResult{}
+			return
+		}
+		n, err := db.CountLogs(ctx, whereClause, args)
 		filteredCh <- countResult{n, err}
 	}()
 
 	go func() {
 		defer wg.Done()
-		n, err := db.TotalCount()
+		n, err := db.TotalCount(querylimit.WithClass(ctx, querylimit.Count))
 		dbTotalCh <- countResult{n, err}
 	}()
 
 	go func() {
 		defer wg.Done()
-		// queryLogsRaw builds its own args copy — safe to share args here.
-		rows, err := db.queryLogsRaw(whereClause, args, limit, offset)
+		// openLogs builds its own args copy — safe to share args here.
+		rows, err := db.openLogs(ctx, pageClause, pageArgs, "ReceivedAt DESC, ID DESC", limit, offset)
 		entriesCh <- entriesResult{rows, err}
 	}()
 
@@ -129,29 +370,35 @@ func (db *DB) QueryLogsWithTotal(whereClause string, args []interface{}, limit,
 	dbTotal  := <-dbTotalCh
 	entries  := <-entriesCh
 
-	if filtered.err != nil {
-		return nil, 0, 0, filtered.err
-	}
-	if dbTotal.err != nil {
-		return nil, 0, 0, dbTotal.err
-	}
-	if entries.err != nil {
-		return nil, 0, 0, entries.err
+	for _, err := range []error{filtered.err, dbTotal.err, entries.err} {
+		if err != nil {
+			if entries.rows != nil {
+				entries.rows.Close()
+			}
+			permit.Release(-1)
+			return nil, 0, 0, err
+		}
 	}
 
+	// The counts are done; the scan keeps its weight until the rows are closed.
+	if n := permit.Held() - scanWeight; n > 0 {
+		permit.Release(n)
+	}
+	entries.rows.permit = permit
 	return entries.rows, filtered.n, dbTotal.n, nil
 }
 
 // QueryDistinctValues returns distinct values for a column, with optional filters.
 // Results are cached for metaCacheTTL (60 s) to reduce redundant DB round-trips.
-// "Severity" is a virtual column computed from Priority MOD 8.
-func (db *DB) QueryDistinctValues(column, whereClause string, args []interface{}) (interface{}, error) {
+// Virtual columns (Severity, ProgramName, ProcessID) are computed from their
+// SQL expression.
+func (db *DB) QueryDistinctValues(ctx context.Context, column, whereClause string, args []interface{}) (interface{}, error) {
 	key := CacheKey(column, whereClause, args)
 	if cached, ok := db.MetaCache.Get(key); ok {
 		return cached, nil
 	}
 
-	result, err := db.queryDistinctValuesUncached(column, whereClause, args)
+	result, err := db.queryDistinctValuesUncached(ctx, column, whereClause, args)
 	if err != nil {
 		return nil, err
 	}
@@ -161,18 +408,24 @@ func (db *DB) QueryDistinctValues(column, whereClause string, args []interface{}
 }
 
 // queryDistinctValuesUncached performs the actual DB query without consulting the cache.
-func (db *DB) queryDistinctValuesUncached(column, whereClause string, args []interface{}) (interface{}, error) {
+func (db *DB) queryDistinctValuesUncached(ctx context.Context, column, whereClause string, args []interface{}) (interface{}, error) {
 	if column == "Severity" {
-		return db.queryDistinctSeverity(whereClause, args)
+		return db.queryDistinctSeverity(ctx, whereClause, args)
+	}
+	if name, ok := strings.CutPrefix(column, fields.QueryPrefix); ok {
+		return db.queryDistinctFieldValues(ctx, name, whereClause, args)
+	}
+	if IsVirtualColumn(column) {
+		return db.queryDistinctVirtual(ctx, column, whereClause, args)
 	}
 
 	query := fmt.Sprintf(
 		"SELECT DISTINCT %s FROM SystemEvents WHERE %s AND %s IS NOT NULL ORDER BY %s ASC",
 		column, whereClause, column, column,
 	)
-	rows, err := db.Query(query, args...)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("meta query failed: %v", err)
+		return nil, fmt.Errorf("meta query failed: %w", err)
 	}
 	defer rows.Close()
 
@@ -185,15 +438,15 @@ func (db *DB) queryDistinctValuesUncached(column, whereClause string, args []int
 	return scanStringValues(rows)
 }
 
-// queryDistinctSeverity returns distinct Severity values derived from Priority MOD 8.
-func (db *DB) queryDistinctSeverity(whereClause string, args []interface{}) (interface{}, error) {
+// queryDistinctSeverity returns distinct Severity values derived from Priority.
+func (db *DB) queryDistinctSeverity(ctx context.Context, whereClause string, args []interface{}) (interface{}, error) {
 	query := fmt.Sprintf(
-		"SELECT DISTINCT Priority MOD 8 AS Severity FROM SystemEvents WHERE %s ORDER BY Severity ASC",
-		whereClause,
+		"SELECT DISTINCT %s AS Severity FROM SystemEvents WHERE %s ORDER BY Severity ASC",
+		db.ColumnExpr("Severity"), whereClause,
 	)
-	rows, err := db.Query(query, args...)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("severity meta query failed: %v", err)
+		return nil, fmt.Errorf("severity meta query failed: %w", err)
 	}
 	defer rows.Close()
 
@@ -215,6 +468,25 @@ func (db *DB) queryDistinctSeverity(whereClause string, args []interface{}) (int
 	return result, nil
 }
 
+// queryDistinctVirtual returns distinct values of a virtual column derived from
+// SysLogTag (ProgramName, ProcessID).
+func (db *DB) queryDistinctVirtual(ctx context.Context, column, whereClause string, args []interface{}) (interface{}, error) {
+	query := fmt.Sprintf(
+		"SELECT DISTINCT %s AS v FROM SystemEvents WHERE %s AND %s IS NOT NULL ORDER BY v ASC",
+		db.ColumnExpr(column), whereClause, db.ColumnExpr(column),
+	)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s meta query failed: %w", column, err)
+	}
+	defer rows.Close()
+
+	if db.isIntegerColumn(column) {
+		return scanIntValues(rows)
+	}
+	return scanStringValues(rows)
+}
+
 // scanMetaFacilityValues scans facility integer values and attaches RFC labels.
 func scanMetaFacilityValues(rows interface{ Scan(...interface{}) error; Next() bool }) (interface{}, error) {
 	var result []models.MetaValue
@@ -274,6 +546,7 @@ func (db *DB) isIntegerColumn(column string) bool {
 		"Importance": true, "EventCategory": true, "EventID": true,
 		"MaxAvailable": true, "CurrUsage": true, "MinUsage": true,
 		"MaxUsage": true, "InfoUnitID": true, "SystemID": true,
+		"ProcessID": true,
 	}
 	return intCols[column]
 }
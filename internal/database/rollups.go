@@ -0,0 +1,361 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Rollup granularities, the bucket length in seconds.
+const (
+	RollupMinute = 60
+	RollupHour   = 3600
+)
+
+// rollupSchema creates the rsyslox-owned rollup tables. rsyslox_rollups
+// holds the number of SystemEvents rows per bucket and dimension values;
+// rsyslox_rollup_state the ID of the last row counted. Buckets are Unix
+// seconds, which keeps the schema identical on every dialect.
+var rollupSchema = []string{
+	`CREATE TABLE IF NOT EXISTS rsyslox_rollups (
+		granularity INT NOT NULL,
+		bucket      BIGINT NOT NULL,
+		host        VARCHAR(255) NOT NULL,
+		tag         VARCHAR(255) NOT NULL,
+		facility    INT NOT NULL,
+		severity    INT NOT NULL,
+		entries     BIGINT NOT NULL,
+		PRIMARY KEY (granularity, bucket, host, tag, facility, severity)
+	)`,
+	`CREATE TABLE IF NOT EXISTS rsyslox_rollup_state (
+		name  VARCHAR(32) NOT NULL PRIMARY KEY,
+		value BIGINT NOT NULL
+	)`,
+}
+
+// rollupTextLimit is the length of the host and tag columns.
+const rollupTextLimit = 255
+
+// RollupRow is a SystemEvents row reduced to the rollup dimensions.
+// NULL facilities and severities are -1, NULL texts are empty.
+type RollupRow struct {
+	ID         int
+	ReceivedAt time.Time
+	Host       string
+	Tag        string // ProgramName
+	Facility   int
+	Severity   int
+}
+
+// RollupKey identifies one row of rsyslox_rollups.
+type RollupKey struct {
+	Granularity int
+	Bucket      int64 // Unix seconds of the bucket start
+	Host        string
+	Tag         string
+	Facility    int
+	Severity    int
+}
+
+// RollupFilter restricts rollup sums. Values within a list are ORed, lists
+// are ANDed; empty lists match everything.
+type RollupFilter struct {
+	Hosts      []string
+	Tags       []string
+	Facilities []int
+	Severities []int
+}
+
+// Match reports whether a row passes the filter.
+func (f RollupFilter) Match(r RollupRow) bool {
+	return matchAny(f.Hosts, r.Host) && matchAny(f.Tags, r.Tag) &&
+		matchAny(f.Facilities, r.Facility) && matchAny(f.Severities, r.Severity)
+}
+
+func matchAny[T comparable](values []T, v T) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// RollupDimensions maps the rollup group-by names to their columns.
+var RollupDimensions = map[string]string{
+	"bucket":      "bucket",
+	"FromHost":    "host",
+	"ProgramName": "tag",
+	"Facility":    "facility",
+	"Severity":    "severity",
+}
+
+// EnsureRollupTables creates the rollup tables if they do not exist.
+func (db *DB) EnsureRollupTables() error {
+	for _, stmt := range rollupSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create rollup tables: %w", err)
+		}
+	}
+	return nil
+}
+
+// RollupLastID returns the ID of the last row counted into the rollups,
+// 0 when nothing has been counted yet.
+func (db *DB) RollupLastID() (int, error) {
+	var id int64
+	err := db.QueryRow("SELECT value FROM rsyslox_rollup_state WHERE name = 'last_id'").Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return int(id), err
+}
+
+// RollupRows returns up to limit rows with an ID greater than afterID,
+// in ID order.
+func (db *DB) RollupRows(afterID, limit int) ([]RollupRow, error) {
+	return db.rollupRows("ID > ? ORDER BY ID LIMIT ?", afterID, limit)
+}
+
+// RollupRowsByID returns the rows with one of ids, in ID order.
+func (db *DB) RollupRowsByID(ids []int) ([]RollupRow, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return db.rollupRows("ID IN ("+strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")+") ORDER BY ID", args...)
+}
+
+// rollupRows reads the rollup dimensions of the rows selected by cond.
+func (db *DB) rollupRows(cond string, args ...interface{}) ([]RollupRow, error) {
+	query := fmt.Sprintf(
+		"SELECT ID, ReceivedAt, FromHost, %s, Facility, %s FROM SystemEvents WHERE %s",
+		db.ColumnExpr("ProgramName"), db.ColumnExpr("Severity"), cond,
+	)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("rollup source query failed: %v", err)
+	}
+	defer rows.Close()
+
+	var result []RollupRow
+	for rows.Next() {
+		var (
+			r                  RollupRow
+			receivedAt         sql.NullTime
+			host, tag          sql.NullString
+			facility, severity sql.NullInt64
+		)
+		if err := rows.Scan(&r.ID, &receivedAt, &host, &tag, &facility, &severity); err != nil {
+			return nil, fmt.Errorf("rollup source scan failed: %v", err)
+		}
+		if receivedAt.Valid {
+			r.ReceivedAt = db.Dialect.scanTime(receivedAt.Time)
+		}
+		r.Host = truncate(host.String, rollupTextLimit)
+		r.Tag = truncate(tag.String, rollupTextLimit)
+		r.Facility, r.Severity = -1, -1
+		if facility.Valid {
+			r.Facility = int(facility.Int64)
+		}
+		if severity.Valid {
+			r.Severity = int(severity.Int64)
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// AddRollups adds counts to the rollups and records lastID as the last row
+// counted, in one transaction.
+func (db *DB) AddRollups(counts map[RollupKey]int64, lastID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin rollup update: %w", err)
+	}
+	defer tx.Rollback()
+
+	exec := func(query string, args ...interface{}) (int64, error) {
+		result, err := tx.Exec(db.Dialect.rebind(query), db.bindArgs(args)...)
+		if err != nil {
+			return 0, err
+		}
+		return result.RowsAffected()
+	}
+
+	// UPDATE, then INSERT when the row does not exist yet: portable, and
+	// the rollup worker serializes all writers.
+	for k, n := range counts {
+		affected, err := exec(
+			"UPDATE rsyslox_rollups SET entries = entries + ? WHERE granularity = ? AND bucket = ? AND host = ? AND tag = ? AND facility = ? AND severity = ?",
+			n, k.Granularity, k.Bucket, k.Host, k.Tag, k.Facility, k.Severity)
+		if err == nil && affected == 0 {
+			_, err = exec(
+				"INSERT INTO rsyslox_rollups (granularity, bucket, host, tag, facility, severity, entries) VALUES (?, ?, ?, ?, ?, ?, ?)",
+				k.Granularity, k.Bucket, k.Host, k.Tag, k.Facility, k.Severity, n)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update rollups: %w", err)
+		}
+	}
+
+	affected, err := exec("UPDATE rsyslox_rollup_state SET value = ? WHERE name = 'last_id'", lastID)
+	if err == nil && affected == 0 {
+		_, err = exec("INSERT INTO rsyslox_rollup_state (name, value) VALUES ('last_id', ?)", lastID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update rollup state: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit rollups: %w", err)
+	}
+	return nil
+}
+
+// RemoveRollups subtracts counts of deleted rows from the rollups and
+// deletes the rollup rows that drop to zero, in one transaction. Buckets
+// that no longer exist, such as pruned minute buckets, are skipped.
+func (db *DB) RemoveRollups(counts map[RollupKey]int64) error {
+	if len(counts) == 0 {
+		return nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin rollup update: %w", err)
+	}
+	defer tx.Rollback()
+
+	exec := func(query string, args ...interface{}) error {
+		_, err := tx.Exec(db.Dialect.rebind(query), db.bindArgs(args)...)
+		return err
+	}
+	const key = "granularity = ? AND bucket = ? AND host = ? AND tag = ? AND facility = ? AND severity = ?"
+	for k, n := range counts {
+		err := exec("UPDATE rsyslox_rollups SET entries = entries - ? WHERE "+key,
+			n, k.Granularity, k.Bucket, k.Host, k.Tag, k.Facility, k.Severity)
+		if err == nil {
+			err = exec("DELETE FROM rsyslox_rollups WHERE "+key+" AND entries <= 0",
+				k.Granularity, k.Bucket, k.Host, k.Tag, k.Facility, k.Severity)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update rollups: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit rollups: %w", err)
+	}
+	return nil
+}
+
+// TimeRange is the half-open interval [Start, End). A zero Start is open.
+type TimeRange struct {
+	Start, End time.Time
+}
+
+// DeleteRollupRange deletes the buckets of all granularities that start in r.
+func (db *DB) DeleteRollupRange(r TimeRange) (int64, error) {
+	var from int64
+	if !r.Start.IsZero() {
+		from = r.Start.Unix()
+	}
+	result, err := db.Exec("DELETE FROM rsyslox_rollups WHERE bucket >= ? AND bucket < ?", from, r.End.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete rollups: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// ResetRollups deletes all rollups, so that they are rebuilt from the
+// first row.
+func (db *DB) ResetRollups() error {
+	for _, stmt := range []string{"DELETE FROM rsyslox_rollups", "DELETE FROM rsyslox_rollup_state"} {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to reset rollups: %w", err)
+		}
+	}
+	return nil
+}
+
+// PruneRollups deletes the buckets of a granularity that start before
+// before. Returns the number of deleted rollup rows.
+func (db *DB) PruneRollups(granularity int, before time.Time) (int64, error) {
+	result, err := db.Exec("DELETE FROM rsyslox_rollups WHERE granularity = ? AND bucket < ?",
+		granularity, before.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune rollups: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// RollupSums returns the summed counts of the buckets of a granularity in
+// [start, end), grouped by one of RollupDimensions. Keys are the values of
+// the group-by column formatted as text.
+func (db *DB) RollupSums(granularity int, start, end time.Time, filter RollupFilter, groupBy string) (map[string]int64, error) {
+	column, ok := RollupDimensions[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("invalid rollup dimension %q", groupBy)
+	}
+
+	conds := []string{"granularity = ?", "bucket >= ?", "bucket < ?"}
+	args := []interface{}{granularity, start.Unix(), end.Unix()}
+	addIn := func(column string, values []interface{}) {
+		if len(values) == 0 {
+			return
+		}
+		conds = append(conds, column+" IN ("+strings.TrimSuffix(strings.Repeat("?,", len(values)), ",")+")")
+		args = append(args, values...)
+	}
+	addIn("host", toInterfaces(filter.Hosts))
+	addIn("tag", toInterfaces(filter.Tags))
+	addIn("facility", toInterfaces(filter.Facilities))
+	addIn("severity", toInterfaces(filter.Severities))
+
+	query := fmt.Sprintf("SELECT %s, SUM(entries) FROM rsyslox_rollups WHERE %s GROUP BY %s",
+		column, strings.Join(conds, " AND "), column)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("rollup query failed: %v", err)
+	}
+	defer rows.Close()
+
+	sums := make(map[string]int64)
+	for rows.Next() {
+		var (
+			key string
+			n   int64
+		)
+		if err := rows.Scan(&key, &n); err != nil {
+			return nil, fmt.Errorf("rollup scan failed: %v", err)
+		}
+		sums[key] += n
+	}
+	return sums, rows.Err()
+}
+
+func toInterfaces[T any](values []T) []interface{} {
+	result := make([]interface{}, len(values))
+	for i, v := range values {
+		result[i] = v
+	}
+	return result
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && s[n]&0xC0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,443 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/querylog"
+)
+
+// reconnectInterval limits how often an unreachable source is retried.
+const reconnectInterval = 30 * time.Second
+
+// maxFanOutWindow caps offset+limit for offset pagination across several
+// sources, because every source has to return offset+limit rows.
+// Deeper pages must use the cursor.
+const maxFanOutWindow = 100000
+
+// maxFieldScan caps the rows a page with field filters reads to find its
+// matching entries (see StreamLogs).
+const maxFieldScan = 100000
+
+// Source is one named rsyslog database. A source that is unreachable at
+// startup is retried in the background, at most once per reconnectInterval.
+type Source struct {
+	Name    string
+	rank    int // position in the configuration; breaks ReceivedAt ties
+	cfg     *config.Config
+	dbCfg   config.DatabaseConfig
+	queries *querylog.Recorder
+
+	mu          sync.Mutex
+	db          *DB
+	lastErr     error
+	lastAttempt time.Time
+	connecting  bool // a reconnect is running
+	closed      bool
+}
+
+// DB returns the connection of the source. While the source is
+// unreachable it returns the last error at once and starts a reconnect in
+// the background when reconnectInterval has passed, so that requests never
+// wait for an unreachable host.
+func (s *Source) DB() (*DB, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.db != nil {
+		return s.db, nil
+	}
+	if !s.connecting && !s.closed && time.Since(s.lastAttempt) >= reconnectInterval {
+		s.connecting = true
+		s.lastAttempt = time.Now()
+		go s.connect()
+	}
+	return nil, s.lastErr
+}
+
+// connect attempts to connect and records the result. It must not be
+// called with s.mu held: connecting can take as long as the dial timeout.
+func (s *Source) connect() {
+	db, err := Connect(s.cfg, s.dbCfg, s.queries)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connecting = false
+	if s.closed {
+		if db != nil {
+			db.Close()
+		}
+		return
+	}
+	if err != nil {
+		s.lastErr = err
+		log.Printf("⚠️  Database source %s unavailable: %v", s.label(), err)
+		return
+	}
+	if s.lastErr != nil {
+		log.Printf("✓ Database source %s reconnected", s.label())
+	}
+	s.db, s.lastErr = db, nil
+}
+
+// Config returns the connection settings of the source.
+func (s *Source) Config() config.DatabaseConfig {
+	return s.dbCfg
+}
+
+// label returns the name used for the source in log messages and warnings.
+func (s *Source) label() string {
+	if s.Name == "" {
+		return "default"
+	}
+	return s.Name
+}
+
+// Sources is the set of configured rsyslog databases.
+// Log and meta queries fan out to every source and merge the results;
+// a failing source produces a warning instead of failing the request.
+type Sources struct {
+	list    []*Source
+	byName  map[string]*Source
+	primary *DB
+	queries *querylog.Recorder
+}
+
+// ConnectAll connects every configured database. Unreachable sources are
+// logged and retried later; an error is returned only when none is reachable.
+func ConnectAll(cfg *config.Config) (*Sources, error) {
+	srcs := &Sources{
+		byName: make(map[string]*Source),
+		queries: querylog.New(querylog.Config{
+			SlowThreshold: cfg.QueryLog.SlowThreshold,
+			Size:          cfg.QueryLog.Size,
+		}),
+	}
+	for i, dc := range cfg.DatabaseSources() {
+		src := &Source{Name: dc.Name, rank: i, cfg: cfg, dbCfg: dc.Connection(), queries: srcs.queries}
+		src.lastAttempt = time.Now()
+		src.connect()
+		if src.db != nil && srcs.primary == nil {
+			srcs.primary = src.db
+		}
+		srcs.list = append(srcs.list, src)
+		srcs.byName[dc.Name] = src
+	}
+
+	if srcs.primary == nil {
+		srcs.Close()
+		return nil, fmt.Errorf("no database source is reachable: %v", srcs.list[0].lastErr)
+	}
+	if len(srcs.list) > 1 {
+		log.Printf("✓ %d database sources configured", len(srcs.list))
+	}
+	return srcs, nil
+}
+
+// Primary returns the first source that was reachable at startup. Schema
+// information (columns, parsers) and background services use it.
+func (s *Sources) Primary() *DB {
+	return s.primary
+}
+
+// Queries returns the recorder timing the calls to all sources.
+func (s *Sources) Queries() *querylog.Recorder {
+	return s.queries
+}
+
+// List returns the configured sources in configuration order.
+func (s *Sources) List() []*Source {
+	return s.list
+}
+
+// Multi reports whether more than one source is configured.
+func (s *Sources) Multi() bool {
+	return len(s.list) > 1
+}
+
+// Close closes all open connections.
+func (s *Sources) Close() {
+	for _, src := range s.list {
+		src.mu.Lock()
+		src.closed = true
+		if src.db != nil {
+			src.db.Close()
+		}
+		src.mu.Unlock()
+	}
+}
+
+// SourceHealth is the connection state of one source.
+type SourceHealth struct {
+	Name   string `json:"name"`
+	Status string `json:"status"` // "connected" or "disconnected"
+	Error  string `json:"error,omitempty"`
+}
+
+// Health pings every source. healthy is the number of reachable sources.
+func (s *Sources) Health() (list []SourceHealth, healthy int) {
+	list = make([]SourceHealth, len(s.list))
+	s.each(func(i int, src *Source, db *DB, err error) {
+		if err == nil {
+			err = db.Health()
+		}
+		h := SourceHealth{Name: src.label(), Status: "connected"}
+		if err != nil {
+			h.Status = "disconnected"
+			h.Error = err.Error()
+		}
+		list[i] = h
+	})
+	for _, h := range list {
+		if h.Status == "connected" {
+			healthy++
+		}
+	}
+	return list, healthy
+}
+
+// each runs fn for every source in parallel and waits for all of them.
+// db is nil and err set when the source is unreachable.
+func (s *Sources) each(fn func(i int, src *Source, db *DB, err error)) {
+	var wg sync.WaitGroup
+	wg.Add(len(s.list))
+	for i, src := range s.list {
+		go func(i int, src *Source) {
+			defer wg.Done()
+			db, err := src.DB()
+			fn(i, src, db, err)
+		}(i, src)
+	}
+	wg.Wait()
+}
+
+// window returns the number of rows to fetch from each source and the
+// offset to use in SQL, and the number of merged rows to skip. A single
+// source pages in SQL; several sources each return the whole window and the
+// merged result is sliced.
+func (s *Sources) window(limit, offset int) (fetch, skip, sqlOffset int, err error) {
+	if !s.Multi() {
+		return limit, 0, offset, nil
+	}
+	if offset+limit > maxFanOutWindow {
+		return 0, 0, 0, models.NewValidationError("offset",
+			fmt.Sprintf("offset+limit cannot exceed %d across several databases; use cursor", maxFanOutWindow))
+	}
+	return offset + limit, offset, 0, nil
+}
+
+// pageClause adds the cursor condition of src to the WHERE clause.
+func (s *Sources) pageClause(src *Source, whereClause string, args []interface{}, cursor *Cursor) (string, []interface{}) {
+	if cursor == nil {
+		return whereClause, args
+	}
+	cond, cargs := cursor.condition(src.rank, s.byName[cursor.Source].rank)
+	return "(" + whereClause + ") AND " + cond,
+		append(append(make([]interface{}, 0, len(args)+len(cargs)), args...), cargs...)
+}
+
+// before reports whether a comes before b in a merged page: newest first,
+// ties broken by source rank and then by ID (descending), matching the
+// cursor condition.
+func (s *Sources) before(a, b models.LogEntry) bool {
+	if !a.ReceivedAt.Equal(b.ReceivedAt) {
+		return a.ReceivedAt.After(b.ReceivedAt)
+	}
+	ra, rb := s.byName[a.Source].rank, s.byName[b.Source].rank
+	if ra != rb {
+		return ra < rb
+	}
+	return a.ID > b.ID
+}
+
+// TotalCount returns the unfiltered row count summed over all reachable sources.
+func (s *Sources) TotalCount(ctx context.Context) (int, []string) {
+	counts := make([]int, len(s.list))
+	errs := make([]error, len(s.list))
+	s.each(func(i int, _ *Source, db *DB, err error) {
+		if err == nil {
+			counts[i], err = db.TotalCount(ctx)
+		}
+		errs[i] = err
+	})
+
+	total := 0
+	var warnings []string
+	for i, n := range counts {
+		if errs[i] != nil {
+			warnings = append(warnings, fmt.Sprintf("source %s: %v", s.list[i].label(), errs[i]))
+			continue
+		}
+		total += n
+	}
+	return total, warnings
+}
+
+// OldestEntryTime returns the oldest ReceivedAt across all reachable sources.
+func (s *Sources) OldestEntryTime(ctx context.Context) *time.Time {
+	times := make([]*time.Time, len(s.list))
+	s.each(func(i int, _ *Source, db *DB, err error) {
+		if err == nil {
+			times[i], _ = db.OldestEntryTime(ctx)
+		}
+	})
+
+	var oldest *time.Time
+	for _, t := range times {
+		if t != nil && (oldest == nil || t.Before(*oldest)) {
+			oldest = t
+		}
+	}
+	return oldest
+}
+
+// QueryDistinctValues returns the union of the distinct values of column
+// across all reachable sources.
+func (s *Sources) QueryDistinctValues(ctx context.Context, column, whereClause string, args []interface{}) (interface{}, []string, error) {
+	values := make([]interface{}, len(s.list))
+	errs := make([]error, len(s.list))
+	s.each(func(i int, _ *Source, db *DB, err error) {
+		if err == nil {
+			values[i], err = db.QueryDistinctValues(ctx, column, whereClause, args)
+		}
+		errs[i] = err
+	})
+
+	var warnings []string
+	var ok []interface{}
+	for i, v := range values {
+		if errs[i] != nil {
+			warnings = append(warnings, fmt.Sprintf("source %s: %v", s.list[i].label(), errs[i]))
+			continue
+		}
+		ok = append(ok, v)
+	}
+	if len(ok) == 0 {
+		return nil, warnings, fmt.Errorf("all database sources failed: %w", errs[0])
+	}
+	return mergeDistinct(ok), warnings, nil
+}
+
+// CountsByColumn sums CountsByColumn over all sources. Unlike the query
+// methods it fails when any source fails, because a partial count would look
+// like a drop in volume.
+func (s *Sources) CountsByColumn(column string, start, end time.Time) (map[string]int, error) {
+	results := make([]map[string]int, len(s.list))
+	errs := make([]error, len(s.list))
+	s.each(func(i int, _ *Source, db *DB, err error) {
+		if err == nil {
+			results[i], err = db.CountsByColumn(column, start, end)
+		}
+		errs[i] = err
+	})
+
+	total := make(map[string]int)
+	for i, r := range results {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("source %s: %w", s.list[i].label(), errs[i])
+		}
+		for k, n := range r {
+			total[k] += n
+		}
+	}
+	return total, nil
+}
+
+// CountsWhere sums CountsWhere over all reachable sources.
+func (s *Sources) CountsWhere(ctx context.Context, column, whereClause string, args []interface{}) (map[string]int64, []string, error) {
+	return sumCounts(s, func(db *DB) (map[string]int64, error) {
+		return db.CountsWhere(ctx, column, whereClause, args)
+	})
+}
+
+// TimeCounts sums TimeCounts over all reachable sources.
+func (s *Sources) TimeCounts(ctx context.Context, whereClause string, args []interface{}, unit string, bucket func(time.Time) int64) (map[int64]int64, []string, error) {
+	return sumCounts(s, func(db *DB) (map[int64]int64, error) {
+		return db.TimeCounts(ctx, whereClause, args, unit, bucket)
+	})
+}
+
+// sumCounts runs query on every source and sums the counts. Failing sources
+// are reported as warnings; it fails only when all sources fail.
+func sumCounts[K comparable](s *Sources, query func(db *DB) (map[K]int64, error)) (map[K]int64, []string, error) {
+	results := make([]map[K]int64, len(s.list))
+	errs := make([]error, len(s.list))
+	s.each(func(i int, _ *Source, db *DB, err error) {
+		if err == nil {
+			results[i], err = query(db)
+		}
+		errs[i] = err
+	})
+
+	total := make(map[K]int64)
+	var warnings []string
+	ok := 0
+	for i, r := range results {
+		if errs[i] != nil {
+			warnings = append(warnings, fmt.Sprintf("source %s: %v", s.list[i].label(), errs[i]))
+			continue
+		}
+		ok++
+		for k, n := range r {
+			total[k] += n
+		}
+	}
+	if ok == 0 {
+		return nil, warnings, fmt.Errorf("all database sources failed: %w", errs[0])
+	}
+	return total, warnings, nil
+}
+
+// mergeDistinct unions the per-source results of QueryDistinctValues.
+// All results share the type chosen by the column.
+func mergeDistinct(results []interface{}) interface{} {
+	if len(results) == 1 {
+		return results[0]
+	}
+	switch results[0].(type) {
+	case []models.MetaValue:
+		seen := map[int]models.MetaValue{}
+		for _, r := range results {
+			for _, v := range r.([]models.MetaValue) {
+				seen[v.Val] = v
+			}
+		}
+		merged := make([]models.MetaValue, 0, len(seen))
+		for _, v := range seen {
+			merged = append(merged, v)
+		}
+		sort.Slice(merged, func(i, j int) bool { return merged[i].Val < merged[j].Val })
+		return merged
+	case []int:
+		seen := map[int]bool{}
+		merged := []int{}
+		for _, r := range results {
+			for _, v := range r.([]int) {
+				if !seen[v] {
+					seen[v] = true
+					merged = append(merged, v)
+				}
+			}
+		}
+		sort.Ints(merged)
+		return merged
+	default:
+		seen := map[string]bool{}
+		merged := []string{}
+		for _, r := range results {
+			for _, v := range r.([]string) {
+				if !seen[v] {
+					seen[v] = true
+					merged = append(merged, v)
+				}
+			}
+		}
+		sort.Strings(merged)
+		return merged
+	}
+}
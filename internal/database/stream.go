@@ -0,0 +1,314 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/querylimit"
+)
+
+// LogRows reads the entries of a log query one at a time, so that a page is
+// never held in memory as a whole.
+type LogRows struct {
+	db    *DB
+	rows  *Rows
+	entry models.LogEntry
+	n     int // rows read, including skipped ones
+
+	permit *querylimit.Permit // weight reserved for the query, see openPage
+
+	skipped int   // rows that could not be scanned
+	skipRow int   // position of the first of them
+	skipErr error // and its error
+}
+
+// openLogs runs the SELECT of selectLogsQuery. The caller must close the rows.
+func (db *DB) openLogs(ctx context.Context, whereClause string, args []interface{}, orderBy string, limit, offset int) (*LogRows, error) {
+	query := selectLogsQuery(whereClause, orderBy)
+
+	// Build a fresh slice — do not append to the caller's args.
+	queryArgs := make([]interface{}, len(args)+2)
+	copy(queryArgs, args)
+	queryArgs[len(args)] = limit
+	queryArgs[len(args)+1] = offset
+
+	rows, err := db.QueryContext(querylimit.WithClass(ctx, querylimit.Scan), query, queryArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	return &LogRows{db: db, rows: rows}, nil
+}
+
+// Next reads the next entry. Rows that fail to scan are skipped and
+// reported by Skipped.
+func (r *LogRows) Next() bool {
+	for r.rows.Next() {
+		r.n++
+		var entry models.LogEntry
+		if err := entry.ScanFromRows(r.rows.Rows); err != nil {
+			if r.skipped == 0 {
+				r.skipRow, r.skipErr = r.n, err
+			}
+			r.skipped++
+			continue
+		}
+		entry.ReceivedAt = r.db.Dialect.scanTime(entry.ReceivedAt)
+		if entry.DeviceReportedTime != nil {
+			t := r.db.Dialect.scanTime(*entry.DeviceReportedTime)
+			entry.DeviceReportedTime = &t
+		}
+		entry.Fields = r.db.Fields.Extract(entry.ProgramName, entry.Message)
+		r.entry = entry
+		return true
+	}
+	return false
+}
+
+// Entry returns the entry read by Next.
+func (r *LogRows) Entry() models.LogEntry {
+	return r.entry
+}
+
+// Skipped describes the rows that could not be scanned, or returns "".
+func (r *LogRows) Skipped() string {
+	if r.skipped == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d rows could not be read (first at row %d: %v)", r.skipped, r.skipRow, r.skipErr)
+}
+
+// Err returns the error that ended the iteration early, if any.
+func (r *LogRows) Err() error {
+	return r.rows.Err()
+}
+
+// Close closes the rows; it is safe to call more than once.
+func (r *LogRows) Close() error {
+	defer r.permit.Release(-1)
+	return r.rows.Close()
+}
+
+// LogsStream is one page of log entries from all sources, merged by
+// ReceivedAt (newest first) while they are read: only the next entry of
+// every source is held in memory. Total, DBTotal and the sources that
+// failed are known when the stream is opened.
+type LogsStream struct {
+	Total   int // filtered total, summed over the reachable sources; 0 with match
+	DBTotal int // unfiltered total, summed over the reachable sources
+
+	s        *Sources
+	heads    []streamHead
+	started  bool
+	skip     int // entries before the page: merged (several sources) or matched
+	limit    int
+	emitted  int
+	entry    models.LogEntry
+	warnings []string
+	err      error
+
+	match   func(models.LogEntry) bool // nil: every row is part of the page
+	offset  int                        // matching entries before the page, for MatchedTotal
+	cursor  bool                       // the page continues a cursor
+	scanned int                        // rows read for match
+	capped  bool                       // stopped at maxFieldScan
+	done    bool                       // every row was read
+	last    models.LogEntry            // last row read
+}
+
+// streamHead is the next entry of one source.
+type streamHead struct {
+	src   *Source
+	rows  *LogRows
+	entry models.LogEntry
+	ok    bool // entry is valid
+}
+
+// StreamLogs opens one page of log entries from all sources. Pagination
+// uses either offset or cursor; when a cursor is given, offset is ignored.
+// The caller must close the stream. The connections of the sources stay in
+// use until then.
+//
+// match, if not nil, selects the entries of the page among the rows of
+// whereClause, for conditions SQL can only pre-select (field filters). Rows
+// are then read until the page is full, offset counts matching entries, and
+// the filtered total is not counted. At most maxFieldScan rows are read; a
+// page that stops there continues with its next cursor.
+func (s *Sources) StreamLogs(ctx context.Context, whereClause string, args []interface{}, limit, offset int, cursor *Cursor, match func(models.LogEntry) bool) (*LogsStream, error) {
+	if cursor != nil {
+		offset = 0
+		if _, ok := s.byName[cursor.Source]; !ok {
+			return nil, models.NewValidationError("cursor", "unknown source "+cursor.Source)
+		}
+	}
+
+	var fetch, skip int
+	if match != nil {
+		fetch, skip, offset = maxFieldScan, offset, 0
+	} else {
+		var err error
+		if fetch, skip, offset, err = s.window(limit, offset); err != nil {
+			return nil, err
+		}
+	}
+
+	type sourceResult struct {
+		rows           *LogRows
+		total, dbTotal int
+		err            error
+	}
+	results := make([]sourceResult, len(s.list))
+
+	s.each(func(i int, src *Source, db *DB, err error) {
+		if err != nil {
+			results[i].err = err
+			return
+		}
+		pageClause, pageArgs := s.pageClause(src, whereClause, args, cursor)
+		rows, total, dbTotal, err := db.openPage(ctx, whereClause, args, pageClause, pageArgs, fetch, offset, match == nil)
+		results[i] = sourceResult{rows, total, dbTotal, err}
+	})
+
+	ls := &LogsStream{s: s, skip: skip, limit: limit, match: match, offset: skip, cursor: cursor != nil}
+	for i, r := range results {
+		if r.err != nil {
+			ls.warnings = append(ls.warnings,
+				fmt.Sprintf("source %s: %v", s.list[i].label(), r.err))
+			continue
+		}
+		ls.Total += r.total
+		ls.DBTotal += r.dbTotal
+		ls.heads = append(ls.heads, streamHead{src: s.list[i], rows: r.rows})
+	}
+	if len(ls.heads) == 0 {
+		return nil, fmt.Errorf("all database sources failed: %w", results[0].err)
+	}
+	for _, w := range ls.warnings {
+		log.Printf("⚠️  Partial result — %s", w)
+	}
+	return ls, nil
+}
+
+// Next reads the next entry of the page. It returns false at the end of
+// the page or when a source fails while being read; see Err.
+func (ls *LogsStream) Next() bool {
+	if !ls.started {
+		ls.started = true
+		for i := range ls.heads {
+			ls.advance(&ls.heads[i])
+		}
+	}
+	for ls.err == nil && ls.emitted < ls.limit {
+		if ls.match != nil && ls.scanned >= maxFieldScan {
+			ls.capped = true
+			return false
+		}
+		next := -1
+		for i := range ls.heads {
+			if ls.heads[i].ok && (next < 0 || ls.s.before(ls.heads[i].entry, ls.heads[next].entry)) {
+				next = i
+			}
+		}
+		if next < 0 {
+			ls.done = true
+			return false
+		}
+		entry := ls.heads[next].entry
+		ls.advance(&ls.heads[next])
+		ls.last = entry
+		if ls.match != nil {
+			ls.scanned++
+			if !ls.match(entry) {
+				continue
+			}
+		}
+		if ls.skip > 0 {
+			ls.skip--
+			continue
+		}
+		ls.entry = entry
+		ls.emitted++
+		return true
+	}
+	return false
+}
+
+// advance reads the next entry of h.
+func (ls *LogsStream) advance(h *streamHead) {
+	if h.ok = h.rows.Next(); h.ok {
+		h.entry = h.rows.Entry()
+		h.entry.Source = h.src.Name
+		return
+	}
+	if err := h.rows.Err(); err != nil && ls.err == nil {
+		ls.err = fmt.Errorf("source %s: %w", h.src.label(), err)
+	}
+}
+
+// Entry returns the entry read by Next.
+func (ls *LogsStream) Entry() models.LogEntry {
+	return ls.entry
+}
+
+// Err returns the error that ended the page early, if any.
+func (ls *LogsStream) Err() error {
+	return ls.err
+}
+
+// NextCursor returns the cursor behind the last entry once the page is
+// read, or "" when the page is not full. Rows that could not be read count
+// towards a full page. A page that stopped at maxFieldScan continues behind
+// the last row read.
+func (ls *LogsStream) NextCursor() string {
+	if ls.capped {
+		return cursorAfter(ls.last)
+	}
+	if ls.emitted == 0 {
+		return ""
+	}
+	n := ls.emitted
+	if ls.match == nil {
+		for _, h := range ls.heads {
+			n += h.rows.skipped
+		}
+	}
+	if n < ls.limit {
+		return ""
+	}
+	return cursorAfter(ls.entry)
+}
+
+// MatchedTotal returns the number of entries matched by the filters of a
+// page with match, once the page is read. It is known only when every row
+// was read and the page did not continue a cursor.
+func (ls *LogsStream) MatchedTotal() (int, bool) {
+	if ls.match == nil || ls.cursor || !ls.done || ls.capped || ls.err != nil {
+		return 0, false
+	}
+	return ls.offset - ls.skip + ls.emitted, true
+}
+
+// Warnings lists the sources that failed and the rows that could not be
+// read. It is complete once the page is read.
+func (ls *LogsStream) Warnings() []string {
+	warnings := append([]string{}, ls.warnings...)
+	if ls.capped {
+		warnings = append(warnings, fmt.Sprintf(
+			"field filters matched %d entries in the %d rows read; continue with next_cursor",
+			ls.emitted, ls.scanned))
+	}
+	for _, h := range ls.heads {
+		if msg := h.rows.Skipped(); msg != "" {
+			warnings = append(warnings, fmt.Sprintf("source %s: %s", h.src.label(), msg))
+		}
+	}
+	return warnings
+}
+
+// Close closes the queries of all sources.
+func (ls *LogsStream) Close() {
+	for _, h := range ls.heads {
+		h.rows.Close()
+	}
+}
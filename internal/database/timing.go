@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/querylimit"
+	"github.com/phil-bot/rsyslox/internal/querylog"
+)
+
+// Rows is sql.Rows of a query run through DB. Closing it records the
+// query with its duration and the number of rows read, and gives back its
+// query limit.
+type Rows struct {
+	*sql.Rows
+	db      *DB
+	ctx     context.Context
+	query   string
+	start   time.Time
+	n       int64
+	closed  bool
+	release func()
+}
+
+// Next advances to the next row and counts it.
+func (r *Rows) Next() bool {
+	if !r.Rows.Next() {
+		return false
+	}
+	r.n++
+	return true
+}
+
+// Close closes the rows and records the query.
+func (r *Rows) Close() error {
+	err := r.Rows.Close()
+	if !r.closed {
+		r.closed = true
+		r.release()
+		r.db.record(r.ctx, r.query, r.start, r.n, r.Rows.Err())
+	}
+	return err
+}
+
+// Row is sql.Row of a query run through DB. Scan records the query and
+// gives back its query limit.
+type Row struct {
+	*sql.Row
+	db      *DB
+	ctx     context.Context
+	query   string
+	start   time.Time
+	release func()
+	err     error // the query was not run
+}
+
+// Scan copies the columns of the row into dest and records the query.
+func (r *Row) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	err := r.Row.Scan(dest...)
+	r.release()
+	switch {
+	case err == nil:
+		r.db.record(r.ctx, r.query, r.start, 1, nil)
+	case errors.Is(err, sql.ErrNoRows):
+		r.db.record(r.ctx, r.query, r.start, 0, nil)
+	default:
+		r.db.record(r.ctx, r.query, r.start, 0, err)
+	}
+	return err
+}
+
+// acquire waits for the query limit of a call made with ctx (see
+// querylimit). Only calls of traced API requests are limited; those of
+// background services and health checks are not, nor calls whose weight
+// was taken in advance with reserve.
+func (db *DB) acquire(ctx context.Context) (func(), error) {
+	t := querylog.FromContext(ctx)
+	if t == nil || querylimit.Reserved(ctx) {
+		return func() {}, nil
+	}
+	return db.Limits.Acquire(ctx, t.Key, querylimit.ClassFrom(ctx))
+}
+
+// reserve takes n units of the budget of class c at once for calls that run
+// together; they must be made with querylimit.WithReserved. It returns a nil
+// permit when the calls are not limited.
+func (db *DB) reserve(ctx context.Context, c querylimit.Class, n int) (*querylimit.Permit, error) {
+	t := querylog.FromContext(ctx)
+	if t == nil {
+		return nil, nil
+	}
+	return db.Limits.AcquireN(ctx, t.Key, c, n)
+}
+
+// record reports a finished call to the query recorder.
+func (db *DB) record(ctx context.Context, query string, start time.Time, rows int64, err error) {
+	db.Queries.Query(ctx, query, time.Since(start), rows, err)
+}
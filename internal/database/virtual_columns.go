@@ -0,0 +1,37 @@
+package database
+
+// Virtual columns are derived from real SystemEvents columns at query time.
+// They appear in AvailableColumns and can be used wherever a real column can
+// (meta values, filters, grouping) by substituting their SQL expression,
+// which is provided by the dialect:
+//
+//	Severity     Priority modulo 8; works for legacy (Priority = Severity)
+//	             and modern (Priority = Facility*8 + Severity) rows
+//	ProgramName  SysLogTag without PID and trailing colon: "sshd[1234]:" → "sshd"
+//	ProcessID    the PID in the brackets of SysLogTag, NULL without one
+var virtualColumns = []string{"Severity", "ProgramName", "ProcessID"}
+
+// ColumnExpr returns the SQL expression for a column: the expression for a
+// virtual column, or the column name itself for a real one.
+// The caller must have validated column with IsValidColumn.
+func (db *DB) ColumnExpr(column string) string {
+	switch column {
+	case "Severity":
+		return db.Dialect.SeverityExpr()
+	case "ProgramName":
+		return db.Dialect.programNameExpr()
+	case "ProcessID":
+		return db.Dialect.processIDExpr()
+	}
+	return column
+}
+
+// IsVirtualColumn reports whether column is derived rather than stored.
+func IsVirtualColumn(column string) bool {
+	for _, vc := range virtualColumns {
+		if vc == column {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/querylimit"
+)
+
+// CountsByColumn returns the number of entries per distinct value of column
+// received in the half-open interval [start, end).
+// NULL values are skipped. Virtual columns are grouped by their expression.
+func (db *DB) CountsByColumn(column string, start, end time.Time) (map[string]int, error) {
+	expr := db.ColumnExpr(column)
+	query := fmt.Sprintf(
+		"SELECT %s AS k, COUNT(*) FROM SystemEvents WHERE ReceivedAt >= ? AND ReceivedAt < ? AND %s IS NOT NULL GROUP BY k",
+		expr, expr,
+	)
+	rows, err := db.Query(query, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("volume query failed: %v", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var key string
+		var n int
+		if err := rows.Scan(&key, &n); err != nil {
+			continue
+		}
+		counts[key] += n
+	}
+	return counts, rows.Err()
+}
+
+// CountsWhere returns the number of entries matching the WHERE clause per
+// distinct value of column. NULL values are skipped.
+func (db *DB) CountsWhere(ctx context.Context, column, whereClause string, args []interface{}) (map[string]int64, error) {
+	expr := db.ColumnExpr(column)
+	query := fmt.Sprintf(
+		"SELECT %s AS k, COUNT(*) FROM SystemEvents WHERE (%s) AND %s IS NOT NULL GROUP BY k",
+		expr, whereClause, expr,
+	)
+	rows, err := db.QueryContext(querylimit.WithClass(ctx, querylimit.Count), query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("count query failed: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var key string
+		var n int64
+		if err := rows.Scan(&key, &n); err != nil {
+			return nil, fmt.Errorf("count scan failed: %v", err)
+		}
+		counts[key] += n
+	}
+	return counts, rows.Err()
+}
+
+// TimeCounts returns the number of entries matching the WHERE clause per
+// time bucket. The database groups the rows by the start of their minute,
+// hour or day (unit) in local time; bucket then maps each group start to
+// the bucket start in Unix seconds, so that every dialect and the rollups
+// agree on the bucket boundaries. unit must not be coarser than the
+// buckets, and must be "minute" when hours do not start at a bucket
+// boundary (time zones with a half-hour offset).
+func (db *DB) TimeCounts(ctx context.Context, whereClause string, args []interface{}, unit string, bucket func(time.Time) int64) (map[int64]int64, error) {
+	expr, epoch := db.Dialect.timeBucketExpr(unit)
+	query := fmt.Sprintf(
+		"SELECT %s AS b, COUNT(*) FROM SystemEvents WHERE (%s) AND ReceivedAt IS NOT NULL GROUP BY b",
+		expr, whereClause,
+	)
+	rows, err := db.QueryContext(querylimit.WithClass(ctx, querylimit.Count), query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("histogram query failed: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[int64]int64)
+	for rows.Next() {
+		var (
+			start time.Time
+			n     int64
+		)
+		if epoch {
+			var sec int64
+			if err := rows.Scan(&sec, &n); err != nil {
+				return nil, fmt.Errorf("histogram scan failed: %v", err)
+			}
+			start = time.Unix(sec, 0)
+		} else {
+			var text sql.NullString
+			if err := rows.Scan(&text, &n); err != nil {
+				return nil, fmt.Errorf("histogram scan failed: %v", err)
+			}
+			if start, err = time.ParseInLocation(timeBucketFormat, text.String, time.Local); err != nil {
+				return nil, fmt.Errorf("histogram scan failed: %v", err)
+			}
+		}
+		counts[bucket(start)] += n
+	}
+	return counts, rows.Err()
+}
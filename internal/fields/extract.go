@@ -0,0 +1,171 @@
+// Package fields extracts structured fields from log messages.
+//
+// Three formats are recognised, in this order:
+//
+//   - RFC 5424 structured data at the start of the message:
+//     [exampleSDID@32473 iut="3" eventSource="App"] → iut=3, eventSource=App
+//   - a JSON object, either the whole message or following a prefix such as
+//     "@cee:"; nested objects are flattened with dots (http.status)
+//   - key=value pairs anywhere in the message; values may be double-quoted
+//
+// Values that look like integers or decimals are returned as int64 or
+// float64, "true"/"false" as bool, everything else as string. When the same
+// key appears twice the first occurrence wins.
+package fields
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxFields caps the number of fields extracted from one message so a
+// pathological message cannot blow up the response size.
+const maxFields = 64
+
+// kvPattern matches key=value and key="quoted value" pairs.
+var kvPattern = regexp.MustCompile(`(?:^|[\s,;])([A-Za-z_][A-Za-z0-9_.\-]*)=("(?:[^"\\]|\\.)*"|[^\s,;"]+)`)
+
+// sdParamPattern matches PARAM-NAME="PARAM-VALUE" inside an SD-ELEMENT.
+var sdParamPattern = regexp.MustCompile(`([^\s=\]"]+)="((?:[^"\\]|\\.)*)"`)
+
+// Extract returns the structured fields found in msg, or nil if there are none.
+func Extract(msg string) map[string]any {
+	out := make(map[string]any)
+
+	rest := extractStructuredData(msg, out)
+	if !extractJSON(rest, out) {
+		extractKeyValues(rest, out)
+	}
+
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// extractStructuredData parses leading RFC 5424 SD-ELEMENTs and returns the
+// remainder of the message.
+func extractStructuredData(msg string, out map[string]any) string {
+	rest := strings.TrimLeft(msg, " ")
+	for strings.HasPrefix(rest, "[") {
+		end := sdElementEnd(rest)
+		if end < 0 {
+			break
+		}
+		element := rest[1:end]
+		// The SD-ID is the first token; params follow.
+		if sp := strings.IndexByte(element, ' '); sp > 0 {
+			for _, m := range sdParamPattern.FindAllStringSubmatch(element[sp+1:], -1) {
+				set(out, m[1], typed(unescapeSD(m[2])))
+			}
+		}
+		rest = strings.TrimLeft(rest[end+1:], " ")
+	}
+	return rest
+}
+
+// sdElementEnd returns the index of the "]" closing the SD-ELEMENT at the
+// start of s, honouring escaped characters inside quoted values.
+func sdElementEnd(s string) int {
+	inQuotes := false
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			inQuotes = !inQuotes
+		case ']':
+			if !inQuotes {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// unescapeSD removes the RFC 5424 escapes (\" \\ \]) from a PARAM-VALUE.
+func unescapeSD(v string) string {
+	if !strings.Contains(v, `\`) {
+		return v
+	}
+	r := strings.NewReplacer(`\"`, `"`, `\\`, `\`, `\]`, `]`)
+	return r.Replace(v)
+}
+
+// extractJSON decodes the first JSON object in msg. Returns true on success.
+func extractJSON(msg string, out map[string]any) bool {
+	start := strings.IndexByte(msg, '{')
+	if start < 0 || !strings.HasSuffix(strings.TrimSpace(msg), "}") {
+		return false
+	}
+
+	dec := json.NewDecoder(bytes.NewReader([]byte(msg[start:])))
+	dec.UseNumber()
+	var obj map[string]any
+	if err := dec.Decode(&obj); err != nil {
+		return false
+	}
+	flatten("", obj, out)
+	return true
+}
+
+// flatten copies obj into out, joining nested keys with dots.
+func flatten(prefix string, obj map[string]any, out map[string]any) {
+	for k, v := range obj {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch val := v.(type) {
+		case map[string]any:
+			flatten(key, val, out)
+		case json.Number:
+			set(out, key, typed(val.String()))
+		default:
+			set(out, key, val)
+		}
+	}
+}
+
+// extractKeyValues collects key=value pairs from msg.
+func extractKeyValues(msg string, out map[string]any) {
+	for _, m := range kvPattern.FindAllStringSubmatch(msg, -1) {
+		v := m[2]
+		if strings.HasPrefix(v, `"`) {
+			if unq, err := strconv.Unquote(v); err == nil {
+				set(out, m[1], unq)
+				continue
+			}
+			v = strings.Trim(v, `"`)
+		}
+		set(out, m[1], typed(v))
+	}
+}
+
+// set stores v under key unless the key already exists or the cap is reached.
+func set(out map[string]any, key string, v any) {
+	if _, exists := out[key]; exists || len(out) >= maxFields {
+		return
+	}
+	out[key] = v
+}
+
+// typed converts s into int64, float64 or bool when it parses as one.
+func typed(s string) any {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !strings.ContainsAny(s, "xXnN") {
+		return f
+	}
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return s
+}
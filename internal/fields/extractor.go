@@ -0,0 +1,109 @@
+package fields
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Parser is a named Grok-style parser for the messages of one program.
+type Parser struct {
+	Name     string
+	MatchTag string // ProgramName the parser applies to (exact match)
+	Pattern  string // e.g. "%{IP:client} .* %{INT:status}"
+}
+
+// FieldInfo describes a field produced by a configured parser.
+type FieldInfo struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"` // "int", "float" or "string"
+	Parser   string `json:"parser"`
+	MatchTag string `json:"match_tag"`
+}
+
+type compiledParser struct {
+	Parser
+	grok *grok
+}
+
+// Extractor runs the configured parsers and the generic extraction.
+// A nil *Extractor only performs the generic extraction.
+type Extractor struct {
+	byTag map[string][]*compiledParser
+	infos []FieldInfo
+}
+
+// NewExtractor compiles the given parsers.
+func NewExtractor(parsers []Parser) (*Extractor, error) {
+	x := &Extractor{byTag: make(map[string][]*compiledParser)}
+	for _, p := range parsers {
+		g, err := compileGrok(p.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("parser %q: %w", p.Name, err)
+		}
+		if len(g.captures) == 0 {
+			return nil, fmt.Errorf("parser %q: pattern captures no fields", p.Name)
+		}
+		cp := &compiledParser{Parser: p, grok: g}
+		x.byTag[p.MatchTag] = append(x.byTag[p.MatchTag], cp)
+		for _, c := range g.captures {
+			x.infos = append(x.infos, FieldInfo{
+				Name: c.name, Type: c.vtype, Parser: p.Name, MatchTag: p.MatchTag,
+			})
+		}
+	}
+	sort.SliceStable(x.infos, func(i, j int) bool { return x.infos[i].Name < x.infos[j].Name })
+	return x, nil
+}
+
+// Extract returns the fields of a message written by program.
+// Fields captured by the first matching parser take precedence over fields
+// found by the generic extraction.
+func (x *Extractor) Extract(program, msg string) map[string]any {
+	generic := Extract(msg)
+	if x == nil {
+		return generic
+	}
+
+	var out map[string]any
+	for _, p := range x.byTag[program] {
+		if out = p.grok.match(msg); out != nil {
+			break
+		}
+	}
+	if out == nil {
+		return generic
+	}
+	for k, v := range generic {
+		set(out, k, v)
+	}
+	return out
+}
+
+// Fields lists the fields the configured parsers can produce, sorted by name.
+func (x *Extractor) Fields() []FieldInfo {
+	if x == nil {
+		return []FieldInfo{}
+	}
+	return x.infos
+}
+
+// HasField reports whether any parser produces a field called name.
+func (x *Extractor) HasField(name string) bool {
+	return len(x.TagsForField(name)) > 0
+}
+
+// TagsForField returns the program names whose parsers produce name.
+func (x *Extractor) TagsForField(name string) []string {
+	if x == nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	var tags []string
+	for _, fi := range x.infos {
+		if fi.Name == name && !seen[fi.MatchTag] {
+			seen[fi.MatchTag] = true
+			tags = append(tags, fi.MatchTag)
+		}
+	}
+	return tags
+}
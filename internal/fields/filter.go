@@ -0,0 +1,271 @@
+package fields
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// QueryPrefix marks field filters in a query string: ?field.user=alice
+const QueryPrefix = "field."
+
+// Op is a comparison operator of a field filter.
+type Op string
+
+const (
+	OpEq  Op = "="
+	OpNe  Op = "!="
+	OpGt  Op = ">"
+	OpGte Op = ">="
+	OpLt  Op = "<"
+	OpLte Op = "<="
+)
+
+// Filter is a single condition on an extracted field.
+type Filter struct {
+	Key   string // field name without the "field." prefix
+	Op    Op
+	Value string
+}
+
+// keyPattern restricts field names to characters that are safe to embed in a
+// JSON path and a regular expression.
+var keyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.\-]*$`)
+
+// ParseQuery collects the field filters from a URL query.
+//
+// Because "field.status>=500" is split by the URL parser into the key
+// "field.status>" and the value "500", the operator is recovered from the
+// last character of the key (">", "<" or "!"). Strict comparisons and
+// explicit operators can also be given as a value prefix:
+//
+//	field.user=alice      → user = alice
+//	field.status>=500     → status >= 500
+//	field.status<=399     → status <= 399
+//	field.level!=debug    → level != debug
+//	field.status=>499     → status > 499
+//	field.latency=<0.5    → latency < 0.5
+func ParseQuery(query url.Values) ([]Filter, error) {
+	keys := make([]string, 0)
+	for k := range query {
+		if strings.HasPrefix(k, QueryPrefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys) // deterministic SQL for the meta cache
+
+	var result []Filter
+	for _, k := range keys {
+		name := strings.TrimPrefix(k, QueryPrefix)
+		for _, v := range query[k] {
+			f, err := parseFilter(name, v)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, f)
+		}
+	}
+	return result, nil
+}
+
+func parseFilter(name, value string) (Filter, error) {
+	op := OpEq
+	switch {
+	case strings.HasSuffix(name, ">"):
+		op, name = OpGte, strings.TrimSuffix(name, ">")
+	case strings.HasSuffix(name, "<"):
+		op, name = OpLte, strings.TrimSuffix(name, "<")
+	case strings.HasSuffix(name, "!"):
+		op, name = OpNe, strings.TrimSuffix(name, "!")
+	default:
+		for _, candidate := range []Op{OpGte, OpLte, OpNe, OpGt, OpLt} {
+			if strings.HasPrefix(value, string(candidate)) {
+				op, value = candidate, strings.TrimPrefix(value, string(candidate))
+				break
+			}
+		}
+	}
+
+	if !keyPattern.MatchString(name) {
+		return Filter{}, fmt.Errorf("invalid field name %q", name)
+	}
+	if op != OpEq && op != OpNe {
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return Filter{}, fmt.Errorf("field.%s: %q is not a number (required for %s)", name, value, op)
+		}
+	}
+	return Filter{Key: name, Op: op, Value: value}, nil
+}
+
+// numeric reports whether the filter compares numbers.
+func (f Filter) numeric() bool {
+	return f.Op != OpEq && f.Op != OpNe
+}
+
+// SQL returns a MySQL condition on the Message column that selects a
+// superset of the rows the filter matches, or "" when the filter cannot be
+// narrowed in SQL.
+//
+// Messages that are a plain JSON object are compared exactly via JSON_EXTRACT,
+// under every path the field may come from (see jsonPaths). All others are
+// pre-selected with REGEXP (see Regexp); Match then removes the false
+// positives after the query.
+func (f Filter) SQL() (string, []interface{}) {
+	re := f.Regexp()
+	if re == "" {
+		return "", nil
+	}
+	paths := jsonPaths(f.Key)
+	if paths == nil {
+		return "Message REGEXP ?", []interface{}{re}
+	}
+
+	jsonValue := "CASE WHEN JSON_VALID(Message) THEN JSON_UNQUOTE(JSON_EXTRACT(Message, ?)) END"
+	num, isNum := number(f.Value)
+	var (
+		conds []string
+		args  []interface{}
+	)
+	for _, path := range paths {
+		switch {
+		case f.numeric():
+			conds = append(conds, fmt.Sprintf("CAST(%s AS DECIMAL(30,6)) %s ?", jsonValue, f.Op))
+			args = append(args, path, num)
+		case isNum:
+			// Match compares numbers numerically: status=500 matches 500.0.
+			conds = append(conds, fmt.Sprintf("%s = ? OR CAST(%s AS DECIMAL(30,6)) = ?", jsonValue, jsonValue))
+			args = append(args, path, f.Value, path, num)
+		default:
+			conds = append(conds, jsonValue+" = ?")
+			args = append(args, path, f.Value)
+		}
+	}
+	conds = append(conds, "(NOT JSON_VALID(Message) AND Message REGEXP ?)")
+	return "(" + strings.Join(conds, " OR ") + ")", append(args, re)
+}
+
+// Regexp returns a POSIX regular expression matching every message that may
+// satisfy the filter (key=value, SD params, JSON "key": value), or "" when
+// no message can be excluded. Numeric filters, and equality with a number,
+// which Match compares numerically, only require the key.
+func (f Filter) Regexp() string {
+	if f.Op == OpNe {
+		// Rows without the field match "!=", so nothing can be excluded.
+		return ""
+	}
+
+	// A nested JSON key appears as its last part, a JSON key with dots as
+	// written: http.status may be "status" in {"http": {…}} or "http.status".
+	parts := strings.Split(f.Key, ".")
+	keys := make([]string, len(parts))
+	for i := range parts {
+		keys[i] = regexp.QuoteMeta(strings.Join(parts[i:], "."))
+	}
+	keyRe := `(^|[^[:alnum:]_.-])"?(` + strings.Join(keys, "|") + `)"?[[:space:]]*[=:]`
+	if _, isNum := number(f.Value); f.numeric() || isNum {
+		return keyRe
+	}
+	return keyRe + `[[:space:]]*"?` + regexp.QuoteMeta(f.Value) + `("|[^[:alnum:]_.-]|$)`
+}
+
+// maxJSONParts bounds the dotted parts of a field that SQL compares via
+// JSON paths (2^(n-1) of them); longer names are pre-selected with REGEXP.
+const maxJSONParts = 4
+
+// jsonPaths returns the quoted MySQL JSON paths of a dotted field name, or
+// nil when it has more than maxJSONParts parts. Extract joins nested keys
+// with dots, and a JSON key may contain dots itself, so every grouping of
+// the parts is a candidate: http.status → $."http.status", $."http"."status"
+func jsonPaths(key string) []string {
+	parts := strings.Split(key, ".")
+	if len(parts) > maxJSONParts {
+		return nil
+	}
+	var paths []string
+	// Bit i of split set: a new key starts after parts[i].
+	for split := 0; split < 1<<(len(parts)-1); split++ {
+		path, start := "$", 0
+		for i := range parts {
+			if i == len(parts)-1 || split&(1<<i) != 0 {
+				path += `."` + strings.Join(parts[start:i+1], ".") + `"`
+				start = i + 1
+			}
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// number parses a filter value as a finite number.
+func number(value string) (float64, bool) {
+	n, err := strconv.ParseFloat(value, 64)
+	return n, err == nil && !math.IsInf(n, 0) && !math.IsNaN(n)
+}
+
+// Match reports whether the extracted fields satisfy the filter.
+func (f Filter) Match(fields map[string]any) bool {
+	v, ok := fields[f.Key]
+	if !ok {
+		return f.Op == OpNe
+	}
+
+	if f.numeric() {
+		x, ok := toFloat(v)
+		if !ok {
+			return false
+		}
+		want, _ := strconv.ParseFloat(f.Value, 64)
+		switch f.Op {
+		case OpGt:
+			return x > want
+		case OpGte:
+			return x >= want
+		case OpLt:
+			return x < want
+		case OpLte:
+			return x <= want
+		}
+		return false
+	}
+
+	equal := fmt.Sprint(v) == f.Value
+	if !equal {
+		// Compare numerically so field.status=500 matches 500.0.
+		if x, ok := toFloat(v); ok {
+			if want, err := strconv.ParseFloat(f.Value, 64); err == nil {
+				equal = x == want
+			}
+		}
+	}
+	if f.Op == OpNe {
+		return !equal
+	}
+	return equal
+}
+
+// MatchAll reports whether fields satisfy every filter.
+func MatchAll(filters []Filter, fields map[string]any) bool {
+	for _, f := range filters {
+		if !f.Match(fields) {
+			return false
+		}
+	}
+	return true
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,128 @@
+package fields
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The SQL pre-selection must keep every message that Match accepts.
+func TestFilterSQLSelectsMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		msg    string
+	}{
+		{"json integer", Filter{"status", OpEq, "500"}, `{"status":500}`},
+		{"json float equals integer", Filter{"status", OpEq, "500"}, `{"status":500.0}`},
+		{"json string number", Filter{"status", OpEq, "500"}, `{"status":"500"}`},
+		{"json string", Filter{"user", OpEq, "alice"}, `{"user":"alice"}`},
+		{"json nested key", Filter{"http.status", OpEq, "404"}, `{"http":{"status":404}}`},
+		{"json flat dotted key", Filter{"http.status", OpEq, "404"}, `{"http.status":404}`},
+		{"json flat dotted key, string", Filter{"a.b", OpEq, "x"}, `{"a.b":"x"}`},
+		{"json mixed dotted key", Filter{"a.b.c", OpEq, "x"}, `{"a":{"b.c":"x"}}`},
+		{"json flat dotted key, numeric", Filter{"http.status", OpGte, "400"}, `{"http.status":404}`},
+		{"key=value float equals integer", Filter{"status", OpEq, "500"}, `done status=500.0`},
+		{"key=value string", Filter{"user", OpEq, "alice"}, `login user=alice ok`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.filter.Match(Extract(tt.msg)) {
+				t.Fatalf("Match(%s) = false, the case is wrong", tt.msg)
+			}
+			if !mysqlSelects(t, tt.filter, tt.msg) {
+				t.Errorf("SQL of %+v drops %s", tt.filter, tt.msg)
+			}
+			if re := tt.filter.Regexp(); !regexp.MustCompile(re).MatchString(tt.msg) {
+				t.Errorf("Regexp %s drops %s", re, tt.msg)
+			}
+		})
+	}
+}
+
+func TestJSONPaths(t *testing.T) {
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{"status", []string{`$."status"`}},
+		{"http.status", []string{`$."http.status"`, `$."http"."status"`}},
+		{"a.b.c", []string{`$."a.b.c"`, `$."a"."b.c"`, `$."a.b"."c"`, `$."a"."b"."c"`}},
+		{"a.b.c.d.e", nil},
+	}
+	for _, tt := range tests {
+		if got := jsonPaths(tt.key); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("jsonPaths(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+// mysqlSelects evaluates the condition of f.SQL for msg the way MySQL
+// does, for the forms SQL generates.
+func mysqlSelects(t *testing.T, f Filter, msg string) bool {
+	t.Helper()
+	cond, args := f.SQL()
+	re := regexp.MustCompile(args[len(args)-1].(string))
+	dec := json.NewDecoder(strings.NewReader(msg))
+	dec.UseNumber() // keeps 500.0 as written, like JSON_UNQUOTE
+	var doc any
+	if dec.Decode(&doc) != nil {
+		return re.MatchString(msg)
+	}
+	if !strings.Contains(cond, "JSON_EXTRACT") {
+		return re.MatchString(msg)
+	}
+	want, _ := strconv.ParseFloat(f.Value, 64)
+	for _, path := range jsonPaths(f.Key) {
+		v, ok := extractPath(doc, path)
+		if !ok {
+			continue
+		}
+		got, err := strconv.ParseFloat(v, 64)
+		switch {
+		case f.numeric():
+			if err == nil && compare(got, f.Op, want) {
+				return true
+			}
+		case v == f.Value, err == nil && strings.Contains(cond, "CAST") && got == want:
+			return true
+		}
+	}
+	return false
+}
+
+// extractPath is JSON_UNQUOTE(JSON_EXTRACT(doc, path)) for the paths of
+// jsonPaths.
+func extractPath(doc any, path string) (string, bool) {
+	for _, key := range strings.Split(strings.TrimPrefix(path, `$."`), `"."`) {
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		if doc, ok = obj[strings.TrimSuffix(key, `"`)]; !ok {
+			return "", false
+		}
+	}
+	if s, ok := doc.(string); ok {
+		return s, true
+	}
+	b, _ := json.Marshal(doc)
+	return string(b), true
+}
+
+func compare(x float64, op Op, y float64) bool {
+	switch op {
+	case OpGt:
+		return x > y
+	case OpGte:
+		return x >= y
+	case OpLt:
+		return x < y
+	case OpLte:
+		return x <= y
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package fields
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// grokPatterns is the built-in pattern library. Entries may reference each
+// other with %{NAME}. All groups are non-capturing so that only the fields
+// named in a parser pattern produce captures.
+var grokPatterns = map[string]string{
+	"USERNAME":          `[a-zA-Z0-9._-]+`,
+	"USER":              `%{USERNAME}`,
+	"EMAILADDRESS":      `[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+`,
+	"INT":               `[+-]?[0-9]+`,
+	"POSINT":            `\b[1-9][0-9]*\b`,
+	"NONNEGINT":         `\b[0-9]+\b`,
+	"NUMBER":            `[+-]?(?:[0-9]+(?:\.[0-9]+)?|\.[0-9]+)`,
+	"BASE10NUM":         `%{NUMBER}`,
+	"WORD":              `\b\w+\b`,
+	"NOTSPACE":          `\S+`,
+	"SPACE":             `\s*`,
+	"DATA":              `.*?`,
+	"GREEDYDATA":        `.*`,
+	"QUOTEDSTRING":      `"(?:[^"\\]|\\.)*"`,
+	"UUID":              `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+	"MAC":               `(?:[A-Fa-f0-9]{2}[:-]){5}[A-Fa-f0-9]{2}`,
+	"IPV4":              `(?:(?:25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)\.){3}(?:25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)`,
+	"IPV6":              `(?:[0-9A-Fa-f]{0,4}:){2,7}[0-9A-Fa-f]{0,4}`,
+	"IP":                `(?:%{IPV6}|%{IPV4})`,
+	"HOSTNAME":          `\b[0-9A-Za-z][0-9A-Za-z-]{0,62}(?:\.[0-9A-Za-z][0-9A-Za-z-]{0,62})*\.?`,
+	"IPORHOST":          `(?:%{IP}|%{HOSTNAME})`,
+	"HOSTPORT":          `%{IPORHOST}:%{POSINT}`,
+	"PATH":              `(?:/[^\s]*)+`,
+	"URIPATH":           `(?:/[A-Za-z0-9$.+!*'(){},~:;=@#%&_\-]*)+`,
+	"URIPARAM":          `\?[A-Za-z0-9$.+!*'|(){},~@#%&/=:;_?\-\[\]<>]*`,
+	"URIPATHPARAM":      `%{URIPATH}(?:%{URIPARAM})?`,
+	"URI":               `[A-Za-z][A-Za-z0-9+.\-]*://\S+`,
+	"HTTPDATE":          `[0-9]{2}/[A-Za-z]{3}/[0-9]{4}:[0-9]{2}:[0-9]{2}:[0-9]{2} [+-][0-9]{4}`,
+	"TIMESTAMP_ISO8601": `[0-9]{4}-[0-9]{2}-[0-9]{2}[T ][0-9]{2}:[0-9]{2}(?::[0-9]{2}(?:[.,][0-9]+)?)?(?:Z|[+-][0-9]{2}:?[0-9]{2})?`,
+	"LOGLEVEL":          `(?i:trace|debug|info|notice|warn(?:ing)?|err(?:or)?|crit(?:ical)?|fatal|alert|emerg(?:ency)?)`,
+}
+
+// defaultTypes is the value type of fields captured with a pattern when the
+// parser does not name one explicitly.
+var defaultTypes = map[string]string{
+	"INT": "int", "POSINT": "int", "NONNEGINT": "int",
+	"NUMBER": "float", "BASE10NUM": "float",
+}
+
+// grokRef matches %{PATTERN}, %{PATTERN:field} and %{PATTERN:field:type}.
+var grokRef = regexp.MustCompile(`%\{(\w+)(?::([A-Za-z_][A-Za-z0-9_.\-]*))?(?::(int|float|string))?\}`)
+
+// capture describes one named field of a compiled Grok pattern.
+type capture struct {
+	name  string
+	vtype string // "int", "float" or "string"
+}
+
+// grok is a compiled Grok pattern.
+type grok struct {
+	re       *regexp.Regexp
+	captures []capture // index i corresponds to submatch group i+1
+}
+
+// compileGrok expands the %{…} references of pattern and compiles it.
+func compileGrok(pattern string) (*grok, error) {
+	g := &grok{}
+	expanded, err := expandGrok(pattern, g, 0)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	if re.NumSubexp() != len(g.captures) {
+		return nil, fmt.Errorf("pattern must not contain capturing groups; use (?:…) or %%{PATTERN:field}")
+	}
+	g.re = re
+	return g, nil
+}
+
+// expandGrok replaces pattern references recursively. Only references at the
+// top level (depth 0) may capture fields.
+func expandGrok(pattern string, g *grok, depth int) (string, error) {
+	if depth > 10 {
+		return "", fmt.Errorf("pattern references nested too deeply")
+	}
+
+	var firstErr error
+	out := grokRef.ReplaceAllStringFunc(pattern, func(ref string) string {
+		m := grokRef.FindStringSubmatch(ref)
+		name, field, vtype := m[1], m[2], m[3]
+
+		def, ok := grokPatterns[name]
+		if !ok {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("unknown pattern %%{%s}", name)
+			}
+			return ""
+		}
+		inner, err := expandGrok(def, g, depth+1)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return ""
+		}
+		if field == "" || depth > 0 {
+			return "(?:" + inner + ")"
+		}
+		if vtype == "" {
+			vtype = defaultTypes[name]
+		}
+		if vtype == "" {
+			vtype = "string"
+		}
+		g.captures = append(g.captures, capture{name: field, vtype: vtype})
+		return "(" + inner + ")"
+	})
+	if firstErr != nil {
+		return "", firstErr
+	}
+	return out, nil
+}
+
+// match applies the pattern to msg and returns the typed captures.
+func (g *grok) match(msg string) map[string]any {
+	m := g.re.FindStringSubmatchIndex(msg)
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]any, len(g.captures))
+	for i, c := range g.captures {
+		start, end := m[2*(i+1)], m[2*(i+1)+1]
+		if start < 0 {
+			continue // optional group did not participate
+		}
+		raw := msg[start:end]
+		switch c.vtype {
+		case "int":
+			if v, err := strconv.ParseInt(raw, 10, 64); err == nil {
+				out[c.name] = v
+				continue
+			}
+		case "float":
+			if v, err := strconv.ParseFloat(raw, 64); err == nil {
+				out[c.name] = v
+				continue
+			}
+		}
+		out[c.name] = strings.Trim(raw, `"`)
+	}
+	return out
+}
@@ -0,0 +1,417 @@
+// Package filesource indexes rsyslog text files (omfile output such as
+// /var/log/syslog) into the SystemEvents table of a local SQLite file, so
+// they can be queried through the same API as an rsyslog database.
+//
+// The index is an ordinary rsyslog-style SQLite database: rows are ordered by
+// ReceivedAt and indexed by host, tag and priority (see database.Dialect).
+// The read position of every file is stored in the index itself.
+package filesource
+
+import (
+	"bufio"
+	"compress/gzip"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/database"
+	"github.com/phil-bot/rsyslox/internal/syslog"
+)
+
+// batchSize is the number of lines inserted per transaction.
+const batchSize = 1000
+
+// maxLineLength bounds a single log line; longer lines are truncated.
+const maxLineLength = 64 * 1024
+
+// errStopped ends a long read when the tailer stops; the saved position
+// resumes it.
+var errStopped = errors.New("file source stopped")
+
+// headLength bounds the first line stored to recognise a generation.
+const headLength = 256
+
+// stateSchema stores the read position of every tailed file: the inode of
+// the generation being read, the offset in it (uncompressed for .gz files)
+// and its first line, which finds the generation again once it has been
+// compressed under a new inode.
+const stateSchema = `
+	CREATE TABLE IF NOT EXISTS rsyslox_file_state (
+		Path   TEXT PRIMARY KEY,
+		Inode  INTEGER NOT NULL,
+		Offset INTEGER NOT NULL,
+		Head   TEXT NOT NULL DEFAULT ''
+	)`
+
+// Tailer follows a set of log files and appends new lines to the index.
+type Tailer struct {
+	db     *database.DB
+	cfg    Config
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// Config holds the file source configuration.
+type Config struct {
+	// Files are the log files to follow, e.g. /var/log/syslog.
+	Files []string
+
+	// Interval is how often the files are checked for new lines.
+	Interval time.Duration
+}
+
+// position is the stored read position of one file.
+type position struct {
+	inode  uint64
+	offset int64
+	head   string // first line of the generation, at most headLength bytes
+}
+
+// New creates a new Tailer writing to the index db.
+func New(db *database.DB, cfg Config) *Tailer {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 2 * time.Second
+	}
+	return &Tailer{
+		db:     db,
+		cfg:    cfg,
+		stopCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
+	}
+}
+
+// Start creates the state table and launches the tail loop in a background
+// goroutine. Files seen for the first time are indexed from their oldest
+// rotated generation, including gzip-compressed ones.
+func (t *Tailer) Start() error {
+	if _, err := t.db.Exec(stateSchema); err != nil {
+		return fmt.Errorf("failed to create file state table: %w", err)
+	}
+
+	log.Printf("✓ File source started (%d files, interval: %s)", len(t.cfg.Files), t.cfg.Interval)
+
+	go t.run()
+	return nil
+}
+
+// Stop signals the tail loop to stop and waits for the current batch.
+func (t *Tailer) Stop() {
+	close(t.stopCh)
+	<-t.doneCh
+}
+
+// run is the main tail loop.
+func (t *Tailer) run() {
+	defer close(t.doneCh)
+
+	t.poll()
+	ticker := time.NewTicker(t.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.poll()
+		case <-t.stopCh:
+			log.Println("File source stopped")
+			return
+		}
+	}
+}
+
+// poll reads new lines from every file.
+func (t *Tailer) poll() {
+	for _, path := range t.cfg.Files {
+		if err := t.follow(path); errors.Is(err, errStopped) {
+			return
+		} else if err != nil {
+			log.Printf("⚠️  File source: %s: %v", path, err)
+		}
+	}
+}
+
+// follow brings the index up to date with one file.
+func (t *Tailer) follow(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil // between rotation and the first write of the new file
+		}
+		return err
+	}
+	inode := inodeOf(info)
+
+	pos, known, err := t.loadPosition(path)
+	if err != nil {
+		return err
+	}
+
+	clock := &lineClock{}
+	switch {
+	case !known || pos.inode != inode || (pos.offset > 0 && fileHead(path) != pos.head):
+		// New, rotated (the new file may reuse the inode of a deleted
+		// one), or a backfill was interrupted: index the rotated
+		// generations first, then start the file.
+		if err := t.readGenerations(path, pos, known, clock); err != nil {
+			return err
+		}
+		pos = position{}
+	case info.Size() < pos.offset:
+		// Truncated in place (copytruncate).
+		pos = position{}
+	case info.Size() == pos.offset:
+		return nil
+	}
+
+	_, err = t.readFrom(path, path, pos, false, clock)
+	return err
+}
+
+// readGenerations indexes the rotated generations of path: all of them,
+// oldest first, when path is new; otherwise the rest of the generation at
+// pos and the newer ones. The position is saved as they are read, so an
+// interrupted run resumes where it stopped.
+func (t *Tailer) readGenerations(path string, pos position, known bool, clock *lineClock) error {
+	gens := rotated(path)
+	if known {
+		i := findGeneration(gens, pos)
+		if i < 0 {
+			log.Printf("⚠️  File source: %s: the generation read last is gone, continuing with the current file", path)
+			return nil
+		}
+		gens = gens[i:]
+	} else {
+		pos = position{}
+	}
+
+	for i, file := range gens {
+		if i > 0 {
+			pos = position{}
+		}
+		n, err := t.readFrom(path, file, pos, true, clock)
+		if err != nil {
+			return fmt.Errorf("failed to index %s: %w", file, err)
+		}
+		if n > 0 {
+			log.Printf("✓ File source: indexed %d lines from %s", n, file)
+		}
+	}
+	return nil
+}
+
+// readFrom indexes the lines of file from pos.offset on, decompressing .gz
+// files, and stores the new position under key. A line without newline is
+// still being written and is read next time, unless whole is set for a
+// rotated generation. It returns the number of indexed lines.
+func (t *Tailer) readFrom(key, file string, pos position, whole bool, clock *lineClock) (int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	pos.inode = inodeOf(info)
+
+	var r *bufio.Reader
+	if strings.HasSuffix(file, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return 0, err
+		}
+		defer gz.Close()
+		r = bufio.NewReaderSize(gz, 64*1024)
+		if _, err := io.CopyN(io.Discard, r, pos.offset); err != nil {
+			return 0, fmt.Errorf("skipping to offset %d: %w", pos.offset, err)
+		}
+	} else {
+		if _, err := f.Seek(pos.offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+		r = bufio.NewReaderSize(f, 64*1024)
+	}
+
+	batch := make([]syslog.Message, 0, batchSize)
+	total := 0
+	flush := func() error {
+		if err := t.db.InsertEvents(batch); err != nil {
+			return err
+		}
+		total += len(batch)
+		batch = batch[:0]
+		return t.savePosition(key, pos)
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && (!whole || line == "") {
+			if err != io.EOF {
+				return total, err
+			}
+			break
+		}
+		if pos.offset == 0 {
+			pos.head = headOf(line)
+		}
+		pos.offset += int64(len(line))
+		if msg, ok := clock.parse(line); ok {
+			batch = append(batch, msg)
+		}
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return total, err
+			}
+			select {
+			case <-t.stopCh:
+				return total, errStopped
+			default:
+			}
+		}
+	}
+	return total, flush()
+}
+
+// lineClock dates the lines of files read in order. Lines without a
+// timestamp get the time of the previous line, or the current time for the
+// first. RFC 3164 timestamps, which have no year, get the year that puts
+// them after the previous line, or at most a day before it, but never more
+// than a day into the future.
+type lineClock struct {
+	last time.Time
+}
+
+// parse parses one line. Files carry no receive time, so the reported time
+// is used for both.
+func (c *lineClock) parse(line string) (syslog.Message, bool) {
+	if len(line) > maxLineLength {
+		line = line[:maxLineLength]
+	}
+	now := time.Now()
+	at, ref := now, now
+	if !c.last.IsZero() {
+		at = c.last
+		// ParseWithYear places the line in (ref+1d-1y, ref+1d].
+		if r := c.last.AddDate(1, 0, -2); r.Before(now) {
+			ref = r
+		}
+	}
+	msg, ok := syslog.ParseWithYear(line, at, ref)
+	if ok {
+		msg.ReceivedAt = msg.DeviceReportedTime
+		c.last = msg.DeviceReportedTime
+	}
+	return msg, ok
+}
+
+func (t *Tailer) loadPosition(path string) (position, bool, error) {
+	var pos position
+	err := t.db.QueryRow("SELECT Inode, Offset, Head FROM rsyslox_file_state WHERE Path = ?", path).
+		Scan(&pos.inode, &pos.offset, &pos.head)
+	if errors.Is(err, sql.ErrNoRows) {
+		return position{}, false, nil
+	}
+	return pos, err == nil, err
+}
+
+func (t *Tailer) savePosition(path string, pos position) error {
+	_, err := t.db.Exec(`
+		INSERT INTO rsyslox_file_state (Path, Inode, Offset, Head) VALUES (?, ?, ?, ?)
+		ON CONFLICT (Path) DO UPDATE SET Inode = excluded.Inode, Offset = excluded.Offset, Head = excluded.Head`,
+		path, pos.inode, pos.offset, pos.head)
+	return err
+}
+
+// rotated returns the rotated generations of path (path.1, path.2.gz,
+// path-20260101, …) sorted from oldest to newest by modification time.
+func rotated(path string) []string {
+	var files []string
+	for _, pattern := range []string{path + ".*", path + "-*"} {
+		matches, _ := filepath.Glob(pattern)
+		files = append(files, matches...)
+	}
+	mtimes := make(map[string]time.Time, len(files))
+	kept := files[:0]
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		mtimes[f] = info.ModTime()
+		kept = append(kept, f)
+	}
+	sort.Slice(kept, func(i, j int) bool { return mtimes[kept[i]].Before(mtimes[kept[j]]) })
+	return kept
+}
+
+// findGeneration returns the index in gens of the generation at pos: the
+// uncompressed file with its inode and first line or, once it has been
+// compressed or copied (copytruncate), the newest file starting with its
+// first line. It returns -1 when the generation is gone.
+func findGeneration(gens []string, pos position) int {
+	for i, f := range gens {
+		if strings.HasSuffix(f, ".gz") {
+			continue
+		}
+		if info, err := os.Stat(f); err == nil && inodeOf(info) == pos.inode &&
+			(pos.offset == 0 || fileHead(f) == pos.head) {
+			return i
+		}
+	}
+	if pos.head == "" {
+		return -1
+	}
+	for i := len(gens) - 1; i >= 0; i-- {
+		if fileHead(gens[i]) == pos.head {
+			return i
+		}
+	}
+	return -1
+}
+
+// fileHead returns the first line of file as headOf does, decompressing .gz
+// files, or "".
+func fileHead(file string) string {
+	f, err := os.Open(file)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(file, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return ""
+		}
+		defer gz.Close()
+		r = gz
+	}
+	line, _ := bufio.NewReader(io.LimitReader(r, headLength)).ReadString('\n')
+	return headOf(line)
+}
+
+// headOf returns the first line of a generation as it is stored.
+func headOf(line string) string {
+	line = strings.TrimRight(line, "\r\n")
+	if len(line) > headLength {
+		line = line[:headLength]
+	}
+	return line
+}
+
+func inodeOf(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Ino
+	}
+	return 0
+}
@@ -4,19 +4,44 @@ import (
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/phil-bot/rsyslox/internal/fields"
 )
 
 // Builder constructs SQL WHERE clauses and arguments for filtering.
 type Builder struct {
 	conditions []string
 	args       []interface{}
+	dialect    Dialect
+}
+
+// Dialect supplies the database-specific parts of a WHERE clause.
+// database.Dialect implements it.
+type Dialect interface {
+	SeverityExpr() string
+	MessageSearch(term string) (string, []interface{})
+}
+
+// mysqlDialect is the dialect of builders created with New.
+type mysqlDialect struct{}
+
+func (mysqlDialect) SeverityExpr() string { return "Priority MOD 8" }
+
+func (mysqlDialect) MessageSearch(term string) (string, []interface{}) {
+	return "Message LIKE ?", []interface{}{"%" + term + "%"}
 }
 
-// New creates a new filter builder.
+// New creates a new filter builder producing MySQL conditions.
 func New() *Builder {
+	return NewFor(mysqlDialect{})
+}
+
+// NewFor creates a new filter builder for the given dialect.
+func NewFor(d Dialect) *Builder {
 	return &Builder{
 		conditions: []string{},
 		args:       []interface{}{},
+		dialect:    d,
 	}
 }
 
@@ -26,7 +51,7 @@ func (b *Builder) AddDateRange(start, end time.Time) {
 	b.args = append(b.args, start, end)
 }
 
-// AddSeverityFilter adds a severity filter using Priority MOD 8.
+// AddSeverityFilter adds a severity filter using Priority modulo 8.
 // Works for both legacy (Priority = Severity 0-7) and modern
 // (Priority = Facility*8 + Severity) rsyslog formats.
 func (b *Builder) AddSeverityFilter(values []int) {
@@ -38,7 +63,7 @@ func (b *Builder) AddSeverityFilter(values []int) {
 		placeholders[i] = "?"
 	}
 	b.conditions = append(b.conditions,
-		fmt.Sprintf("Priority MOD 8 IN (%s)", strings.Join(placeholders, ",")))
+		fmt.Sprintf("%s IN (%s)", b.dialect.SeverityExpr(), strings.Join(placeholders, ",")))
 	for _, v := range values {
 		b.args = append(b.args, v)
 	}
@@ -82,7 +107,7 @@ func (b *Builder) AddIntMultiValue(column string, values []int) {
 	b.AddMultiValueFilter(column, ivals)
 }
 
-// AddSeverityExclude adds a NOT IN filter for severity (Priority MOD 8).
+// AddSeverityExclude adds a NOT IN filter for severity (Priority modulo 8).
 func (b *Builder) AddSeverityExclude(values []int) {
 	if len(values) == 0 {
 		return
@@ -92,7 +117,7 @@ func (b *Builder) AddSeverityExclude(values []int) {
 		placeholders[i] = "?"
 	}
 	b.conditions = append(b.conditions,
-		fmt.Sprintf("Priority MOD 8 NOT IN (%s)", strings.Join(placeholders, ",")))
+		fmt.Sprintf("%s NOT IN (%s)", b.dialect.SeverityExpr(), strings.Join(placeholders, ",")))
 	for _, v := range values {
 		b.args = append(b.args, v)
 	}
@@ -130,19 +155,36 @@ func (b *Builder) AddIntExclude(column string, values []int) {
 	}
 }
 
-// AddMessageSearch adds LIKE search on Message column; multiple terms use OR.
+// AddMessageSearch adds a text search on the Message column (LIKE on MySQL,
+// full-text + ILIKE on PostgreSQL); multiple terms use OR.
 func (b *Builder) AddMessageSearch(terms []string) {
 	if len(terms) == 0 {
 		return
 	}
 	conds := make([]string, len(terms))
 	for i, term := range terms {
-		conds[i] = "Message LIKE ?"
-		b.args = append(b.args, "%"+term+"%")
+		cond, args := b.dialect.MessageSearch(term)
+		conds[i] = cond
+		b.args = append(b.args, args...)
 	}
 	b.conditions = append(b.conditions, "("+strings.Join(conds, " OR ")+")")
 }
 
+// AddFieldFilters adds the SQL pre-selection for structured field filters.
+// sqlFor returns the condition for one filter (see database.DB.FieldFilterSQL).
+// The conditions only narrow the result to a superset; callers must apply
+// fields.MatchAll to the scanned entries for exact results.
+func (b *Builder) AddFieldFilters(filters []fields.Filter, sqlFor func(fields.Filter) (string, []interface{})) {
+	for _, f := range filters {
+		cond, args := sqlFor(f)
+		if cond == "" {
+			continue
+		}
+		b.conditions = append(b.conditions, cond)
+		b.args = append(b.args, args...)
+	}
+}
+
 // Build returns the WHERE clause and args. Returns "1=1" when no filters.
 func (b *Builder) Build() (string, []interface{}) {
 	if len(b.conditions) == 0 {
@@ -2,9 +2,11 @@ package filters
 
 import (
 	"fmt"
+	"net/url"
 	"strconv"
 	"time"
 
+	"github.com/phil-bot/rsyslox/internal/fields"
 	"github.com/phil-bot/rsyslox/internal/models"
 )
 
@@ -133,6 +135,25 @@ func ValidateFacilities(params []string) ([]int, error) {
 	return result, nil
 }
 
+// ValidateIntegers parses a slice of non-negative integer values for field.
+// Returns nil (no filter) when input is empty.
+func ValidateIntegers(field string, params []string) ([]int, error) {
+	if len(params) == 0 {
+		return nil, nil
+	}
+	result := make([]int, 0, len(params))
+	for _, p := range params {
+		v, err := strconv.Atoi(p)
+		if err != nil || v < 0 {
+			return nil, models.NewAPIError(models.ErrCodeInvalidParameter,
+				fmt.Sprintf("'%s' is not a valid non-negative integer", p)).
+				WithField(field)
+		}
+		result = append(result, v)
+	}
+	return result, nil
+}
+
 // ValidateMessages returns the message search terms as-is.
 // Returns nil (no filter) when input is empty.
 func ValidateMessages(params []string) ([]string, error) {
@@ -141,3 +162,14 @@ func ValidateMessages(params []string) ([]string, error) {
 	}
 	return params, nil
 }
+
+// ValidateFieldFilters parses the field.<name> parameters of a query.
+// Returns nil (no filter) when none are present.
+func ValidateFieldFilters(query url.Values) ([]fields.Filter, error) {
+	result, err := fields.ParseQuery(query)
+	if err != nil {
+		return nil, models.NewAPIError(models.ErrCodeInvalidParameter, err.Error()).
+			WithField("field")
+	}
+	return result, nil
+}
@@ -0,0 +1,168 @@
+package forwarder
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/phil-bot/rsyslox/internal/models"
+)
+
+// Supported values of forwarders.format.
+const (
+	FormatCEF  = "cef"
+	FormatLEEF = "leef"
+	FormatJSON = "json"
+)
+
+// vendor and product identify rsyslox in CEF and LEEF headers.
+const (
+	vendor  = "rsyslox"
+	product = "rsyslox"
+)
+
+// cefSeverity maps syslog severities (0 = emergency … 7 = debug) to the CEF
+// scale (10 = most severe … 0).
+var cefSeverity = [8]int{10, 9, 8, 7, 5, 3, 2, 1}
+
+// formatter turns an entry into one record without raw newlines.
+type formatter func(e models.LogEntry) ([]byte, error)
+
+// newFormatter returns the formatter for a forwarders.format value.
+// version is the rsyslox version reported in CEF and LEEF headers.
+func newFormatter(format, version string) (formatter, error) {
+	switch format {
+	case FormatCEF:
+		return func(e models.LogEntry) ([]byte, error) { return formatCEF(e, version), nil }, nil
+	case FormatLEEF:
+		return func(e models.LogEntry) ([]byte, error) { return formatLEEF(e, version), nil }, nil
+	case FormatJSON:
+		return func(e models.LogEntry) ([]byte, error) { return json.Marshal(e) }, nil
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// formatCEF renders an ArcSight Common Event Format record:
+//
+//	CEF:0|rsyslox|rsyslox|<version>|<program>|<message>|<severity>|rt=… dvchost=… msg=…
+func formatCEF(e models.LogEntry, version string) []byte {
+	var b strings.Builder
+	b.WriteString("CEF:0|")
+	b.WriteString(cefHeader(vendor) + "|" + cefHeader(product) + "|" + cefHeader(version) + "|")
+	b.WriteString(cefHeader(signature(e)) + "|")
+	b.WriteString(cefHeader(truncate(e.Message, 128)) + "|")
+	b.WriteString(strconv.Itoa(cefSeverity[e.Severity&7]) + "|")
+
+	ext := []string{
+		"rt=" + strconv.FormatInt(e.ReceivedAt.UnixMilli(), 10),
+		"dvchost=" + cefValue(e.FromHost),
+		"deviceFacility=" + cefValue(facilityLabel(e.Facility)),
+		"externalId=" + strconv.Itoa(e.ID),
+	}
+	if e.DeviceReportedTime != nil {
+		ext = append(ext, "deviceCustomDate1="+strconv.FormatInt(e.DeviceReportedTime.UnixMilli(), 10),
+			"deviceCustomDate1Label=reported")
+	}
+	if e.ProgramName != "" {
+		ext = append(ext, "dproc="+cefValue(e.ProgramName))
+	}
+	if e.ProcessID != nil {
+		ext = append(ext, "dpid="+strconv.Itoa(*e.ProcessID))
+	}
+	ext = append(ext, "msg="+cefValue(e.Message))
+	b.WriteString(strings.Join(ext, " "))
+	return []byte(b.String())
+}
+
+// formatLEEF renders an IBM QRadar LEEF 1.0 record with tab-separated
+// attributes.
+func formatLEEF(e models.LogEntry, version string) []byte {
+	var b strings.Builder
+	b.WriteString("LEEF:1.0|")
+	b.WriteString(leefHeader(vendor) + "|" + leefHeader(product) + "|" + leefHeader(version) + "|")
+	b.WriteString(leefHeader(signature(e)) + "|")
+
+	attrs := [][2]string{
+		{"devTime", e.ReceivedAt.Format("Jan 02 2006 15:04:05.000 -0700")},
+		{"devTimeFormat", "MMM dd yyyy HH:mm:ss.SSS Z"},
+		{"sev", strconv.Itoa(cefSeverity[e.Severity&7])},
+		{"identHostName", e.FromHost},
+		{"cat", facilityLabel(e.Facility)},
+		{"syslogSeverity", models.GetSeverityLabel(e.Severity)},
+		{"externalId", strconv.Itoa(e.ID)},
+	}
+	if e.ProgramName != "" {
+		attrs = append(attrs, [2]string{"program", e.ProgramName})
+	}
+	if e.ProcessID != nil {
+		attrs = append(attrs, [2]string{"pid", strconv.Itoa(*e.ProcessID)})
+	}
+	attrs = append(attrs, [2]string{"msg", e.Message})
+
+	for i, a := range attrs {
+		if i > 0 {
+			b.WriteByte('\t')
+		}
+		b.WriteString(a[0] + "=" + leefValue(a[1]))
+	}
+	return []byte(b.String())
+}
+
+// wrapSyslog prefixes a record with an RFC 5424 header carrying the
+// entry's priority, host and program.
+func wrapSyslog(e models.LogEntry, record []byte) []byte {
+	app := e.ProgramName
+	if app == "" {
+		app = "-"
+	}
+	host := e.FromHost
+	if host == "" {
+		host = "-"
+	}
+	header := fmt.Sprintf("<%d>1 %s %s %s - - - ",
+		e.Facility*8+e.Severity, e.ReceivedAt.UTC().Format(time.RFC3339Nano), host, app)
+	return append([]byte(header), record...)
+}
+
+// signature is the event class of an entry: its program name.
+func signature(e models.LogEntry) string {
+	if e.ProgramName != "" {
+		return e.ProgramName
+	}
+	return "syslog"
+}
+
+func facilityLabel(facility int) string {
+	if models.IsValidFacility(facility) {
+		return models.FacilityLabels[facility]
+	}
+	return strconv.Itoa(facility)
+}
+
+// Escapers for CEF and LEEF. Records must not contain raw newlines, since
+// the transports use newline framing.
+var (
+	cefHeaderEscaper  = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefValueEscaper   = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+	leefHeaderEscaper = strings.NewReplacer(`|`, `\|`, "\r", " ", "\n", " ")
+	leefValueEscaper  = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+)
+
+func cefHeader(s string) string  { return cefHeaderEscaper.Replace(s) }
+func cefValue(s string) string   { return cefValueEscaper.Replace(s) }
+func leefHeader(s string) string { return leefHeaderEscaper.Replace(s) }
+func leefValue(s string) string  { return leefValueEscaper.Replace(s) }
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,559 @@
+// Package forwarder copies new SystemEvents rows to SIEM systems.
+//
+// Every forwarder follows the table by ID: rows above its checkpoint that
+// match its filter are formatted (CEF, LEEF or JSON) and appended to a
+// disk-backed queue, after which the checkpoint advances. A sender drains
+// the queue over TCP, TLS or UDP and retries with backoff while the
+// destination is unreachable. Checkpoint and queue live in the state
+// directory, so neither a restart nor a SIEM outage loses events; delivery is
+// at-least-once.
+//
+// A row whose insert commits after rows with higher IDs appears below the
+// checkpoint. IDs passed without a row are therefore read again for
+// lateCommitWait (see database.IDGaps). Rows that commit later than that,
+// or while rsyslox is restarting, are not forwarded.
+package forwarder
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/database"
+	"github.com/phil-bot/rsyslox/internal/filters"
+	"github.com/phil-bot/rsyslox/internal/models"
+)
+
+const (
+	// sendBatch is the number of queued records written per send attempt.
+	sendBatch = 200
+
+	// dialTimeout and writeTimeout bound network operations.
+	dialTimeout  = 10 * time.Second
+	writeTimeout = 30 * time.Second
+
+	// minBackoff and maxBackoff bound the retry delay after a failed send.
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+
+	// probeFactor is the number of IDs read per batch, in multiples of
+	// BatchSize, to find the IDs without a row.
+	probeFactor = 10
+
+	// lateCommitWait is how long an ID without a row is read again.
+	lateCommitWait = time.Minute
+)
+
+// Config holds the forwarding settings.
+type Config struct {
+	// StateDir holds one subdirectory per forwarder with its checkpoint and
+	// queue segments.
+	StateDir string
+
+	// Interval is how often new rows are read.
+	Interval time.Duration
+
+	// BatchSize is the number of rows read per query.
+	BatchSize int
+
+	// MaxQueueBytes stops reading new rows while a forwarder's queue is
+	// larger; the rows stay in the database until the queue drains.
+	MaxQueueBytes int64
+
+	// Version is the rsyslox version reported in CEF and LEEF headers.
+	Version string
+
+	// Targets are the configured [[forwarders]].
+	Targets []config.ForwarderConfig
+}
+
+// Status is the state of one forwarder, as returned by the admin API.
+type Status struct {
+	Name        string     `json:"name"`
+	Format      string     `json:"format"`
+	Transport   string     `json:"transport"`
+	Address     string     `json:"address"`
+	Connected   bool       `json:"connected"`
+	Checkpoint  int        `json:"checkpoint"`  // last SystemEvents ID queued
+	QueueBytes  int64      `json:"queue_bytes"` // formatted records not yet sent
+	QueueFull   bool       `json:"queue_full"`
+	Queued      int64      `json:"queued"` // records queued since start
+	Sent        int64      `json:"sent"`   // records sent since start
+	Failures    int64      `json:"failures"`
+	LastSentAt  *time.Time `json:"last_sent_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// Manager runs all configured forwarders.
+type Manager struct {
+	db      *database.DB
+	cfg     Config
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+	targets []*target
+}
+
+// New creates a new Manager reading from db.
+func New(db *database.DB, cfg Config) *Manager {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 2 * time.Second
+	}
+	return &Manager{db: db, cfg: cfg, stopCh: make(chan struct{})}
+}
+
+// Start opens the state of every forwarder and launches their loops.
+func (m *Manager) Start() error {
+	if len(m.cfg.Targets) == 0 {
+		log.Println("⏭  Forwarding disabled (no forwarders configured)")
+		return nil
+	}
+
+	for _, tc := range m.cfg.Targets {
+		t, err := m.newTarget(tc)
+		if err != nil {
+			m.closeTargets()
+			return fmt.Errorf("forwarder %s: %w", tc.Name, err)
+		}
+		m.targets = append(m.targets, t)
+	}
+
+	for _, t := range m.targets {
+		m.wg.Add(2)
+		go t.pump()
+		go t.send()
+		log.Printf("✓ Forwarder %s started (%s over %s to %s, checkpoint ID %d)",
+			t.cfg.Name, t.cfg.Format, t.cfg.Transport, t.cfg.Address, t.checkpoint)
+	}
+	return nil
+}
+
+// Stop signals all forwarders to stop and waits for them.
+func (m *Manager) Stop() {
+	if len(m.targets) == 0 {
+		return
+	}
+	close(m.stopCh)
+	m.wg.Wait()
+	m.closeTargets()
+	log.Println("Forwarders stopped")
+}
+
+func (m *Manager) closeTargets() {
+	for _, t := range m.targets {
+		t.queue.Close()
+		if t.conn != nil {
+			t.conn.Close()
+		}
+	}
+}
+
+// Status returns the state of every forwarder. It is safe to call on a nil
+// Manager.
+func (m *Manager) Status() []Status {
+	if m == nil {
+		return []Status{}
+	}
+	out := make([]Status, 0, len(m.targets))
+	for _, t := range m.targets {
+		out = append(out, t.status())
+	}
+	return out
+}
+
+// target is the running state of one forwarder.
+type target struct {
+	m      *Manager
+	cfg    config.ForwarderConfig
+	format formatter
+	where  string
+	args   []interface{}
+	queue  *diskQueue
+	dir    string
+	wake   chan struct{}    // signals the sender that records were queued
+	gaps   *database.IDGaps // owned by the pump goroutine
+
+	conn net.Conn // owned by the sender goroutine
+
+	mu          sync.Mutex
+	checkpoint  int
+	connected   bool
+	queueFull   bool
+	queued      int64
+	sent        int64
+	failures    int64
+	lastSentAt  time.Time
+	lastError   string
+	lastErrorAt time.Time
+}
+
+func (m *Manager) newTarget(tc config.ForwarderConfig) (*target, error) {
+	format, err := newFormatter(tc.Format, m.cfg.Version)
+	if err != nil {
+		return nil, err
+	}
+	where, args, err := buildFilter(m.db, tc.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(m.cfg.StateDir, tc.Name)
+	queue, err := openQueue(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open queue: %w", err)
+	}
+	t := &target{
+		m: m, cfg: tc, format: format, where: where, args: args,
+		queue: queue, dir: dir, wake: make(chan struct{}, 1),
+		gaps: database.NewIDGaps(lateCommitWait),
+	}
+
+	checkpoint, err := t.loadCheckpoint()
+	if err != nil {
+		queue.Close()
+		return nil, err
+	}
+	t.checkpoint = checkpoint
+	return t, nil
+}
+
+// buildFilter returns the WHERE clause selecting the rows of a forwarder.
+func buildFilter(db *database.DB, f config.ForwarderFilter) (string, []interface{}, error) {
+	for _, s := range f.Severity {
+		if !models.IsValidSeverity(s) {
+			return "", nil, fmt.Errorf("filter.severity: %d is not between 0 and 7", s)
+		}
+	}
+	for _, v := range f.Facility {
+		if !models.IsValidFacility(v) {
+			return "", nil, fmt.Errorf("filter.facility: %d is not between 0 and 23", v)
+		}
+	}
+	b := filters.NewFor(db.Dialect)
+	b.AddSeverityFilter(f.Severity)
+	b.AddIntMultiValue("Facility", f.Facility)
+	b.AddStringMultiValue("FromHost", f.FromHost)
+	b.AddStringMultiValue(db.ColumnExpr("ProgramName"), f.ProgramName)
+	b.AddMessageSearch(f.Message)
+	where, args := b.Build()
+	return where, args, nil
+}
+
+// loadCheckpoint reads the last queued ID. On first start it begins at the
+// end of the table unless start_at = "beginning".
+func (t *target) loadCheckpoint() (int, error) {
+	data, err := os.ReadFile(filepath.Join(t.dir, "checkpoint"))
+	if err == nil {
+		id, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			return 0, fmt.Errorf("corrupt checkpoint: %w", err)
+		}
+		return id, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+	if t.cfg.StartAt == "beginning" {
+		return 0, nil
+	}
+	id, err := t.m.db.MaxID()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the current maximum ID: %w", err)
+	}
+	return id, t.saveCheckpoint(id)
+}
+
+func (t *target) saveCheckpoint(id int) error {
+	return writeFileAtomic(filepath.Join(t.dir, "checkpoint"), []byte(strconv.Itoa(id)+"\n"))
+}
+
+// entryIDs returns the IDs of entries.
+func entryIDs(entries []models.LogEntry) []int {
+	ids := make([]int, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID
+	}
+	return ids
+}
+
+// pump moves new matching rows into the queue.
+func (t *target) pump() {
+	defer t.m.wg.Done()
+
+	ticker := time.NewTicker(t.m.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		for t.pumpBatch() {
+			select {
+			case <-t.m.stopCh:
+				return
+			default:
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-t.m.stopCh:
+			return
+		}
+	}
+}
+
+// pumpBatch queues one batch and reports whether more rows may be waiting.
+func (t *target) pumpBatch() bool {
+	full := t.m.cfg.MaxQueueBytes > 0 && t.queue.Bytes() >= t.m.cfg.MaxQueueBytes
+	t.mu.Lock()
+	if full && !t.queueFull {
+		log.Printf("⚠️  Forwarder %s: queue full, pausing until %s is reachable", t.cfg.Name, t.cfg.Address)
+	}
+	t.queueFull = full
+	checkpoint := t.checkpoint
+	t.mu.Unlock()
+	if full {
+		return false
+	}
+
+	// Read the IDs of all rows first, so that the IDs without a row are
+	// known, then the matching rows among them.
+	batch := t.m.cfg.BatchSize
+	ids, err := t.m.db.IDsAfter(checkpoint, probeFactor*batch)
+	if err != nil {
+		t.fail(fmt.Errorf("read failed: %w", err))
+		return false
+	}
+	upTo := checkpoint
+	var entries []models.LogEntry
+	if len(ids) > 0 {
+		upTo = ids[len(ids)-1]
+		entries, err = t.m.db.QueryAfterID(t.where, t.args, checkpoint, upTo, batch)
+		if err != nil {
+			t.fail(fmt.Errorf("read failed: %w", err))
+			return false
+		}
+		if len(entries) == batch {
+			upTo = entries[len(entries)-1].ID
+		}
+	}
+	late, err := t.m.db.QueryIDs(t.where, t.args, t.gaps.Open())
+	if err != nil {
+		t.fail(fmt.Errorf("read failed: %w", err))
+		return false
+	}
+	if upTo == checkpoint && len(late) == 0 {
+		return false
+	}
+
+	records := make([][]byte, 0, len(late)+len(entries))
+	for _, e := range append(late, entries...) {
+		rec, err := t.format(e)
+		if err != nil {
+			log.Printf("⚠️  Forwarder %s: skipping ID %d: %v", t.cfg.Name, e.ID, err)
+			continue
+		}
+		if t.cfg.Syslog {
+			rec = wrapSyslog(e, rec)
+		}
+		records = append(records, rec)
+	}
+	if err := t.queue.Append(records); err != nil {
+		t.fail(fmt.Errorf("queue write failed: %w", err))
+		return false
+	}
+	t.gaps.Found(entryIDs(late))
+	t.gaps.Pass(checkpoint, upTo, ids)
+	if upTo != checkpoint {
+		if err := t.saveCheckpoint(upTo); err != nil {
+			// The records are queued; they are sent again after a restart.
+			t.fail(fmt.Errorf("checkpoint write failed: %w", err))
+		}
+	}
+
+	t.mu.Lock()
+	t.checkpoint = upTo
+	t.queued += int64(len(records))
+	t.mu.Unlock()
+
+	if len(records) > 0 {
+		select {
+		case t.wake <- struct{}{}:
+		default:
+		}
+	}
+	return len(ids) == probeFactor*batch || len(entries) == batch
+}
+
+// send drains the queue to the destination.
+func (t *target) send() {
+	defer t.m.wg.Done()
+
+	backoff := minBackoff
+	for {
+		records, pos, err := t.queue.Peek(sendBatch)
+		if err != nil {
+			t.fail(fmt.Errorf("queue read failed: %w", err))
+		}
+		if len(records) == 0 {
+			select {
+			case <-t.wake:
+			case <-time.After(t.m.cfg.Interval):
+			case <-t.m.stopCh:
+				return
+			}
+			continue
+		}
+
+		if err := t.write(records); err != nil {
+			t.disconnect()
+			t.fail(err)
+			select {
+			case <-time.After(backoff):
+			case <-t.m.stopCh:
+				return
+			}
+			backoff = min(backoff*2, maxBackoff)
+			continue
+		}
+		backoff = minBackoff
+
+		if err := t.queue.Commit(pos); err != nil {
+			t.fail(fmt.Errorf("queue commit failed: %w", err))
+		}
+		t.mu.Lock()
+		t.sent += int64(len(records))
+		t.lastSentAt = time.Now()
+		t.mu.Unlock()
+	}
+}
+
+// write sends records, connecting first if necessary. TCP and TLS use
+// newline framing; UDP sends one datagram per record.
+func (t *target) write(records [][]byte) error {
+	if t.conn == nil {
+		conn, err := t.dial()
+		if err != nil {
+			return fmt.Errorf("connect to %s failed: %w", t.cfg.Address, err)
+		}
+		t.conn = conn
+		t.mu.Lock()
+		t.connected = true
+		t.mu.Unlock()
+		log.Printf("✓ Forwarder %s connected to %s", t.cfg.Name, t.cfg.Address)
+	}
+
+	t.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if t.cfg.Transport == "udp" {
+		for _, r := range records {
+			if _, err := t.conn.Write(r); err != nil {
+				return fmt.Errorf("send to %s failed: %w", t.cfg.Address, err)
+			}
+		}
+		return nil
+	}
+
+	buf := make([]byte, 0, 64*1024)
+	for _, r := range records {
+		buf = append(buf, r...)
+		buf = append(buf, '\n')
+	}
+	if _, err := t.conn.Write(buf); err != nil {
+		return fmt.Errorf("send to %s failed: %w", t.cfg.Address, err)
+	}
+	return nil
+}
+
+func (t *target) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}
+	switch t.cfg.Transport {
+	case "udp":
+		return dialer.Dial("udp", t.cfg.Address)
+	case "tls":
+		tlsCfg, err := t.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		return tls.DialWithDialer(dialer, "tcp", t.cfg.Address, tlsCfg)
+	default:
+		return dialer.Dial("tcp", t.cfg.Address)
+	}
+}
+
+func (t *target) tlsConfig() (*tls.Config, error) {
+	host, _, _ := net.SplitHostPort(t.cfg.Address)
+	cfg := &tls.Config{
+		ServerName:         host,
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: t.cfg.TLSSkipVerify,
+	}
+	if t.cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(t.cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls_ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls_ca %s contains no certificates", t.cfg.TLSCAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+func (t *target) disconnect() {
+	if t.conn != nil {
+		t.conn.Close()
+		t.conn = nil
+	}
+	t.mu.Lock()
+	t.connected = false
+	t.mu.Unlock()
+}
+
+// fail records an error; repeated identical errors are logged once.
+func (t *target) fail(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failures++
+	if err.Error() != t.lastError {
+		log.Printf("⚠️  Forwarder %s: %v", t.cfg.Name, err)
+	}
+	t.lastError = err.Error()
+	t.lastErrorAt = time.Now()
+}
+
+func (t *target) status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := Status{
+		Name:       t.cfg.Name,
+		Format:     t.cfg.Format,
+		Transport:  t.cfg.Transport,
+		Address:    t.cfg.Address,
+		Connected:  t.connected,
+		Checkpoint: t.checkpoint,
+		QueueBytes: t.queue.Bytes(),
+		QueueFull:  t.queueFull,
+		Queued:     t.queued,
+		Sent:       t.sent,
+		Failures:   t.failures,
+		LastError:  t.lastError,
+	}
+	if !t.lastSentAt.IsZero() {
+		ts := t.lastSentAt
+		s.LastSentAt = &ts
+	}
+	if !t.lastErrorAt.IsZero() {
+		ts := t.lastErrorAt
+		s.LastErrorAt = &ts
+	}
+	return s
+}
@@ -0,0 +1,255 @@
+package forwarder
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// segmentSize is the size at which the queue starts a new segment file.
+const segmentSize = 8 << 20
+
+// diskQueue is an append-only queue of newline-terminated records, stored as
+// numbered segment files in dir. The read position is persisted in
+// dir/read.pos, so records survive restarts until they are committed.
+// Consumed segments are deleted.
+type diskQueue struct {
+	dir string
+
+	mu        sync.Mutex
+	writeSeg  int
+	writeFile *os.File
+	writeSize int64
+	read      queuePos
+	bytes     int64 // unread bytes
+}
+
+// queuePos is a position in the queue.
+type queuePos struct {
+	seg    int
+	offset int64
+}
+
+// openQueue opens or creates the queue in dir.
+func openQueue(dir string) (*diskQueue, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	q := &diskQueue{dir: dir}
+
+	segs, err := q.segments()
+	if err != nil {
+		return nil, err
+	}
+	if data, err := os.ReadFile(q.posPath()); err == nil {
+		if _, err := fmt.Sscanf(string(data), "%d %d", &q.read.seg, &q.read.offset); err != nil {
+			return nil, fmt.Errorf("corrupt read position %s: %w", q.posPath(), err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	} else if len(segs) > 0 {
+		q.read = queuePos{seg: segs[0]}
+	}
+
+	q.writeSeg = max(q.read.seg, 1)
+	if len(segs) > 0 {
+		q.writeSeg = max(q.writeSeg, segs[len(segs)-1])
+	}
+	for _, seg := range segs {
+		info, err := os.Stat(q.segPath(seg))
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case seg < q.read.seg:
+			os.Remove(q.segPath(seg)) // consumed before a crash
+		case seg == q.read.seg:
+			q.bytes += max(info.Size()-q.read.offset, 0)
+		default:
+			q.bytes += info.Size()
+		}
+	}
+	if q.read.seg == 0 {
+		q.read.seg = q.writeSeg
+	}
+	if len(segs) == 0 || q.read.seg > segs[len(segs)-1] {
+		q.read.offset = 0 // segment files were removed by hand
+	}
+
+	q.writeFile, err = os.OpenFile(q.segPath(q.writeSeg), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	info, err := q.writeFile.Stat()
+	if err != nil {
+		q.writeFile.Close()
+		return nil, err
+	}
+	q.writeSize = info.Size()
+	return q, nil
+}
+
+// Append writes records (without trailing newline) and syncs them to disk.
+func (q *diskQueue) Append(records [][]byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	w := bufio.NewWriter(q.writeFile)
+	var n int64
+	for _, r := range records {
+		w.Write(r)
+		w.WriteByte('\n')
+		n += int64(len(r)) + 1
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := q.writeFile.Sync(); err != nil {
+		return err
+	}
+	q.writeSize += n
+	q.bytes += n
+
+	if q.writeSize >= segmentSize {
+		f, err := os.OpenFile(q.segPath(q.writeSeg+1), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+		if err != nil {
+			return err
+		}
+		q.writeFile.Close()
+		q.writeFile, q.writeSeg, q.writeSize = f, q.writeSeg+1, 0
+	}
+	return nil
+}
+
+// Peek returns up to n records from the read position without consuming
+// them, and the position after the last returned record.
+func (q *diskQueue) Peek(n int) ([][]byte, queuePos, error) {
+	q.mu.Lock()
+	pos, writeSeg := q.read, q.writeSeg
+	q.mu.Unlock()
+
+	var records [][]byte
+	for len(records) < n {
+		f, err := os.Open(q.segPath(pos.seg))
+		if err != nil {
+			return records, pos, err
+		}
+		if _, err := f.Seek(pos.offset, io.SeekStart); err != nil {
+			f.Close()
+			return records, pos, err
+		}
+		r := bufio.NewReader(f)
+		for len(records) < n {
+			line, err := r.ReadBytes('\n')
+			if err != nil {
+				break // end of segment, or a record still being appended
+			}
+			pos.offset += int64(len(line))
+			records = append(records, line[:len(line)-1])
+		}
+		f.Close()
+
+		if len(records) >= n || pos.seg >= writeSeg {
+			break
+		}
+		pos = queuePos{seg: pos.seg + 1}
+	}
+	return records, pos, nil
+}
+
+// Commit marks everything before pos as delivered and deletes segments that
+// were read completely.
+func (q *diskQueue) Commit(pos queuePos) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	consumed := int64(0)
+	for seg := q.read.seg; seg < pos.seg; seg++ {
+		if info, err := os.Stat(q.segPath(seg)); err == nil {
+			if seg == q.read.seg {
+				consumed += info.Size() - q.read.offset
+			} else {
+				consumed += info.Size()
+			}
+		}
+		os.Remove(q.segPath(seg))
+	}
+	if pos.seg == q.read.seg {
+		consumed += pos.offset - q.read.offset
+	} else {
+		consumed += pos.offset
+	}
+
+	if err := writeFileAtomic(q.posPath(), []byte(fmt.Sprintf("%d %d\n", pos.seg, pos.offset))); err != nil {
+		return err
+	}
+	q.read = pos
+	q.bytes = max(q.bytes-consumed, 0)
+	return nil
+}
+
+// Bytes returns the size of the undelivered records.
+func (q *diskQueue) Bytes() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.bytes
+}
+
+// Close closes the segment being written.
+func (q *diskQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.writeFile.Close()
+}
+
+// segments returns the numbers of the existing segment files in order.
+func (q *diskQueue) segments() ([]int, error) {
+	matches, err := filepath.Glob(filepath.Join(q.dir, "*.q"))
+	if err != nil {
+		return nil, err
+	}
+	segs := make([]int, 0, len(matches))
+	for _, m := range matches {
+		if n, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(m), ".q")); err == nil {
+			segs = append(segs, n)
+		}
+	}
+	sort.Ints(segs)
+	return segs, nil
+}
+
+func (q *diskQueue) segPath(seg int) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%08d.q", seg))
+}
+
+func (q *diskQueue) posPath() string {
+	return filepath.Join(q.dir, "read.pos")
+}
+
+// writeFileAtomic replaces path via a synced temporary file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,102 @@
+package admin
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/phil-bot/rsyslox/internal/archive"
+	"github.com/phil-bot/rsyslox/internal/models"
+)
+
+// ArchivesHandler handles /api/admin/archives endpoints:
+//
+//	GET  /api/admin/archives                → manifests of all archives
+//	GET  /api/admin/archives/{name}         → manifest of one archive
+//	POST /api/admin/archives/{name}/restore → load an archive back into SystemEvents
+type ArchivesHandler struct {
+	archives *archive.Store // nil when cleanup.archive_dir is empty
+}
+
+func NewArchivesHandler(s *archive.Store) *ArchivesHandler { return &ArchivesHandler{archives: s} }
+
+func (h *ArchivesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/archives"), "/")
+	restore := strings.HasSuffix(name, "/restore")
+	name = strings.TrimSuffix(name, "/restore")
+
+	switch {
+	case restore && r.Method == http.MethodPost:
+		h.restore(w, name)
+	case restore:
+		respondError(w, http.StatusMethodNotAllowed,
+			models.NewAPIError("METHOD_NOT_ALLOWED", "Only POST is allowed"))
+	case r.Method != http.MethodGet:
+		respondError(w, http.StatusMethodNotAllowed,
+			models.NewAPIError("METHOD_NOT_ALLOWED", "Only GET is allowed"))
+	case name == "":
+		h.list(w)
+	default:
+		h.get(w, name)
+	}
+}
+
+func (h *ArchivesHandler) list(w http.ResponseWriter) {
+	if h.archives == nil {
+		respondJSON(w, http.StatusOK, []archive.Manifest{})
+		return
+	}
+	manifests, err := h.archives.List()
+	if err != nil {
+		log.Printf("Archives: failed to list: %v", err)
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError("INTERNAL_ERROR", "Failed to list archives"))
+		return
+	}
+	respondJSON(w, http.StatusOK, manifests)
+}
+
+func (h *ArchivesHandler) get(w http.ResponseWriter, name string) {
+	if h.archives == nil {
+		respondArchivingDisabled(w)
+		return
+	}
+	m, err := h.archives.Get(name)
+	if err != nil {
+		respondArchiveError(w, name, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, m)
+}
+
+func (h *ArchivesHandler) restore(w http.ResponseWriter, name string) {
+	if h.archives == nil {
+		respondArchivingDisabled(w)
+		return
+	}
+	result, err := h.archives.Restore(name)
+	if err != nil {
+		respondArchiveError(w, name, err)
+		return
+	}
+	log.Printf("Admin: archive %s restored (%d rows, %d already present)",
+		name, result.Restored, result.Skipped)
+	respondJSON(w, http.StatusOK, result)
+}
+
+func respondArchivingDisabled(w http.ResponseWriter) {
+	respondError(w, http.StatusNotFound,
+		models.NewAPIError(models.ErrCodeNotFound, "Archiving is disabled (cleanup.archive_dir is not set)"))
+}
+
+func respondArchiveError(w http.ResponseWriter, name string, err error) {
+	if errors.Is(err, archive.ErrNotFound) {
+		respondError(w, http.StatusNotFound,
+			models.NewAPIError(models.ErrCodeNotFound, "Archive not found: "+name))
+		return
+	}
+	log.Printf("Archives: %s: %v", name, err)
+	respondError(w, http.StatusInternalServerError,
+		models.NewAPIError("INTERNAL_ERROR", "Failed to read or restore archive").WithDetails(err.Error()))
+}
@@ -0,0 +1,62 @@
+package admin
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/phil-bot/rsyslox/internal/cleanup"
+	"github.com/phil-bot/rsyslox/internal/models"
+)
+
+// CleanupHandler handles /api/admin/cleanup endpoints:
+//
+//	GET  /api/admin/cleanup                    → status, next run and recent runs
+//	POST /api/admin/cleanup/run[?dry_run=true] → run immediately
+type CleanupHandler struct {
+	cleaner *cleanup.Cleaner
+}
+
+func NewCleanupHandler(c *cleanup.Cleaner) *CleanupHandler { return &CleanupHandler{cleaner: c} }
+
+func (h *CleanupHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/admin/cleanup":
+		if r.Method != http.MethodGet {
+			respondError(w, http.StatusMethodNotAllowed,
+				models.NewAPIError("METHOD_NOT_ALLOWED", "Only GET is allowed"))
+			return
+		}
+		respondJSON(w, http.StatusOK, h.cleaner.Status())
+
+	case "/api/admin/cleanup/run":
+		if r.Method != http.MethodPost {
+			respondError(w, http.StatusMethodNotAllowed,
+				models.NewAPIError("METHOD_NOT_ALLOWED", "Only POST is allowed"))
+			return
+		}
+		if h.cleaner == nil {
+			respondError(w, http.StatusServiceUnavailable,
+				models.NewAPIError("SERVICE_UNAVAILABLE", "Cleanup service not available"))
+			return
+		}
+		dryRun := false
+		if v := r.URL.Query().Get("dry_run"); v != "" {
+			var err error
+			if dryRun, err = strconv.ParseBool(v); err != nil {
+				respondError(w, http.StatusBadRequest,
+					models.NewValidationError("dry_run", "Must be true or false"))
+				return
+			}
+		}
+		run := h.cleaner.RunNow(dryRun)
+		if !dryRun {
+			log.Printf("Admin: manual cleanup run deleted %d records", run.Deleted)
+		}
+		respondJSON(w, http.StatusOK, run)
+
+	default:
+		respondError(w, http.StatusNotFound,
+			models.NewAPIError(models.ErrCodeNotFound, "Unknown cleanup endpoint"))
+	}
+}
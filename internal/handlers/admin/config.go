@@ -37,10 +37,16 @@ type DatabaseView struct {
 
 type CleanupView struct {
 	Enabled          bool    `json:"enabled"`
+	Mode             string  `json:"mode"`
 	DiskPath         string  `json:"disk_path"`
 	ThresholdPercent float64 `json:"threshold_percent"`
+	MaxTableBytes    int64   `json:"max_table_bytes"`
+	LowWaterPercent  float64 `json:"low_water_percent"` // 0 = 5 points below the threshold
 	BatchSize        int     `json:"batch_size"`
 	IntervalSeconds  int     `json:"interval_seconds"`
+	ArchiveDir       string  `json:"archive_dir"`
+	Reclaim          string  `json:"reclaim"`
+	ReclaimWindow    string  `json:"reclaim_window"`
 }
 
 type ConfigUpdateRequest struct {
@@ -67,8 +73,11 @@ type DatabaseUpdateRequest struct {
 
 type CleanupUpdateRequest struct {
 	Enabled          *bool    `json:"enabled,omitempty"`
+	Mode             string   `json:"mode,omitempty"`
 	DiskPath         string   `json:"disk_path,omitempty"`
 	ThresholdPercent *float64 `json:"threshold_percent,omitempty"`
+	MaxTableBytes    *int64   `json:"max_table_bytes,omitempty"`
+	LowWaterPercent  *float64 `json:"low_water_percent,omitempty"`
 	BatchSize        *int     `json:"batch_size,omitempty"`
 	IntervalSeconds  *int     `json:"interval_seconds,omitempty"`
 }
@@ -167,9 +176,30 @@ func (h *ConfigHandler) handlePatch(w http.ResponseWriter, r *http.Request) {
 		if c.Enabled != nil {
 			h.cfg.Cleanup.Enabled = *c.Enabled
 		}
+		if c.Mode != "" {
+			if c.Mode != config.CleanupModeDisk && c.Mode != config.CleanupModeTableSize {
+				respondError(w, http.StatusBadRequest,
+					models.NewValidationError("mode", "Must be disk or table_size"))
+				return
+			}
+			h.cfg.Cleanup.Mode = c.Mode
+		}
 		if c.DiskPath != "" {
 			h.cfg.Cleanup.DiskPath = c.DiskPath
 		}
+		if c.MaxTableBytes != nil {
+			if *c.MaxTableBytes <= 0 {
+				respondError(w, http.StatusBadRequest,
+					models.NewValidationError("max_table_bytes", "Must be greater than 0"))
+				return
+			}
+			h.cfg.Cleanup.MaxTableBytes = *c.MaxTableBytes
+		}
+		if h.cfg.Cleanup.Mode == config.CleanupModeTableSize && h.cfg.Cleanup.MaxTableBytes <= 0 {
+			respondError(w, http.StatusBadRequest,
+				models.NewValidationError("max_table_bytes", "Required in table_size mode"))
+			return
+		}
 		if c.ThresholdPercent != nil {
 			if *c.ThresholdPercent <= 0 || *c.ThresholdPercent > 100 {
 				respondError(w, http.StatusBadRequest,
@@ -178,6 +208,18 @@ func (h *ConfigHandler) handlePatch(w http.ResponseWriter, r *http.Request) {
 			}
 			h.cfg.Cleanup.ThresholdPercent = *c.ThresholdPercent
 		}
+		if c.LowWaterPercent != nil {
+			h.cfg.Cleanup.LowWaterPercent = *c.LowWaterPercent
+		}
+		high := h.cfg.Cleanup.ThresholdPercent
+		if h.cfg.Cleanup.Mode == config.CleanupModeTableSize {
+			high = 100
+		}
+		if lw := h.cfg.Cleanup.LowWaterPercent; lw < 0 || lw >= high {
+			respondError(w, http.StatusBadRequest,
+				models.NewValidationError("low_water_percent", "Must be 0 (automatic) or below the threshold"))
+			return
+		}
 		if c.BatchSize != nil {
 			if *c.BatchSize <= 0 {
 				respondError(w, http.StatusBadRequest,
@@ -226,10 +268,16 @@ func toConfigView(cfg *config.Config) ConfigView {
 		},
 		Cleanup: CleanupView{
 			Enabled:          cfg.Cleanup.Enabled,
+			Mode:             cfg.Cleanup.Mode,
 			DiskPath:         cfg.Cleanup.DiskPath,
 			ThresholdPercent: cfg.Cleanup.ThresholdPercent,
+			MaxTableBytes:    cfg.Cleanup.MaxTableBytes,
+			LowWaterPercent:  cfg.Cleanup.LowWaterPercent,
 			BatchSize:        cfg.Cleanup.BatchSize,
 			IntervalSeconds:  int(cfg.Cleanup.Interval.Seconds()),
+			ArchiveDir:       cfg.Cleanup.ArchiveDir,
+			Reclaim:          cfg.Cleanup.Reclaim,
+			ReclaimWindow:    cfg.Cleanup.ReclaimWindow,
 		},
 	}
 }
@@ -0,0 +1,87 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/phil-bot/rsyslox/internal/database"
+	"github.com/phil-bot/rsyslox/internal/models"
+)
+
+// DBHandler handles /api/admin/db endpoints of the primary database:
+//
+//	GET  /api/admin/db         → server version, variables, table size, indexes
+//	POST /api/admin/db/indexes → create or drop recommended indexes in the background
+type DBHandler struct {
+	db *database.DB
+}
+
+func NewDBHandler(db *database.DB) *DBHandler {
+	return &DBHandler{db: db}
+}
+
+type indexJobRequest struct {
+	Action  string   `json:"action"`  // "create" or "drop"
+	Indexes []string `json:"indexes"` // recommended index names; empty with create: all missing
+}
+
+func (h *DBHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/admin/db":
+		if r.Method != http.MethodGet {
+			respondError(w, http.StatusMethodNotAllowed,
+				models.NewAPIError("METHOD_NOT_ALLOWED", "Only GET is allowed"))
+			return
+		}
+		respondJSON(w, http.StatusOK, h.db.Diagnostics())
+
+	case "/api/admin/db/indexes":
+		if r.Method != http.MethodPost {
+			respondError(w, http.StatusMethodNotAllowed,
+				models.NewAPIError("METHOD_NOT_ALLOWED", "Only POST is allowed"))
+			return
+		}
+		h.startIndexJob(w, r)
+
+	default:
+		respondError(w, http.StatusNotFound,
+			models.NewAPIError(models.ErrCodeNotFound, "Unknown db endpoint"))
+	}
+}
+
+func (h *DBHandler) startIndexJob(w http.ResponseWriter, r *http.Request) {
+	var req indexJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest,
+			models.NewAPIError(models.ErrCodeInvalidParameter, "Invalid JSON body"))
+		return
+	}
+	if req.Action != database.IndexActionCreate && req.Action != database.IndexActionDrop {
+		respondError(w, http.StatusBadRequest,
+			models.NewValidationError("action", "Must be create or drop"))
+		return
+	}
+	if req.Action == database.IndexActionDrop && len(req.Indexes) == 0 {
+		respondError(w, http.StatusBadRequest,
+			models.NewValidationError("indexes", "Name the indexes to drop"))
+		return
+	}
+
+	job, err := h.db.StartIndexJob(req.Action, req.Indexes)
+	switch {
+	case err == nil:
+		log.Printf("Admin: index %s started: %s", req.Action, strings.Join(job.Indexes, ", "))
+		respondJSON(w, http.StatusAccepted, job)
+	case errors.Is(err, database.ErrUnknownIndex):
+		respondError(w, http.StatusBadRequest,
+			models.NewValidationError("indexes", err.Error()))
+	case errors.Is(err, database.ErrIndexJobRunning):
+		respondError(w, http.StatusConflict, models.NewAPIError("CONFLICT", err.Error()))
+	default:
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError(models.ErrCodeDatabaseError, "Index job not started").WithDetails(err.Error()))
+	}
+}
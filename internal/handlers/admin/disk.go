@@ -6,19 +6,25 @@ import (
 	"syscall"
 
 	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/database"
 	"github.com/phil-bot/rsyslox/internal/models"
 )
 
 // DiskHandler handles GET /api/admin/disk.
-// It returns disk usage statistics for the path configured in cleanup.disk_path.
+// It returns disk usage statistics for the path configured in cleanup.disk_path,
+// or in table_size mode the size of SystemEvents against cleanup.max_table_bytes.
 type DiskHandler struct {
 	cfg *config.Config
+	db  *database.DB
 }
 
-func NewDiskHandler(cfg *config.Config) *DiskHandler { return &DiskHandler{cfg: cfg} }
+func NewDiskHandler(cfg *config.Config, db *database.DB) *DiskHandler {
+	return &DiskHandler{cfg: cfg, db: db}
+}
 
 type diskResponse struct {
-	Path        string  `json:"path"`
+	Mode        string  `json:"mode"`
+	Path        string  `json:"path"` // "SystemEvents" in table_size mode
 	TotalBytes  uint64  `json:"total_bytes"`
 	UsedBytes   uint64  `json:"used_bytes"`
 	FreeBytes   uint64  `json:"free_bytes"`
@@ -32,6 +38,11 @@ func (h *DiskHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if h.cfg.Cleanup.Mode == config.CleanupModeTableSize {
+		h.serveTableSize(w)
+		return
+	}
+
 	path := h.cfg.Cleanup.DiskPath
 	if path == "" {
 		path = "/"
@@ -53,6 +64,7 @@ func (h *DiskHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	body, _ := json.Marshal(diskResponse{
+		Mode:        config.CleanupModeDisk,
 		Path:        path,
 		TotalBytes:  total,
 		UsedBytes:   used,
@@ -63,3 +75,33 @@ func (h *DiskHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write(body)
 }
+
+// serveTableSize reports SystemEvents as "used" and max_table_bytes as the
+// total, so the response reads like disk usage.
+func (h *DiskHandler) serveTableSize(w http.ResponseWriter) {
+	size, err := h.db.TableSize()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError("DISK_ERROR", "Failed to read table size: "+err.Error()))
+		return
+	}
+
+	limit := uint64(h.cfg.Cleanup.MaxTableBytes)
+	used := uint64(size)
+	var free uint64
+	if used < limit {
+		free = limit - used
+	}
+	var pct float64
+	if limit > 0 {
+		pct = float64(used) / float64(limit) * 100
+	}
+	respondJSON(w, http.StatusOK, diskResponse{
+		Mode:        config.CleanupModeTableSize,
+		Path:        "SystemEvents",
+		TotalBytes:  limit,
+		UsedBytes:   used,
+		FreeBytes:   free,
+		UsedPercent: pct,
+	})
+}
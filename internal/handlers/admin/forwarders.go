@@ -0,0 +1,27 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/phil-bot/rsyslox/internal/forwarder"
+	"github.com/phil-bot/rsyslox/internal/models"
+)
+
+// ForwardersHandler handles GET /api/admin/forwarders.
+// It returns the delivery state of every configured SIEM forwarder.
+type ForwardersHandler struct {
+	forwarders *forwarder.Manager // nil in setup mode
+}
+
+func NewForwardersHandler(m *forwarder.Manager) *ForwardersHandler {
+	return &ForwardersHandler{forwarders: m}
+}
+
+func (h *ForwardersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed,
+			models.NewAPIError("METHOD_NOT_ALLOWED", "Only GET is allowed"))
+		return
+	}
+	respondJSON(w, http.StatusOK, h.forwarders.Status())
+}
@@ -0,0 +1,129 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/hold"
+	"github.com/phil-bot/rsyslox/internal/models"
+)
+
+// HoldsHandler handles /api/admin/holds endpoints:
+//
+//	GET    /api/admin/holds      → all legal holds, including expired ones
+//	POST   /api/admin/holds      → create a hold
+//	DELETE /api/admin/holds/{id} → release a hold
+type HoldsHandler struct {
+	holds *hold.Store
+}
+
+func NewHoldsHandler(s *hold.Store) *HoldsHandler { return &HoldsHandler{holds: s} }
+
+// HoldView is a hold with its current state.
+type HoldView struct {
+	hold.Hold
+	Active bool `json:"active"`
+}
+
+// CreateHoldRequest is the payload for POST /api/admin/holds.
+type CreateHoldRequest struct {
+	Reason     string     `json:"reason"`
+	Hosts      []string   `json:"hosts"`
+	Facilities []int      `json:"facilities"`
+	From       *time.Time `json:"from"`
+	To         *time.Time `json:"to"`
+	ExpiresAt  *time.Time `json:"expires_at"` // omitted = until released
+}
+
+func (h *HoldsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.holds == nil {
+		respondError(w, http.StatusServiceUnavailable,
+			models.NewAPIError("SERVICE_UNAVAILABLE", "Legal holds are not available"))
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/holds"), "/")
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		h.list(w)
+	case id == "" && r.Method == http.MethodPost:
+		h.create(w, r)
+	case id == "":
+		respondError(w, http.StatusMethodNotAllowed,
+			models.NewAPIError("METHOD_NOT_ALLOWED", "Only GET and POST are allowed"))
+	case r.Method == http.MethodDelete:
+		h.release(w, id)
+	default:
+		respondError(w, http.StatusMethodNotAllowed,
+			models.NewAPIError("METHOD_NOT_ALLOWED", "Only DELETE is allowed"))
+	}
+}
+
+func (h *HoldsHandler) list(w http.ResponseWriter) {
+	now := time.Now()
+	holds := h.holds.List()
+	views := make([]HoldView, len(holds))
+	for i, hd := range holds {
+		views[i] = HoldView{Hold: hd, Active: hd.Active(now)}
+	}
+	respondJSON(w, http.StatusOK, views)
+}
+
+func (h *HoldsHandler) create(w http.ResponseWriter, r *http.Request) {
+	var req CreateHoldRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest,
+			models.NewAPIError(models.ErrCodeInvalidParameter, "Invalid JSON body"))
+		return
+	}
+
+	hd := hold.Hold{
+		Reason:     strings.TrimSpace(req.Reason),
+		Hosts:      req.Hosts,
+		Facilities: req.Facilities,
+		From:       req.From,
+		To:         req.To,
+		ExpiresAt:  req.ExpiresAt,
+	}
+	if err := hd.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest,
+			models.NewAPIError(models.ErrCodeInvalidParameter, "Invalid hold").WithDetails(err.Error()))
+		return
+	}
+	if hd.ExpiresAt != nil && !hd.ExpiresAt.After(time.Now()) {
+		respondError(w, http.StatusBadRequest,
+			models.NewValidationError("expires_at", "Must be in the future"))
+		return
+	}
+
+	hd, err := h.holds.Add(hd)
+	if err != nil {
+		log.Printf("Holds: %v", err)
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError("INTERNAL_ERROR", "Failed to save hold"))
+		return
+	}
+	log.Printf("Admin: legal hold %s created (%s)", hd.ID, hd.Reason)
+	respondJSON(w, http.StatusCreated, HoldView{Hold: hd, Active: true})
+}
+
+func (h *HoldsHandler) release(w http.ResponseWriter, id string) {
+	hd, err := h.holds.Release(id)
+	switch {
+	case errors.Is(err, hold.ErrNotFound):
+		respondError(w, http.StatusNotFound,
+			models.NewAPIError(models.ErrCodeNotFound, "Hold not found: "+id))
+		return
+	case err != nil:
+		log.Printf("Holds: %v", err)
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError("INTERNAL_ERROR", "Failed to release hold"))
+		return
+	}
+	log.Printf("Admin: legal hold %s released (%s)", hd.ID, hd.Reason)
+	respondJSON(w, http.StatusOK, HoldView{Hold: hd})
+}
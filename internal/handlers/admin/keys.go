@@ -21,22 +21,36 @@ func NewKeysHandler(cfg *config.Config) *KeysHandler {
 	return &KeysHandler{cfg: cfg}
 }
 
-// KeyResponse is returned for each stored read-only key.
-// The actual key hash is never exposed; only the name.
+// Key scopes accepted by POST /api/admin/keys.
+const (
+	scopeRead  = "read"  // read-only key (default)
+	scopeWrite = "write" // write key for POST /api/ingest
+)
+
+// KeyResponse is returned for each stored key.
+// The actual key hash is never exposed; only the name, scope and quotas.
 type KeyResponse struct {
-	Name string `json:"name"`
+	Name           string `json:"name"`
+	Scope          string `json:"scope"`
+	QuotaPerMinute int    `json:"quota_per_minute,omitempty"`
+	QuotaPerDay    int    `json:"quota_per_day,omitempty"`
 }
 
 // CreateKeyResponse includes the plaintext key, shown exactly once.
 type CreateKeyResponse struct {
 	Name      string `json:"name"`
+	Scope     string `json:"scope"`
 	Key       string `json:"key"` // plaintext – shown once, never stored
 	Message   string `json:"message"`
 }
 
 // CreateKeyRequest is the payload for POST /api/admin/keys.
+// Quotas apply to write keys only; 0 means unlimited.
 type CreateKeyRequest struct {
-	Name string `json:"name"`
+	Name           string `json:"name"`
+	Scope          string `json:"scope"` // "read" (default) or "write"
+	QuotaPerMinute int    `json:"quota_per_minute"`
+	QuotaPerDay    int    `json:"quota_per_day"`
 }
 
 // ServeHTTP routes based on method and path suffix.
@@ -66,9 +80,13 @@ func (h *KeysHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *KeysHandler) handleList(w http.ResponseWriter) {
-	keys := make([]KeyResponse, len(h.cfg.Auth.ReadOnlyKeys))
-	for i, k := range h.cfg.Auth.ReadOnlyKeys {
-		keys[i] = KeyResponse{Name: k.Name}
+	keys := make([]KeyResponse, 0, len(h.cfg.Auth.ReadOnlyKeys)+len(h.cfg.Auth.WriteKeys))
+	for _, k := range h.cfg.Auth.ReadOnlyKeys {
+		keys = append(keys, KeyResponse{Name: k.Name, Scope: scopeRead})
+	}
+	for _, k := range h.cfg.Auth.WriteKeys {
+		keys = append(keys, KeyResponse{Name: k.Name, Scope: scopeWrite,
+			QuotaPerMinute: k.QuotaPerMinute, QuotaPerDay: k.QuotaPerDay})
 	}
 	respondJSON(w, http.StatusOK, keys)
 }
@@ -88,16 +106,32 @@ func (h *KeysHandler) handleCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check for duplicate names
-	for _, k := range h.cfg.Auth.ReadOnlyKeys {
-		if k.Name == req.Name {
-			respondError(w, http.StatusConflict,
-				models.NewAPIError("CONFLICT", "A key with this name already exists"))
-			return
-		}
+	if req.Scope == "" {
+		req.Scope = scopeRead
+	}
+	if req.Scope != scopeRead && req.Scope != scopeWrite {
+		respondError(w, http.StatusBadRequest,
+			models.NewValidationError("scope", "Scope must be 'read' or 'write'"))
+		return
+	}
+	if req.QuotaPerMinute < 0 || req.QuotaPerDay < 0 {
+		respondError(w, http.StatusBadRequest,
+			models.NewValidationError("quota", "Quotas must not be negative"))
+		return
 	}
 
-	plaintext, hash, err := auth.GenerateReadOnlyKey()
+	// Check for duplicate names (across both scopes, names identify keys on delete)
+	if h.keyExists(req.Name) {
+		respondError(w, http.StatusConflict,
+			models.NewAPIError("CONFLICT", "A key with this name already exists"))
+		return
+	}
+
+	generate := auth.GenerateReadOnlyKey
+	if req.Scope == scopeWrite {
+		generate = auth.GenerateWriteKey
+	}
+	plaintext, hash, err := generate()
 	if err != nil {
 		log.Printf("Keys: failed to generate key: %v", err)
 		respondError(w, http.StatusInternalServerError,
@@ -105,10 +139,19 @@ func (h *KeysHandler) handleCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.cfg.Auth.ReadOnlyKeys = append(h.cfg.Auth.ReadOnlyKeys, config.ReadOnlyKey{
-		Name:    req.Name,
-		KeyHash: hash,
-	})
+	if req.Scope == scopeWrite {
+		h.cfg.Auth.WriteKeys = append(h.cfg.Auth.WriteKeys, config.WriteKey{
+			Name:           req.Name,
+			KeyHash:        hash,
+			QuotaPerMinute: req.QuotaPerMinute,
+			QuotaPerDay:    req.QuotaPerDay,
+		})
+	} else {
+		h.cfg.Auth.ReadOnlyKeys = append(h.cfg.Auth.ReadOnlyKeys, config.ReadOnlyKey{
+			Name:    req.Name,
+			KeyHash: hash,
+		})
+	}
 
 	if err := config.Save(h.cfg); err != nil {
 		log.Printf("Keys: failed to save config: %v", err)
@@ -117,9 +160,10 @@ func (h *KeysHandler) handleCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Admin: created read-only key %q", req.Name)
+	log.Printf("Admin: created %s key %q", req.Scope, req.Name)
 	respondJSON(w, http.StatusCreated, CreateKeyResponse{
 		Name:    req.Name,
+		Scope:   req.Scope,
 		Key:     plaintext,
 		Message: "Store this key securely — it will not be shown again.",
 	})
@@ -136,6 +180,15 @@ func (h *KeysHandler) handleDelete(w http.ResponseWriter, name string) {
 		filtered = append(filtered, k)
 	}
 
+	writeKeys := h.cfg.Auth.WriteKeys[:0]
+	for _, k := range h.cfg.Auth.WriteKeys {
+		if k.Name == name {
+			found = true
+			continue
+		}
+		writeKeys = append(writeKeys, k)
+	}
+
 	if !found {
 		respondError(w, http.StatusNotFound,
 			models.NewAPIError(models.ErrCodeNotFound, "Key not found: "+name))
@@ -143,6 +196,7 @@ func (h *KeysHandler) handleDelete(w http.ResponseWriter, name string) {
 	}
 
 	h.cfg.Auth.ReadOnlyKeys = filtered
+	h.cfg.Auth.WriteKeys = writeKeys
 
 	if err := config.Save(h.cfg); err != nil {
 		log.Printf("Keys: failed to save config: %v", err)
@@ -151,6 +205,21 @@ func (h *KeysHandler) handleDelete(w http.ResponseWriter, name string) {
 		return
 	}
 
-	log.Printf("Admin: deleted read-only key %q", name)
+	log.Printf("Admin: deleted key %q", name)
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Key deleted"})
 }
+
+// keyExists reports whether a read-only or write key with name exists.
+func (h *KeysHandler) keyExists(name string) bool {
+	for _, k := range h.cfg.Auth.ReadOnlyKeys {
+		if k.Name == name {
+			return true
+		}
+	}
+	for _, k := range h.cfg.Auth.WriteKeys {
+		if k.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package admin
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/partition"
+)
+
+// PartitionsHandler handles /api/admin/partitions endpoints:
+//
+//	GET  /api/admin/partitions                                  → state, partitions, migration progress
+//	POST /api/admin/partitions/migrate[?confirm_primary_key=true] → convert SystemEvents in the background
+type PartitionsHandler struct {
+	partitions *partition.Manager
+}
+
+func NewPartitionsHandler(m *partition.Manager) *PartitionsHandler {
+	return &PartitionsHandler{partitions: m}
+}
+
+func (h *PartitionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/admin/partitions":
+		if r.Method != http.MethodGet {
+			respondError(w, http.StatusMethodNotAllowed,
+				models.NewAPIError("METHOD_NOT_ALLOWED", "Only GET is allowed"))
+			return
+		}
+		respondJSON(w, http.StatusOK, h.partitions.Status())
+
+	case "/api/admin/partitions/migrate":
+		if r.Method != http.MethodPost {
+			respondError(w, http.StatusMethodNotAllowed,
+				models.NewAPIError("METHOD_NOT_ALLOWED", "Only POST is allowed"))
+			return
+		}
+		confirm := false
+		if v := r.URL.Query().Get("confirm_primary_key"); v != "" {
+			var err error
+			if confirm, err = strconv.ParseBool(v); err != nil {
+				respondError(w, http.StatusBadRequest,
+					models.NewValidationError("confirm_primary_key", "Must be true or false"))
+				return
+			}
+		}
+		h.migrate(w, confirm)
+
+	default:
+		respondError(w, http.StatusNotFound,
+			models.NewAPIError(models.ErrCodeNotFound, "Unknown partitions endpoint"))
+	}
+}
+
+func (h *PartitionsHandler) migrate(w http.ResponseWriter, confirm bool) {
+	err := h.partitions.Migrate(confirm)
+	switch {
+	case err == nil:
+		log.Printf("Admin: SystemEvents partition migration started")
+		respondJSON(w, http.StatusAccepted, h.partitions.Status())
+	case errors.Is(err, partition.ErrDisabled):
+		respondError(w, http.StatusNotFound,
+			models.NewAPIError(models.ErrCodeNotFound, "Partitioning is disabled ([partitions] enabled = false)"))
+	case errors.Is(err, partition.ErrConfirmRequired):
+		respondError(w, http.StatusConflict,
+			models.NewAPIError("CONFIRMATION_REQUIRED", err.Error()).
+				WithDetails("Repeat the request with confirm_primary_key=true"))
+	case errors.Is(err, partition.ErrAlreadyPartitioned), errors.Is(err, partition.ErrMigrationRunning):
+		respondError(w, http.StatusConflict, models.NewAPIError("CONFLICT", err.Error()))
+	default:
+		log.Printf("Partitions: migration not started: %v", err)
+		respondError(w, http.StatusConflict,
+			models.NewAPIError("MIGRATION_REFUSED", "Migration not started").WithDetails(err.Error()))
+	}
+}
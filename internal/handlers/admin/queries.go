@@ -0,0 +1,35 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/querylog"
+)
+
+// QueriesHandler handles /api/admin/queries endpoints:
+//
+//	GET /api/admin/queries/slow → slowest recent queries and latency histograms
+type QueriesHandler struct {
+	queries *querylog.Recorder
+}
+
+func NewQueriesHandler(rec *querylog.Recorder) *QueriesHandler {
+	return &QueriesHandler{queries: rec}
+}
+
+func (h *QueriesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/admin/queries/slow":
+		if r.Method != http.MethodGet {
+			respondError(w, http.StatusMethodNotAllowed,
+				models.NewAPIError("METHOD_NOT_ALLOWED", "Only GET is allowed"))
+			return
+		}
+		respondJSON(w, http.StatusOK, h.queries.Report())
+
+	default:
+		respondError(w, http.StatusNotFound,
+			models.NewAPIError(models.ErrCodeNotFound, "Unknown queries endpoint"))
+	}
+}
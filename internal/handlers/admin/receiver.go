@@ -0,0 +1,25 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/receiver"
+)
+
+// ReceiverHandler handles GET /api/admin/receiver.
+// It returns the ingest counters of the built-in syslog receiver.
+type ReceiverHandler struct {
+	receiver *receiver.Receiver // nil or disabled when [receiver] is off
+}
+
+func NewReceiverHandler(r *receiver.Receiver) *ReceiverHandler { return &ReceiverHandler{receiver: r} }
+
+func (h *ReceiverHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed,
+			models.NewAPIError("METHOD_NOT_ALLOWED", "Only GET is allowed"))
+		return
+	}
+	respondJSON(w, http.StatusOK, h.receiver.Stats())
+}
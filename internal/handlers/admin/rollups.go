@@ -0,0 +1,52 @@
+package admin
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/rollup"
+)
+
+// RollupsHandler handles /api/admin/rollups endpoints:
+//
+//	GET  /api/admin/rollups         → state of the rollup worker
+//	POST /api/admin/rollups/rebuild → discard the rollups and count all rows again
+type RollupsHandler struct {
+	rollups *rollup.Worker
+}
+
+func NewRollupsHandler(w *rollup.Worker) *RollupsHandler {
+	return &RollupsHandler{rollups: w}
+}
+
+func (h *RollupsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/admin/rollups":
+		if r.Method != http.MethodGet {
+			respondError(w, http.StatusMethodNotAllowed,
+				models.NewAPIError("METHOD_NOT_ALLOWED", "Only GET is allowed"))
+			return
+		}
+		respondJSON(w, http.StatusOK, h.rollups.Status())
+
+	case "/api/admin/rollups/rebuild":
+		if r.Method != http.MethodPost {
+			respondError(w, http.StatusMethodNotAllowed,
+				models.NewAPIError("METHOD_NOT_ALLOWED", "Only POST is allowed"))
+			return
+		}
+		if err := h.rollups.Rebuild(); errors.Is(err, rollup.ErrDisabled) {
+			respondError(w, http.StatusNotFound,
+				models.NewAPIError(models.ErrCodeNotFound, "Rollups are disabled ([rollups] enabled = false)"))
+			return
+		}
+		log.Printf("Admin: rollup rebuild requested")
+		respondJSON(w, http.StatusAccepted, h.rollups.Status())
+
+	default:
+		respondError(w, http.StatusNotFound,
+			models.NewAPIError(models.ErrCodeNotFound, "Unknown rollups endpoint"))
+	}
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/phil-bot/rsyslox/internal/anomaly"
+	"github.com/phil-bot/rsyslox/internal/models"
+)
+
+// AnomaliesHandler handles GET /api/anomalies.
+type AnomaliesHandler struct {
+	detector *anomaly.Detector // nil when anomaly detection is disabled
+}
+
+// NewAnomaliesHandler creates a new AnomaliesHandler.
+func NewAnomaliesHandler(detector *anomaly.Detector) *AnomaliesHandler {
+	return &AnomaliesHandler{detector: detector}
+}
+
+// ServeHTTP returns the anomalies flagged within the retention window.
+// Optional query parameters: dimension (host|tag), min_score (float).
+func (h *AnomaliesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed,
+			models.NewAPIError("METHOD_NOT_ALLOWED", "Only GET method is allowed"))
+		return
+	}
+
+	query := r.URL.Query()
+
+	dim := anomaly.Dimension(query.Get("dimension"))
+	if dim != "" && !anomaly.IsValidDimension(dim) {
+		respondError(w, http.StatusBadRequest,
+			models.NewValidationError("dimension", "must be 'host' or 'tag'"))
+		return
+	}
+
+	var minScore float64
+	if s := query.Get("min_score"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v < 0 {
+			respondError(w, http.StatusBadRequest,
+				models.NewValidationError("min_score", "must be a non-negative number"))
+			return
+		}
+		minScore = v
+	}
+
+	respondJSON(w, http.StatusOK, h.detector.Snapshot(dim, minScore))
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/phil-bot/rsyslox/internal/database"
+	"github.com/phil-bot/rsyslox/internal/models"
+)
+
+// ExplainHandler handles GET /api/admin/explain. It accepts the query
+// string of GET /api/logs and returns the query plans instead of the rows.
+type ExplainHandler struct {
+	sources *database.Sources
+	db      *database.DB // primary source: column expressions and parsers
+}
+
+// NewExplainHandler creates a new ExplainHandler.
+func NewExplainHandler(sources *database.Sources) *ExplainHandler {
+	return &ExplainHandler{sources: sources, db: sources.Primary()}
+}
+
+type explainResponse struct {
+	Where   string                 `json:"where"`
+	Args    []interface{}          `json:"args"`
+	Sources []database.LogsExplain `json:"sources"`
+}
+
+func (h *ExplainHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed,
+			models.NewAPIError("METHOD_NOT_ALLOWED", "Only GET method is allowed"))
+		return
+	}
+
+	q, apiErr := parseLogsQuery(r.URL.Query(), h.db)
+	if apiErr != nil {
+		respondError(w, http.StatusBadRequest, apiErr)
+		return
+	}
+
+	plans, err := h.sources.ExplainLogs(q.where, q.args, q.limit, q.offset, q.cursor, len(q.fieldFilters) > 0)
+	if err != nil {
+		if apiErr, ok := err.(*models.APIError); ok {
+			respondError(w, http.StatusBadRequest, apiErr)
+			return
+		}
+		log.Printf("Explain error: %v", err)
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError(models.ErrCodeDatabaseError, "Failed to explain the query"))
+		return
+	}
+
+	args := q.args
+	if args == nil {
+		args = []interface{}{}
+	}
+	respondJSON(w, http.StatusOK, explainResponse{Where: q.where, Args: args, Sources: plans})
+}
@@ -20,18 +20,21 @@ type HealthResponse struct {
 	Version   string `json:"version"`
 	Timestamp string `json:"timestamp"`
 	SetupMode bool   `json:"setup_mode,omitempty"`
+
+	// Sources reports each configured database; only set with [[databases]].
+	Sources []database.SourceHealth `json:"sources,omitempty"`
 }
 
 // HealthHandler handles GET /health.
 type HealthHandler struct {
-	db      *database.DB // nil while in setup mode
+	sources *database.Sources // nil while in setup mode
 	version string
 }
 
 // NewHealthHandler creates a HealthHandler.
-// db may be nil when the server starts without a config (setup mode).
-func NewHealthHandler(db *database.DB, version string) *HealthHandler {
-	return &HealthHandler{db: db, version: version}
+// sources may be nil when the server starts without a config (setup mode).
+func NewHealthHandler(sources *database.Sources, version string) *HealthHandler {
+	return &HealthHandler{sources: sources, version: version}
 }
 
 func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -61,9 +64,9 @@ func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Config exists — normal operation.
-	// db may still be nil if the server hasn't restarted yet after setup;
+	// sources may still be nil if the server hasn't restarted yet after setup;
 	// report as "pending" so the frontend can show a useful message.
-	if h.db == nil {
+	if h.sources == nil {
 		w.WriteHeader(http.StatusOK)
 		if encErr := json.NewEncoder(w).Encode(HealthResponse{
 			Status:    "pending_restart",
@@ -75,25 +78,39 @@ func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.db.Health(); err != nil {
+	list, healthy := h.sources.Health()
+	var perSource []database.SourceHealth
+	if h.sources.Multi() {
+		perSource = list
+	}
+
+	if healthy == 0 {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		if encErr := json.NewEncoder(w).Encode(HealthResponse{
 			Status:    "unhealthy",
 			Database:  "disconnected",
 			Version:   h.version,
 			Timestamp: time.Now().Format(time.RFC3339),
+			Sources:   perSource,
 		}); encErr != nil {
 			log.Printf("health: encode error: %v", encErr)
 		}
 		return
 	}
 
+	// Some sources down: still serving (partial results), so 200.
+	status, dbState := "healthy", "connected"
+	if healthy < len(list) {
+		status, dbState = "degraded", "partial"
+	}
+
 	w.WriteHeader(http.StatusOK)
 	if encErr := json.NewEncoder(w).Encode(HealthResponse{
-		Status:    "healthy",
-		Database:  "connected",
+		Status:    status,
+		Database:  dbState,
 		Version:   h.version,
 		Timestamp: time.Now().Format(time.RFC3339),
+		Sources:   perSource,
 	}); encErr != nil {
 		log.Printf("health: encode error: %v", encErr)
 	}
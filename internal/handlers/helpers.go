@@ -2,10 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/querylimit"
 )
 
 // respondJSON sends a JSON response with proper headers
@@ -29,3 +32,18 @@ func respondError(w http.ResponseWriter, status int, err *models.APIError) {
 		log.Printf("Error encoding error response: %v", encodeErr)
 	}
 }
+
+// respondQueryError sends 503 with Retry-After when the query limits turned
+// the request away, and a 500 database error with message otherwise.
+func respondQueryError(w http.ResponseWriter, err error, message string) {
+	var busy *querylimit.OverloadedError
+	if errors.As(err, &busy) {
+		w.Header().Set("Retry-After", strconv.Itoa(busy.RetryAfterSeconds()))
+		respondError(w, http.StatusServiceUnavailable,
+			models.NewAPIError(models.ErrCodeOverloaded, "Too many concurrent queries, retry later").
+				WithDetails(busy.Error()))
+		return
+	}
+	respondError(w, http.StatusInternalServerError,
+		models.NewAPIError(models.ErrCodeDatabaseError, message))
+}
@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/config"
+	"github.com/phil-bot/rsyslox/internal/database"
+	"github.com/phil-bot/rsyslox/internal/middleware"
+	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/syslog"
+)
+
+const (
+	// maxIngestBody is the maximum request body size of POST /api/ingest.
+	maxIngestBody = 10 << 20
+
+	// maxIngestEntries is the maximum number of entries per request.
+	maxIngestEntries = 10000
+
+	// maxIngestMessage is the maximum length of one message in bytes.
+	maxIngestMessage = 64 * 1024
+)
+
+// IngestEntry is one log entry submitted to POST /api/ingest.
+// Severity defaults to 6 (informational), facility to 1 (user) and
+// timestamp to the time of the request.
+type IngestEntry struct {
+	Host      string     `json:"host"`
+	Tag       string     `json:"tag"`
+	Severity  *int       `json:"severity"`
+	Facility  *int       `json:"facility"`
+	Message   string     `json:"message"`
+	Timestamp *time.Time `json:"timestamp"`
+}
+
+// IngestResponse is returned for accepted entries.
+type IngestResponse struct {
+	Accepted int `json:"accepted"`
+}
+
+// IngestHandler handles POST /api/ingest.
+type IngestHandler struct {
+	db     *database.DB // entries are written to the primary source
+	quotas *quotaTracker
+}
+
+// NewIngestHandler creates a new IngestHandler.
+func NewIngestHandler(sources *database.Sources) *IngestHandler {
+	return &IngestHandler{db: sources.Primary(), quotas: newQuotaTracker()}
+}
+
+// ServeHTTP validates the submitted entries and inserts them in one batch.
+// The body is a JSON array of entries or NDJSON (one entry per line).
+// A request is accepted or rejected as a whole.
+func (h *IngestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed,
+			models.NewAPIError("METHOD_NOT_ALLOWED", "Only POST method is allowed"))
+		return
+	}
+
+	key, ok := middleware.WriteKey(r)
+	if !ok {
+		respondError(w, http.StatusUnauthorized,
+			models.NewAPIError(models.ErrCodeUnauthorized, "Write key required"))
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIngestBody))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondError(w, http.StatusRequestEntityTooLarge,
+				models.NewAPIError(models.ErrCodeInvalidParameter,
+					fmt.Sprintf("Request body exceeds %d bytes", maxIngestBody)))
+			return
+		}
+		respondError(w, http.StatusBadRequest,
+			models.NewAPIError(models.ErrCodeInvalidParameter, "Failed to read request body"))
+		return
+	}
+
+	entries, err := decodeIngest(body)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.(*models.APIError))
+		return
+	}
+	if len(entries) == 0 {
+		respondError(w, http.StatusBadRequest,
+			models.NewAPIError(models.ErrCodeMissingParameter, "No entries submitted"))
+		return
+	}
+	if len(entries) > maxIngestEntries {
+		respondError(w, http.StatusBadRequest,
+			models.NewAPIError(models.ErrCodeInvalidParameter,
+				fmt.Sprintf("At most %d entries per request", maxIngestEntries)))
+		return
+	}
+	if limit := maxBatch(key); limit > 0 && len(entries) > limit {
+		// Waiting for the quota cannot help: reject instead of 429.
+		respondError(w, http.StatusRequestEntityTooLarge,
+			models.NewAPIError(models.ErrCodeQuotaExceeded,
+				fmt.Sprintf("%d entries exceed the quota of key %q (%d); split the batch",
+					len(entries), key.Name, limit)))
+		return
+	}
+
+	now := time.Now()
+	msgs := make([]syslog.Message, len(entries))
+	for i, e := range entries {
+		msg, apiErr := e.toMessage(now, clientHost(r))
+		if apiErr != nil {
+			respondError(w, http.StatusBadRequest,
+				apiErr.WithField(fmt.Sprintf("entries[%d].%s", i, apiErr.Field)))
+			return
+		}
+		msgs[i] = msg
+	}
+
+	if retryAfter, ok := h.quotas.take(key, len(msgs), now); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		respondError(w, http.StatusTooManyRequests,
+			models.NewAPIError(models.ErrCodeQuotaExceeded,
+				fmt.Sprintf("Quota of key %q exceeded", key.Name)))
+		return
+	}
+
+	if err := h.db.InsertEvents(msgs); err != nil {
+		h.quotas.refund(key, len(msgs))
+		log.Printf("Ingest: key %q: %v", key.Name, err)
+		respondError(w, http.StatusInternalServerError,
+			models.NewAPIError(models.ErrCodeDatabaseError, "Failed to store entries"))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, IngestResponse{Accepted: len(msgs)})
+}
+
+// decodeIngest parses a JSON array or NDJSON body.
+func decodeIngest(body []byte) ([]IngestEntry, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var entries []IngestEntry
+		if err := json.Unmarshal(trimmed, &entries); err != nil {
+			return nil, models.NewAPIError(models.ErrCodeInvalidParameter, "Invalid JSON array").
+				WithDetails(err.Error())
+		}
+		return entries, nil
+	}
+
+	var entries []IngestEntry
+	scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+	scanner.Buffer(make([]byte, 64*1024), maxIngestBody)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var e IngestEntry
+		if err := json.Unmarshal(text, &e); err != nil {
+			return nil, models.NewAPIError(models.ErrCodeInvalidParameter,
+				fmt.Sprintf("Invalid JSON on line %d", line)).WithDetails(err.Error())
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// toMessage validates the entry and converts it to a SystemEvents row.
+// The returned error's Field names the offending attribute.
+func (e IngestEntry) toMessage(now time.Time, remoteHost string) (syslog.Message, *models.APIError) {
+	severity, facility := 6, 1
+	if e.Severity != nil {
+		severity = *e.Severity
+	}
+	if e.Facility != nil {
+		facility = *e.Facility
+	}
+	if !models.IsValidSeverity(severity) {
+		return syslog.Message{}, &models.APIError{Code: models.ErrCodeInvalidSeverity,
+			Field: "severity", Message: "must be between 0 and 7"}
+	}
+	if !models.IsValidFacility(facility) {
+		return syslog.Message{}, &models.APIError{Code: models.ErrCodeInvalidFacility,
+			Field: "facility", Message: "must be between 0 and 23"}
+	}
+	if strings.TrimSpace(e.Message) == "" {
+		return syslog.Message{}, models.NewValidationError("message", "is required")
+	}
+	if len(e.Message) > maxIngestMessage {
+		return syslog.Message{}, models.NewValidationError("message",
+			fmt.Sprintf("exceeds %d bytes", maxIngestMessage))
+	}
+	if strings.ContainsAny(e.Tag, " \t\n") {
+		return syslog.Message{}, models.NewValidationError("tag", "must not contain whitespace")
+	}
+
+	reported := now
+	if e.Timestamp != nil {
+		reported = *e.Timestamp
+	}
+	host := e.Host
+	if host == "" {
+		host = remoteHost
+	}
+	tag := e.Tag
+	if tag != "" && !strings.HasSuffix(tag, ":") {
+		tag += ":" // stored like rsyslog stores SysLogTag
+	}
+
+	return syslog.Message{
+		ReceivedAt:         now,
+		DeviceReportedTime: reported,
+		Facility:           facility,
+		Severity:           severity,
+		FromHost:           host,
+		SysLogTag:          tag,
+		Message:            e.Message,
+	}, nil
+}
+
+// clientHost returns the IP address of the client.
+func clientHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// quotaTracker counts the entries submitted per write key in the current
+// minute and calendar day. Counts are kept in memory and reset on restart.
+type quotaTracker struct {
+	mu    sync.Mutex
+	usage map[string]*quotaUsage
+}
+
+type quotaUsage struct {
+	minute      time.Time // start of the counted minute
+	minuteCount int
+	day         time.Time // start of the counted day
+	dayCount    int
+}
+
+func newQuotaTracker() *quotaTracker {
+	return &quotaTracker{usage: make(map[string]*quotaUsage)}
+}
+
+// maxBatch returns the most entries one request of key can ever submit:
+// the smaller of its quotas, or 0 when it has none.
+func maxBatch(key config.WriteKey) int {
+	limit := key.QuotaPerMinute
+	if key.QuotaPerDay > 0 && (limit == 0 || key.QuotaPerDay < limit) {
+		limit = key.QuotaPerDay
+	}
+	return limit
+}
+
+// take reserves n entries for key. When a quota would be exceeded nothing
+// is reserved and the time until the quota resets is returned.
+func (q *quotaTracker) take(key config.WriteKey, n int, now time.Time) (time.Duration, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	u, ok := q.usage[key.Name]
+	if !ok {
+		u = &quotaUsage{}
+		q.usage[key.Name] = u
+	}
+	minute := now.Truncate(time.Minute)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if !u.minute.Equal(minute) {
+		u.minute, u.minuteCount = minute, 0
+	}
+	if !u.day.Equal(day) {
+		u.day, u.dayCount = day, 0
+	}
+
+	if key.QuotaPerDay > 0 && u.dayCount+n > key.QuotaPerDay {
+		return day.AddDate(0, 0, 1).Sub(now), false
+	}
+	if key.QuotaPerMinute > 0 && u.minuteCount+n > key.QuotaPerMinute {
+		return minute.Add(time.Minute).Sub(now), false
+	}
+	u.minuteCount += n
+	u.dayCount += n
+	return 0, true
+}
+
+// refund returns entries that were reserved but not stored.
+func (q *quotaTracker) refund(key config.WriteKey, n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if u, ok := q.usage[key.Name]; ok {
+		u.minuteCount = max(u.minuteCount-n, 0)
+		u.dayCount = max(u.dayCount-n, 0)
+	}
+}
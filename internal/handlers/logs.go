@@ -1,22 +1,29 @@
 package handlers
 
 import (
+	"bufio"
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/phil-bot/rsyslox/internal/database"
+	"github.com/phil-bot/rsyslox/internal/fields"
 	"github.com/phil-bot/rsyslox/internal/filters"
 	"github.com/phil-bot/rsyslox/internal/models"
 )
 
 // LogsHandler handles GET /api/logs.
 type LogsHandler struct {
-	db *database.DB
+	sources *database.Sources
+	db      *database.DB // primary source: column expressions and parsers
 }
 
 // NewLogsHandler creates a new LogsHandler.
-func NewLogsHandler(db *database.DB) *LogsHandler {
-	return &LogsHandler{db: db}
+func NewLogsHandler(sources *database.Sources) *LogsHandler {
+	return &LogsHandler{sources: sources, db: sources.Primary()}
 }
 
 // ServeHTTP handles the /api/logs endpoint.
@@ -27,30 +34,171 @@ func (h *LogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := r.URL.Query()
+	q, apiErr := parseLogsQuery(r.URL.Query(), h.db)
+	if apiErr != nil {
+		respondError(w, http.StatusBadRequest, apiErr)
+		return
+	}
 
-	// Pagination
-	limit, offset, err := filters.ValidatePagination(query.Get("limit"), query.Get("offset"))
+	// Query all database sources in parallel; the rows are merged by
+	// ReceivedAt while the response is written.
+	stream, err := h.sources.StreamLogs(r.Context(), q.where, q.args, q.limit, q.offset, q.cursor, q.match())
 	if err != nil {
 		if apiErr, ok := err.(*models.APIError); ok {
 			respondError(w, http.StatusBadRequest, apiErr)
-		} else {
-			respondError(w, http.StatusBadRequest,
-				models.NewAPIError(models.ErrCodeInvalidParameter, err.Error()))
+			return
 		}
+		log.Printf("Query error: %v", err)
+		respondQueryError(w, err, "Failed to query logs")
 		return
 	}
+	defer stream.Close()
+
+	writeLogs(w, q, stream)
+}
+
+// writeLogs writes the models.LogsResponse of stream field by field: the
+// totals first, then every row as soon as it is read, so that memory use
+// does not grow with the page size. Errors after the status line are
+// reported in the "error" field. With field filters, only the SQL
+// pre-selection could be counted up front: "total" follows the rows and is
+// the number of matching entries when all rows were read, otherwise null.
+func writeLogs(w http.ResponseWriter, q *logsQuery, stream *database.LogsStream) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	bw := bufio.NewWriterSize(deadlineWriter{w, rc}, 32<<10)
+	bw.WriteByte('{')
+	fieldFilters := len(q.fieldFilters) > 0
+	if !fieldFilters {
+		fmt.Fprintf(bw, `"total":%d,`, stream.Total)
+	}
+	fmt.Fprintf(bw, `"db_total":%d,"offset":%d,"limit":%d,"rows":[`,
+		stream.DBTotal, q.offset, q.limit)
+	bw.Flush()
+	rc.Flush()
+
+	var streamErr error
+	n := 0
+	for stream.Next() {
+		entry := stream.Entry()
+		b, err := json.Marshal(entry)
+		if err != nil {
+			streamErr = fmt.Errorf("encoding entry %d: %w", entry.ID, err)
+			break
+		}
+		if n > 0 {
+			bw.WriteByte(',')
+		}
+		if _, err := bw.Write(b); err != nil {
+			// The client went away.
+			log.Printf("Error writing logs response: %v", err)
+			return
+		}
+		n++
+	}
+	if streamErr == nil {
+		streamErr = stream.Err()
+	}
+	bw.WriteByte(']')
+
+	if fieldFilters {
+		var total *int
+		if matched, ok := stream.MatchedTotal(); ok {
+			total = &matched
+		}
+		writeJSONField(bw, "total", total)
+	}
+	if c := stream.NextCursor(); c != "" && streamErr == nil {
+		writeJSONField(bw, "next_cursor", c)
+	}
+	if warnings := stream.Warnings(); len(warnings) > 0 {
+		writeJSONField(bw, "warnings", warnings)
+	}
+	if streamErr != nil {
+		log.Printf("Query error after %d rows: %v", n, streamErr)
+		writeJSONField(bw, "error", streamErr.Error())
+	}
+	bw.WriteString("}\n")
+	if err := bw.Flush(); err != nil {
+		log.Printf("Error writing logs response: %v", err)
+	}
+}
+
+// logsWriteTimeout bounds every write of a streamed page. A client that
+// stops reading would otherwise keep the page's queries, connections and
+// query slots until it disconnects.
+const logsWriteTimeout = 30 * time.Second
+
+// deadlineWriter sets a new write deadline before every write to the client.
+type deadlineWriter struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (d deadlineWriter) Write(b []byte) (int, error) {
+	d.rc.SetWriteDeadline(time.Now().Add(logsWriteTimeout))
+	return d.w.Write(b)
+}
+
+// writeJSONField writes `,"name":value` into a JSON object being written.
+func writeJSONField(w *bufio.Writer, name string, value interface{}) {
+	b, _ := json.Marshal(value)
+	fmt.Fprintf(w, ",%q:%s", name, b)
+}
+
+// logsQuery is a validated /api/logs query string.
+type logsQuery struct {
+	limit, offset int
+	cursor        *database.Cursor // nil: offset pagination
+	where         string
+	args          []interface{}
+	fieldFilters  []fields.Filter // pre-selected in SQL, matched on the rows
+}
+
+// match returns the function that matches the field filters on the rows of
+// the SQL pre-selection, or nil without field filters.
+func (q *logsQuery) match() func(models.LogEntry) bool {
+	if len(q.fieldFilters) == 0 {
+		return nil
+	}
+	return func(entry models.LogEntry) bool {
+		return fields.MatchAll(q.fieldFilters, entry.Fields)
+	}
+}
+
+// parseLogsQuery validates the /api/logs parameters and builds the WHERE
+// clause for db. It is shared by GET /api/logs and GET /api/admin/explain.
+func parseLogsQuery(query url.Values, db *database.DB) (*logsQuery, *models.APIError) {
+	// asAPIError with a fallback code for plain errors
+	invalid := func(err error, code string) *models.APIError {
+		if apiErr, ok := err.(*models.APIError); ok {
+			return apiErr
+		}
+		return models.NewAPIError(code, err.Error())
+	}
+
+	// Pagination
+	limit, offset, err := filters.ValidatePagination(query.Get("limit"), query.Get("offset"))
+	if err != nil {
+		return nil, invalid(err, models.ErrCodeInvalidParameter)
+	}
+
+	// Cursor pagination (takes precedence over offset)
+	var cursor *database.Cursor
+	if c := query.Get("cursor"); c != "" {
+		if cursor, err = database.ParseCursor(c); err != nil {
+			return nil, invalid(err, models.ErrCodeInvalidParameter)
+		}
+		offset = 0
+	}
 
 	// Date range
 	startDate, endDate, err := filters.ValidateDateRange(query.Get("start_date"), query.Get("end_date"))
 	if err != nil {
-		if apiErr, ok := err.(*models.APIError); ok {
-			respondError(w, http.StatusBadRequest, apiErr)
-		} else {
-			respondError(w, http.StatusBadRequest,
-				models.NewAPIError(models.ErrCodeInvalidParameter, err.Error()))
-		}
-		return
+		return nil, invalid(err, models.ErrCodeInvalidParameter)
 	}
 
 	// Severity — accept ?Severity= (preferred) or ?Priority= (deprecated alias)
@@ -60,63 +208,45 @@ func (h *LogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	severities, err := filters.ValidateSeverities(severityParams)
 	if err != nil {
-		if apiErr, ok := err.(*models.APIError); ok {
-			respondError(w, http.StatusBadRequest, apiErr)
-		} else {
-			respondError(w, http.StatusBadRequest,
-				models.NewAPIError(models.ErrCodeInvalidSeverity, err.Error()))
-		}
-		return
+		return nil, invalid(err, models.ErrCodeInvalidSeverity)
 	}
 
 	excludeSeverities, err := filters.ValidateSeverities(query["ExcludeSeverity"])
 	if err != nil {
-		if apiErr, ok := err.(*models.APIError); ok {
-			respondError(w, http.StatusBadRequest, apiErr)
-		} else {
-			respondError(w, http.StatusBadRequest,
-				models.NewAPIError(models.ErrCodeInvalidSeverity, err.Error()))
-		}
-		return
+		return nil, invalid(err, models.ErrCodeInvalidSeverity)
 	}
 
 	// Facility
 	facilities, err := filters.ValidateFacilities(query["Facility"])
 	if err != nil {
-		if apiErr, ok := err.(*models.APIError); ok {
-			respondError(w, http.StatusBadRequest, apiErr)
-		} else {
-			respondError(w, http.StatusBadRequest,
-				models.NewAPIError(models.ErrCodeInvalidFacility, err.Error()))
-		}
-		return
+		return nil, invalid(err, models.ErrCodeInvalidFacility)
 	}
 
 	excludeFacilities, err := filters.ValidateFacilities(query["ExcludeFacility"])
 	if err != nil {
-		if apiErr, ok := err.(*models.APIError); ok {
-			respondError(w, http.StatusBadRequest, apiErr)
-		} else {
-			respondError(w, http.StatusBadRequest,
-				models.NewAPIError(models.ErrCodeInvalidFacility, err.Error()))
-		}
-		return
+		return nil, invalid(err, models.ErrCodeInvalidFacility)
 	}
 
 	// Message search
 	messages, err := filters.ValidateMessages(query["Message"])
 	if err != nil {
-		if apiErr, ok := err.(*models.APIError); ok {
-			respondError(w, http.StatusBadRequest, apiErr)
-		} else {
-			respondError(w, http.StatusBadRequest,
-				models.NewAPIError(models.ErrCodeInvalidParameter, err.Error()))
-		}
-		return
+		return nil, invalid(err, models.ErrCodeInvalidParameter)
+	}
+
+	// Process ID (virtual column derived from SysLogTag)
+	processIDs, err := filters.ValidateIntegers("ProcessID", query["ProcessID"])
+	if err != nil {
+		return nil, invalid(err, models.ErrCodeInvalidParameter)
+	}
+
+	// Structured field filters (field.<name>=value, field.<name>>=n, …)
+	fieldFilters, err := filters.ValidateFieldFilters(query)
+	if err != nil {
+		return nil, invalid(err, models.ErrCodeInvalidParameter)
 	}
 
 	// Build WHERE clause
-	builder := filters.New()
+	builder := filters.NewFor(db.Dialect)
 	builder.AddDateRange(startDate, endDate)
 	builder.AddStringMultiValue("FromHost", query["FromHost"])
 	if len(query["FromHost"]) == 0 {
@@ -135,23 +265,20 @@ func (h *LogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if len(query["SysLogTag"]) == 0 {
 		builder.AddStringExclude("SysLogTag", query["ExcludeSysLogTag"])
 	}
-
-	whereClause, args := builder.Build()
-
-	// Run CountLogs, QueryLogs and TotalCount in parallel.
-	entries, total, dbTotal, err := h.db.QueryLogsWithTotal(whereClause, args, limit, offset)
-	if err != nil {
-		log.Printf("Query error: %v", err)
-		respondError(w, http.StatusInternalServerError,
-			models.NewAPIError(models.ErrCodeDatabaseError, "Failed to query logs"))
-		return
+	builder.AddStringMultiValue(db.ColumnExpr("ProgramName"), query["ProgramName"])
+	if len(query["ProgramName"]) == 0 {
+		builder.AddStringExclude(db.ColumnExpr("ProgramName"), query["ExcludeProgramName"])
 	}
+	builder.AddIntMultiValue(db.ColumnExpr("ProcessID"), processIDs)
+	builder.AddFieldFilters(fieldFilters, db.FieldFilterSQL)
 
-	respondJSON(w, http.StatusOK, models.LogsResponse{
-		Total:   total,
-		DBTotal: dbTotal,
-		Offset:  offset,
-		Limit:   limit,
-		Rows:    entries,
-	})
+	whereClause, args := builder.Build()
+	return &logsQuery{
+		limit:        limit,
+		offset:       offset,
+		cursor:       cursor,
+		where:        whereClause,
+		args:         args,
+		fieldFilters: fieldFilters,
+	}, nil
 }
@@ -1,23 +1,28 @@
 package handlers
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/phil-bot/rsyslox/internal/database"
 	"github.com/phil-bot/rsyslox/internal/filters"
 	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/rollup"
 )
 
 // MetaHandler handles GET /api/meta and GET /api/meta/{column}.
 type MetaHandler struct {
-	db *database.DB
+	sources *database.Sources
+	db      *database.DB   // primary source: column list and parsers
+	rollups *rollup.Worker // counts=true; may be nil
 }
 
-// NewMetaHandler creates a new MetaHandler.
-func NewMetaHandler(db *database.DB) *MetaHandler {
-	return &MetaHandler{db: db}
+// NewMetaHandler creates a new MetaHandler. rollups may be nil.
+func NewMetaHandler(sources *database.Sources, rollups *rollup.Worker) *MetaHandler {
+	return &MetaHandler{sources: sources, db: sources.Primary(), rollups: rollups}
 }
 
 func (h *MetaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -42,23 +47,20 @@ func (h *MetaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *MetaHandler) handleList(w http.ResponseWriter, r *http.Request) {
-	dbTotal, err := h.db.TotalCount()
-	if err != nil {
-		log.Printf("Meta list: TotalCount error: %v", err)
-		dbTotal = 0
+	dbTotal, warnings := h.sources.TotalCount(r.Context())
+	for _, w := range warnings {
+		log.Printf("Meta list: TotalCount error: %s", w)
 	}
 
-	oldest, err := h.db.OldestEntryTime()
-	if err != nil {
-		log.Printf("Meta list: OldestEntryTime error: %v", err)
-		oldest = nil
-	}
+	oldest := h.sources.OldestEntryTime(r.Context())
 
 	respondJSON(w, http.StatusOK, models.MetaResponse{
-		AvailableColumns: h.db.AvailableColumns,
+		AvailableColumns: h.allColumns(),
+		Fields:           h.db.Fields.Fields(),
 		Usage:            "GET /api/meta/{column} to get distinct values for a column",
 		DBTotal:          dbTotal,
 		OldestEntry:      oldest,
+		Warnings:         warnings,
 	})
 }
 
@@ -67,18 +69,20 @@ func (h *MetaHandler) handleColumnValues(w http.ResponseWriter, r *http.Request,
 		respondError(w, http.StatusBadRequest,
 			models.NewAPIError(models.ErrCodeInvalidColumn,
 				"Invalid column: "+column).
-				WithDetails("Available columns: "+strings.Join(h.db.AvailableColumns, ", ")))
+				WithDetails("Available columns: "+strings.Join(h.allColumns(), ", ")))
 		return
 	}
 
 	query := r.URL.Query()
-	builder := filters.New()
+	builder := filters.NewFor(h.db.Dialect)
 
 	// Date range is optional for meta queries
+	var startDate, endDate time.Time
 	startDateStr := query.Get("start_date")
 	endDateStr := query.Get("end_date")
 	if startDateStr != "" || endDateStr != "" {
-		startDate, endDate, err := filters.ValidateDateRange(startDateStr, endDateStr)
+		var err error
+		startDate, endDate, err = filters.ValidateDateRange(startDateStr, endDateStr)
 		if err != nil {
 			if apiErr, ok := err.(*models.APIError); ok {
 				respondError(w, http.StatusBadRequest, apiErr)
@@ -135,6 +139,22 @@ func (h *MetaHandler) handleColumnValues(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
+	processIDs, err := filters.ValidateIntegers("ProcessID", query["ProcessID"])
+	if err != nil {
+		if apiErr, ok := err.(*models.APIError); ok {
+			respondError(w, http.StatusBadRequest, apiErr)
+		}
+		return
+	}
+
+	fieldFilters, err := filters.ValidateFieldFilters(query)
+	if err != nil {
+		if apiErr, ok := err.(*models.APIError); ok {
+			respondError(w, http.StatusBadRequest, apiErr)
+		}
+		return
+	}
+
 	builder.AddStringMultiValue("FromHost", query["FromHost"])
 	if len(query["FromHost"]) == 0 {
 		builder.AddStringExclude("FromHost", query["ExcludeFromHost"])
@@ -152,16 +172,74 @@ func (h *MetaHandler) handleColumnValues(w http.ResponseWriter, r *http.Request,
 	if len(query["SysLogTag"]) == 0 {
 		builder.AddStringExclude("SysLogTag", query["ExcludeSysLogTag"])
 	}
+	builder.AddStringMultiValue(h.db.ColumnExpr("ProgramName"), query["ProgramName"])
+	if len(query["ProgramName"]) == 0 {
+		builder.AddStringExclude(h.db.ColumnExpr("ProgramName"), query["ExcludeProgramName"])
+	}
+	builder.AddIntMultiValue(h.db.ColumnExpr("ProcessID"), processIDs)
+	builder.AddFieldFilters(fieldFilters, h.db.FieldFilterSQL)
 
 	whereClause, args := builder.Build()
 
-	values, err := h.db.QueryDistinctValues(column, whereClause, args)
+	if query.Get("counts") == "true" {
+		dims := database.RollupFilter{
+			Hosts:      query["FromHost"],
+			Tags:       query["ProgramName"],
+			Facilities: facilities,
+			Severities: severities,
+		}
+		h.handleCounts(w, r, column, startDate, endDate, dims, whereClause, args)
+		return
+	}
+
+	values, warnings, err := h.sources.QueryDistinctValues(r.Context(), column, whereClause, args)
 	if err != nil {
 		log.Printf("Meta query error: %v", err)
-		respondError(w, http.StatusInternalServerError,
-			models.NewAPIError(models.ErrCodeDatabaseError, "Failed to query metadata"))
+		respondQueryError(w, err, "Failed to query metadata")
 		return
 	}
 
+	// The body is a plain array, so partial results are flagged in a header.
+	for _, msg := range warnings {
+		w.Header().Add("Warning", fmt.Sprintf("199 rsyslox %q", msg))
+	}
+
 	respondJSON(w, http.StatusOK, values)
 }
+
+// handleCounts returns the entries per value of column, most frequent
+// first. The rollups answer it when only their dimensions are filtered and
+// the date range is aligned to minutes or hours; without a date range all
+// entries are counted.
+func (h *MetaHandler) handleCounts(w http.ResponseWriter, r *http.Request, column string,
+	start, end time.Time, dims database.RollupFilter, whereClause string, args []interface{}) {
+	if !isCountColumn(column) {
+		respondError(w, http.StatusBadRequest,
+			models.NewValidationError("counts", "Only supported for FromHost, ProgramName, Facility and Severity"))
+		return
+	}
+	if start.IsZero() {
+		start, end = time.Unix(0, 0), time.Now().Truncate(time.Hour).Add(time.Hour)
+	}
+
+	counts, _, warnings, err := countValues(r.Context(), h.sources, h.rollups, column,
+		rollupQuery(start, end, dims, column), !h.sources.Multi() && onlyRollupParams(r.URL.Query()), whereClause, args)
+	if err != nil {
+		log.Printf("Meta count error: %v", err)
+		respondQueryError(w, err, "Failed to count metadata")
+		return
+	}
+
+	for _, msg := range warnings {
+		w.Header().Add("Warning", fmt.Sprintf("199 rsyslox %q", msg))
+	}
+	values, _ := valueCounts(column, counts)
+	respondJSON(w, http.StatusOK, values)
+}
+
+// allColumns returns the real and virtual columns followed by the parser fields.
+func (h *MetaHandler) allColumns() []string {
+	columns := make([]string, 0, len(h.db.AvailableColumns))
+	columns = append(columns, h.db.AvailableColumns...)
+	return append(columns, h.db.FieldColumns()...)
+}
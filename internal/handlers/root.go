@@ -27,9 +27,11 @@ func (h *RootHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Name:    "rsyslox",
 		Version: h.version,
 		Endpoints: map[string]string{
-			"health": "/health",
-			"logs":   "/api/logs",
-			"meta":   "/api/meta",
+			"health":    "/health",
+			"logs":      "/api/logs",
+			"meta":      "/api/meta",
+			"anomalies": "/api/anomalies",
+			"stats":     "/api/stats/",
 		},
 	})
 }
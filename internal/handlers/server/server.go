@@ -39,7 +39,7 @@ var (
 // Server represents the HTTP server.
 type Server struct {
 	cfg          *config.Config
-	db           *database.DB
+	sources      *database.Sources
 	router       *http.ServeMux
 	version      string
 	setupMode    bool
@@ -49,10 +49,10 @@ type Server struct {
 
 // New creates a new Server instance.
 // setupMode=true means no config file was found; only the setup wizard is enabled.
-func New(cfg *config.Config, db *database.DB, version string, setupMode bool) *Server {
+func New(cfg *config.Config, sources *database.Sources, version string, setupMode bool) *Server {
 	return &Server{
 		cfg:          cfg,
-		db:           db,
+		sources:      sources,
 		router:       http.NewServeMux(),
 		version:      version,
 		setupMode:    setupMode,
@@ -79,7 +79,7 @@ func (s *Server) SetupRoutes() {
 	s.router.Handle("/docs/", cors(logging(docsHandler)))
 
 	// --- Health (public) ---
-	healthHandler := handlers.NewHealthHandler(s.db, s.version)
+	healthHandler := handlers.NewHealthHandler(s.sources, s.version)
 	s.router.Handle("/health", cors(logging(healthHandler)))
 
 	// --- Setup wizard (localhost only, only in setup mode) ---
@@ -108,8 +108,8 @@ func (s *Server) SetupRoutes() {
 	s.router.Handle("/api/admin/ssl/",   cors(logging(authAdmin(sslHandler))))
 
 	// --- API: logs and meta (read-only key or admin token) ---
-	logsHandler := handlers.NewLogsHandler(s.db)
-	metaHandler := handlers.NewMetaHandler(s.db)
+	logsHandler := handlers.NewLogsHandler(s.sources)
+	metaHandler := handlers.NewMetaHandler(s.sources, nil)
 	s.router.Handle("/api/logs", cors(logging(authRO(logsHandler))))
 	s.router.Handle("/api/meta", cors(logging(authRO(metaHandler))))
 	s.router.Handle("/api/meta/", cors(logging(authRO(metaHandler))))
@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/database"
+	"github.com/phil-bot/rsyslox/internal/filters"
+	"github.com/phil-bot/rsyslox/internal/models"
+	"github.com/phil-bot/rsyslox/internal/rollup"
+)
+
+// Values of the "source" field of statistics responses.
+const (
+	sourceRollup = "rollup"
+	sourceLive   = "live"
+)
+
+const (
+	maxHistogramBuckets = 10000
+	defaultTopLimit     = 10
+	maxTopLimit         = 1000
+)
+
+// countColumns are the columns statistics can count by: the rollup dimensions.
+var countColumns = []string{"FromHost", "ProgramName", "Facility", "Severity"}
+
+// rollupParams are the query parameters the rollups can answer. Any other
+// filter parameter forces a live query.
+var rollupParams = map[string]bool{
+	"start_date": true, "end_date": true, "interval": true, "column": true,
+	"limit": true, "source": true, "counts": true,
+	"FromHost": true, "ProgramName": true, "Facility": true, "Severity": true, "Priority": true,
+}
+
+// StatsHandler handles the statistics endpoints:
+//
+//	GET /api/stats/histogram → entries per minute, hour or day
+//	GET /api/stats/top       → the most frequent values of a column
+//
+// Both are answered from the rollup tables when the range is aligned to a
+// rollup granularity, and by a live query otherwise.
+type StatsHandler struct {
+	sources *database.Sources
+	db      *database.DB // primary source: dialect for live filters
+	rollups *rollup.Worker
+}
+
+// NewStatsHandler creates a new StatsHandler. rollups may be nil.
+func NewStatsHandler(sources *database.Sources, rollups *rollup.Worker) *StatsHandler {
+	return &StatsHandler{sources: sources, db: sources.Primary(), rollups: rollups}
+}
+
+func (h *StatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed,
+			models.NewAPIError("METHOD_NOT_ALLOWED", "Only GET method is allowed"))
+		return
+	}
+
+	filter, apiErr := parseStatsFilter(r.URL.Query())
+	if apiErr != nil {
+		respondError(w, http.StatusBadRequest, apiErr)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/api/stats/histogram":
+		h.histogram(w, r, filter)
+	case "/api/stats/top":
+		h.top(w, r, filter)
+	default:
+		respondError(w, http.StatusNotFound,
+			models.NewAPIError(models.ErrCodeNotFound, "Unknown stats endpoint"))
+	}
+}
+
+// statsFilter is the filter of a statistics request: a time range and the
+// rollup dimensions.
+type statsFilter struct {
+	start, end time.Time
+	dims       database.RollupFilter
+	live       bool // source=live: skip the rollups
+}
+
+func parseStatsFilter(query url.Values) (statsFilter, *models.APIError) {
+	var f statsFilter
+
+	start, end, err := filters.ValidateDateRange(query.Get("start_date"), query.Get("end_date"))
+	if err != nil {
+		return f, asAPIError(err)
+	}
+	f.start, f.end = start, end
+
+	severityParams := query["Severity"]
+	if len(severityParams) == 0 {
+		severityParams = query["Priority"]
+	}
+	if f.dims.Severities, err = filters.ValidateSeverities(severityParams); err != nil {
+		return f, asAPIError(err)
+	}
+	if f.dims.Facilities, err = filters.ValidateFacilities(query["Facility"]); err != nil {
+		return f, asAPIError(err)
+	}
+	f.dims.Hosts = query["FromHost"]
+	f.dims.Tags = query["ProgramName"]
+
+	switch query.Get("source") {
+	case "", "auto":
+	case sourceLive:
+		f.live = true
+	default:
+		return f, models.NewValidationError("source", "Must be 'auto' or 'live'")
+	}
+	return f, nil
+}
+
+// where returns the live WHERE clause of the filter over [start, end).
+func (f statsFilter) where(db *database.DB) (string, []interface{}) {
+	builder := filters.NewFor(db.Dialect)
+	builder.AddStringMultiValue("FromHost", f.dims.Hosts)
+	builder.AddStringMultiValue(db.ColumnExpr("ProgramName"), f.dims.Tags)
+	builder.AddIntMultiValue("Facility", f.dims.Facilities)
+	builder.AddSeverityFilter(f.dims.Severities)
+	whereClause, args := builder.Build()
+	return "ReceivedAt >= ? AND ReceivedAt < ? AND " + whereClause,
+		append([]interface{}{f.start, f.end}, args...)
+}
+
+// histogram returns the entries per bucket, including empty buckets.
+// interval is minute, hour (default) or day; days are those of the server's
+// time zone and are summed from hour buckets. Histograms always cover whole
+// buckets, so the rollups can answer them.
+func (h *StatsHandler) histogram(w http.ResponseWriter, r *http.Request, f statsFilter) {
+	query := r.URL.Query()
+	interval := query.Get("interval")
+	if interval == "" {
+		interval = "hour"
+	}
+	granularity := database.RollupHour
+	bucket := func(t time.Time) int64 { return rollup.Bucket(t, granularity) }
+	next := func(t time.Time) time.Time { return t.Add(time.Duration(granularity) * time.Second) }
+	switch interval {
+	case "minute":
+		granularity = database.RollupMinute
+	case "hour":
+	case "day":
+		bucket = func(t time.Time) int64 {
+			t = t.Local()
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local).Unix()
+		}
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	default:
+		respondError(w, http.StatusBadRequest,
+			models.NewValidationError("interval", "Must be 'minute', 'hour' or 'day'"))
+		return
+	}
+
+	// The range is widened to whole buckets.
+	var starts []time.Time
+	t := time.Unix(bucket(f.start), 0)
+	for ; t.Before(f.end); t = next(t) {
+		if len(starts) == maxHistogramBuckets {
+			respondError(w, http.StatusBadRequest,
+				models.NewValidationError("interval", "Too many buckets for the date range").
+					WithDetails("Use a larger interval or a shorter range"))
+			return
+		}
+		starts = append(starts, t)
+	}
+	if len(starts) > 0 {
+		f.start, f.end = starts[0], t
+	}
+
+	var (
+		counts   map[int64]int64
+		source   = sourceLive
+		warnings []string
+		err      error
+	)
+	if h.useRollups(query, f) {
+		var sums map[string]int64
+		sums, err = h.rollups.Counts(rollup.Query{
+			Granularity: granularity, Start: f.start, End: f.end, Filter: f.dims, GroupBy: "bucket",
+		})
+		if err == nil {
+			source = sourceRollup
+			counts = make(map[int64]int64, len(sums))
+			for key, c := range sums {
+				b, _ := strconv.ParseInt(key, 10, 64)
+				counts[bucket(time.Unix(b, 0))] += c
+			}
+		} else if !errors.Is(err, rollup.ErrUnavailable) {
+			log.Printf("Stats: rollup query failed, using live query: %v", err)
+		}
+	}
+	if counts == nil {
+		whereClause, args := f.where(h.db)
+		counts, warnings, err = h.sources.TimeCounts(r.Context(), whereClause, args, groupUnit(interval, f), bucket)
+		if err != nil {
+			log.Printf("Stats histogram error: %v", err)
+			respondQueryError(w, err, "Failed to query histogram")
+			return
+		}
+	}
+
+	resp := models.HistogramResponse{
+		Source:   source,
+		Interval: interval,
+		Buckets:  make([]models.HistogramBucket, 0, len(starts)),
+		Warnings: warnings,
+	}
+	for _, t := range starts {
+		c := counts[t.Unix()]
+		resp.Total += c
+		resp.Buckets = append(resp.Buckets, models.HistogramBucket{Time: t, Count: c})
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// groupUnit is the unit the database groups a histogram by. Hours and
+// days are grouped by the hour, day or minute of the server's time zone;
+// with an offset that is not a whole hour the hour buckets, which start
+// at whole UTC hours, fall inside its hours, so minutes are used.
+func groupUnit(interval string, f statsFilter) string {
+	for _, t := range []time.Time{f.start, f.end} {
+		if _, offset := t.Local().Zone(); offset%3600 != 0 {
+			return "minute"
+		}
+	}
+	return interval
+}
+
+// top returns the most frequent values of a column, most frequent first.
+func (h *StatsHandler) top(w http.ResponseWriter, r *http.Request, f statsFilter) {
+	query := r.URL.Query()
+	column := query.Get("column")
+	if !isCountColumn(column) {
+		respondError(w, http.StatusBadRequest,
+			models.NewValidationError("column", "Must be one of FromHost, ProgramName, Facility, Severity"))
+		return
+	}
+	limit := defaultTopLimit
+	if s := query.Get("limit"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 1 || v > maxTopLimit {
+			respondError(w, http.StatusBadRequest,
+				models.NewValidationError("limit", "Must be between 1 and "+strconv.Itoa(maxTopLimit)))
+			return
+		}
+		limit = v
+	}
+
+	whereClause, args := f.where(h.db)
+	counts, source, warnings, err := countValues(r.Context(), h.sources, h.rollups, column,
+		rollupQuery(f.start, f.end, f.dims, column), h.useRollups(query, f), whereClause, args)
+	if err != nil {
+		log.Printf("Stats top error: %v", err)
+		respondQueryError(w, err, "Failed to query statistics")
+		return
+	}
+
+	values, total := valueCounts(column, counts)
+	if len(values) > limit {
+		values = values[:limit]
+	}
+	respondJSON(w, http.StatusOK, models.TopResponse{
+		Source:   source,
+		Column:   column,
+		Total:    total,
+		Values:   values,
+		Warnings: warnings,
+	})
+}
+
+// useRollups reports whether the request may be answered from the rollups.
+// They cover the primary source only.
+func (h *StatsHandler) useRollups(query url.Values, f statsFilter) bool {
+	return !f.live && !h.sources.Multi() && onlyRollupParams(query)
+}
+
+// onlyRollupParams reports whether all parameters are answerable from the
+// rollups.
+func onlyRollupParams(query url.Values) bool {
+	for key := range query {
+		if !rollupParams[key] {
+			return false
+		}
+	}
+	return true
+}
+
+// rollupQuery returns the query counting by column over [start, end), at
+// hour granularity when the range is aligned to hours.
+func rollupQuery(start, end time.Time, dims database.RollupFilter, column string) rollup.Query {
+	granularity := database.RollupMinute
+	if start.Unix()%database.RollupHour == 0 && end.Unix()%database.RollupHour == 0 {
+		granularity = database.RollupHour
+	}
+	return rollup.Query{Granularity: granularity, Start: start, End: end, Filter: dims, GroupBy: column}
+}
+
+// countValues returns the entries per value of column, from the rollups
+// when useRollups is set and they cover q, and by a live query with the
+// WHERE clause otherwise.
+func countValues(ctx context.Context, sources *database.Sources, rollups *rollup.Worker, column string, q rollup.Query,
+	useRollups bool, whereClause string, args []interface{}) (map[string]int64, string, []string, error) {
+	if useRollups {
+		counts, err := rollups.Counts(q)
+		if err == nil {
+			return counts, sourceRollup, nil, nil
+		}
+		if !errors.Is(err, rollup.ErrUnavailable) {
+			log.Printf("Stats: rollup query failed, using live query: %v", err)
+		}
+	}
+	counts, warnings, err := sources.CountsWhere(ctx, column, whereClause, args)
+	return counts, sourceLive, warnings, err
+}
+
+// valueCounts converts counts by value into a list sorted by count, and
+// returns the total over all values. Empty hosts and tags and NULL
+// facilities and severities are counted in the total, but not listed.
+func valueCounts(column string, counts map[string]int64) ([]models.ValueCount, int64) {
+	values := make([]models.ValueCount, 0, len(counts))
+	var total int64
+	for key, c := range counts {
+		total += c
+		v := models.ValueCount{Value: key, Count: c}
+		switch column {
+		case "Facility", "Severity":
+			n, err := strconv.Atoi(key)
+			if err != nil || n < 0 {
+				continue
+			}
+			v.Value = n
+			if column == "Facility" {
+				v.Label = models.GetFacilityLabel(n)
+			} else {
+				v.Label = models.GetSeverityLabel(n)
+			}
+		default:
+			if key == "" {
+				continue
+			}
+		}
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Count != values[j].Count {
+			return values[i].Count > values[j].Count
+		}
+		if a, ok := values[i].Value.(int); ok {
+			return a < values[j].Value.(int)
+		}
+		return values[i].Value.(string) < values[j].Value.(string)
+	})
+	return values, total
+}
+
+func isCountColumn(column string) bool {
+	for _, c := range countColumns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+// asAPIError returns err as *models.APIError.
+func asAPIError(err error) *models.APIError {
+	if apiErr, ok := err.(*models.APIError); ok {
+		return apiErr
+	}
+	return models.NewAPIError(models.ErrCodeInvalidParameter, err.Error())
+}
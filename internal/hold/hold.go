@@ -0,0 +1,261 @@
+// Package hold stores legal holds: rows matching an active hold are exempt
+// from every deletion by cleanup and the partition manager.
+//
+// Holds are kept in a JSON file that is replaced atomically on every change,
+// so they survive restarts.
+package hold
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned for an unknown hold ID.
+var ErrNotFound = errors.New("hold not found")
+
+// Hold exempts the matching rows from deletion until it expires or is
+// released. Values within a list are ORed, criteria are ANDed; at least one
+// criterion is required.
+type Hold struct {
+	ID         string     `json:"id"`
+	Reason     string     `json:"reason"`
+	Hosts      []string   `json:"hosts,omitempty"` // FromHost, "*" matches any characters
+	Facilities []int      `json:"facilities,omitempty"`
+	From       *time.Time `json:"from,omitempty"` // ReceivedAt range, either end may be open
+	To         *time.Time `json:"to,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // nil = until released
+}
+
+// Active reports whether the hold is in force at now.
+func (h Hold) Active(now time.Time) bool {
+	return h.ExpiresAt == nil || now.Before(*h.ExpiresAt)
+}
+
+// Validate checks a new hold.
+func (h Hold) Validate() error {
+	if strings.TrimSpace(h.Reason) == "" {
+		return errors.New("reason is required")
+	}
+	if len(h.Hosts) == 0 && len(h.Facilities) == 0 && h.From == nil && h.To == nil {
+		return errors.New("at least one of hosts, facilities, from or to is required")
+	}
+	for _, host := range h.Hosts {
+		if strings.TrimSpace(host) == "" {
+			return errors.New("hosts must not contain empty entries")
+		}
+	}
+	for _, f := range h.Facilities {
+		if f < 0 || f > 23 {
+			return fmt.Errorf("facility %d is out of range 0-23", f)
+		}
+	}
+	if h.From != nil && h.To != nil && h.To.Before(*h.From) {
+		return errors.New("to must not be before from")
+	}
+	return nil
+}
+
+// Store holds the legal holds in memory and in a JSON file.
+type Store struct {
+	path string
+
+	mu    sync.Mutex // guards holds and the file
+	holds []Hold
+}
+
+// Open loads the holds from path; a missing file means no holds.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, holds: []Hold{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read holds: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.holds); err != nil {
+		return nil, fmt.Errorf("failed to parse holds %s: %w", path, err)
+	}
+	for _, h := range s.holds {
+		if err := h.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid hold %s in %s: %w", h.ID, path, err)
+		}
+	}
+	return s, nil
+}
+
+// List returns all holds, oldest first, including expired ones.
+func (s *Store) List() []Hold {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Hold{}, s.holds...)
+}
+
+// Active returns the holds in force at now.
+func (s *Store) Active(now time.Time) []Hold {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var active []Hold
+	for _, h := range s.holds {
+		if h.Active(now) {
+			active = append(active, h)
+		}
+	}
+	return active
+}
+
+// Add validates and stores a new hold, assigning its ID and creation time.
+func (s *Store) Add(h Hold) (Hold, error) {
+	if err := h.Validate(); err != nil {
+		return h, err
+	}
+	id, err := newID()
+	if err != nil {
+		return h, err
+	}
+	h.ID = id
+	h.CreatedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	holds := append(append([]Hold{}, s.holds...), h)
+	if err := s.save(holds); err != nil {
+		return h, err
+	}
+	s.holds = holds
+	return h, nil
+}
+
+// Release removes a hold.
+func (s *Store) Release(id string) (Hold, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, h := range s.holds {
+		if h.ID != id {
+			continue
+		}
+		holds := append(append([]Hold{}, s.holds[:i]...), s.holds[i+1:]...)
+		if err := s.save(holds); err != nil {
+			return h, err
+		}
+		s.holds = holds
+		return h, nil
+	}
+	return Hold{}, ErrNotFound
+}
+
+// Condition returns a WHERE clause matching the rows under any hold active
+// at now, or "" when no hold is active. Written with "?" placeholders.
+func (s *Store) Condition(now time.Time) (string, []interface{}) {
+	if s == nil {
+		return "", nil
+	}
+	active := s.Active(now)
+	if len(active) == 0 {
+		return "", nil
+	}
+	var (
+		alternatives []string
+		args         []interface{}
+	)
+	for _, h := range active {
+		cond, a := Match(h)
+		alternatives = append(alternatives, "("+cond+")")
+		args = append(args, a...)
+	}
+	return strings.Join(alternatives, " OR "), args
+}
+
+// Match returns the condition matching the rows of one hold.
+func Match(h Hold) (string, []interface{}) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	if len(h.Hosts) > 0 {
+		likes := make([]string, len(h.Hosts))
+		for i, pattern := range h.Hosts {
+			likes[i] = "COALESCE(FromHost, '') LIKE ? ESCAPE '!'"
+			args = append(args, LikePattern(pattern))
+		}
+		conds = append(conds, "("+strings.Join(likes, " OR ")+")")
+	}
+	if len(h.Facilities) > 0 {
+		conds = append(conds, "COALESCE(Facility, -1) IN ("+strings.TrimSuffix(strings.Repeat("?,", len(h.Facilities)), ",")+")")
+		for _, f := range h.Facilities {
+			args = append(args, f)
+		}
+	}
+	if h.From != nil {
+		conds = append(conds, "ReceivedAt >= ?")
+		args = append(args, *h.From)
+	}
+	if h.To != nil {
+		conds = append(conds, "ReceivedAt <= ?")
+		args = append(args, *h.To)
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// likeEscaper escapes LIKE wildcards with "!", which needs no quoting in
+// any supported dialect.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// LikePattern turns a host pattern with "*" wildcards into a pattern for
+// LIKE ? ESCAPE '!'. Cleanup's retention rules use it as well.
+func LikePattern(pattern string) string {
+	return strings.ReplaceAll(likeEscaper.Replace(pattern), "*", "%")
+}
+
+// save writes holds to the file.
+func (s *Store) save(holds []Hold) error {
+	data, err := json.MarshalIndent(holds, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to save holds: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path via a synced temporary file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func newID() (string, error) {
+	raw := make([]byte, 6)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
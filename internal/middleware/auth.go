@@ -1,26 +1,35 @@
 package middleware
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
 	"strings"
 
 	"github.com/phil-bot/rsyslox/internal/auth"
+	"github.com/phil-bot/rsyslox/internal/config"
 	"github.com/phil-bot/rsyslox/internal/models"
 )
 
 // contextKey is an unexported type for context keys in this package.
 type contextKey string
 
-const roleKey contextKey = "auth_role"
+const (
+	roleKey     contextKey = "auth_role"
+	writeKeyKey contextKey = "write_key"
+	callerKey   contextKey = "caller"
+)
+
+// callerAdmin is the caller name of admin sessions.
+const callerAdmin = "admin"
 
 // AuthReadOnly returns a middleware that accepts both admin session tokens
 // and read-only API keys. It rejects unauthenticated requests.
 func AuthReadOnly(mgr *auth.Manager, store *auth.SessionStore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			role := resolveRole(r, mgr, store)
+			role, caller := resolveRole(r, mgr, store)
 			if role == auth.RoleNone {
 				respondError(w, http.StatusUnauthorized, models.NewAPIError(
 					models.ErrCodeUnauthorized,
@@ -28,7 +37,7 @@ func AuthReadOnly(mgr *auth.Manager, store *auth.SessionStore) func(http.Handler
 					WithDetails("Provide X-API-Key header or X-Session-Token header"))
 				return
 			}
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerKey, caller)))
 		})
 	}
 }
@@ -46,11 +55,43 @@ func AuthAdmin(store *auth.SessionStore) func(http.Handler) http.Handler {
 					WithDetails("Provide a valid X-Session-Token header"))
 				return
 			}
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerKey, callerAdmin)))
+		})
+	}
+}
+
+// AuthWrite returns a middleware that only accepts write keys (X-API-Key).
+// Read-only keys and admin tokens are rejected; the matching key is
+// available to the handler through WriteKey.
+func AuthWrite(mgr *auth.Manager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := mgr.VerifyWriteKey(r.Header.Get("X-API-Key"))
+			if !ok {
+				respondError(w, http.StatusUnauthorized, models.NewAPIError(
+					models.ErrCodeUnauthorized,
+					"Write key required").
+					WithDetails("Provide an X-API-Key header with a write key"))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), writeKeyKey, key)))
 		})
 	}
 }
 
+// WriteKey returns the write key authenticated by AuthWrite.
+func WriteKey(r *http.Request) (config.WriteKey, bool) {
+	key, ok := r.Context().Value(writeKeyKey).(config.WriteKey)
+	return key, ok
+}
+
+// Caller returns the name of the read-only key authenticated by
+// AuthReadOnly, or "admin" for an admin session.
+func Caller(r *http.Request) string {
+	caller, _ := r.Context().Value(callerKey).(string)
+	return caller
+}
+
 // LocalhostOnly returns a middleware that restricts access to localhost.
 // Used to protect /api/setup in normal (post-config) mode.
 // In setup mode (no config yet) the server registers /api/setup without
@@ -69,16 +110,18 @@ func LocalhostOnly() func(http.Handler) http.Handler {
 	}
 }
 
-// resolveRole determines the auth.Role for a request.
-func resolveRole(r *http.Request, mgr *auth.Manager, store *auth.SessionStore) auth.Role {
+// resolveRole determines the auth.Role for a request, and the name of the
+// caller: the read-only key name or "admin".
+func resolveRole(r *http.Request, mgr *auth.Manager, store *auth.SessionStore) (auth.Role, string) {
 	if token := extractToken(r); token != "" && store.Validate(token) {
-		return auth.RoleAdmin
+		return auth.RoleAdmin, callerAdmin
 	}
-	apiKey := r.Header.Get("X-API-Key")
-	if apiKey != "" && mgr.VerifyReadOnlyKey(apiKey) != "" {
-		return auth.RoleReadOnly
+	if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+		if name := mgr.VerifyReadOnlyKey(apiKey); name != "" {
+			return auth.RoleReadOnly, name
+		}
 	}
-	return auth.RoleNone
+	return auth.RoleNone, ""
 }
 
 // extractToken extracts the session token from the request headers.
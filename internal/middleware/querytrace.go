@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/querylog"
+)
+
+// QueryTrace returns a middleware that attributes the database calls of a
+// request to its endpoint, API key and parameters, and records the request
+// latency in rec. It must run inside AuthReadOnly or AuthAdmin so that the
+// caller is known.
+func QueryTrace(rec *querylog.Recorder) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t := &querylog.Trace{
+				Endpoint: traceEndpoint(r.URL.Path),
+				Key:      Caller(r),
+				Params:   r.URL.RawQuery,
+			}
+			start := time.Now()
+			next.ServeHTTP(w, r.WithContext(querylog.NewContext(r.Context(), t)))
+			rec.Request(t, time.Since(start))
+		})
+	}
+}
+
+// traceEndpoint names the endpoint of path, folding the column of
+// /api/meta/{column} so that the statistics are not split per column.
+func traceEndpoint(path string) string {
+	if strings.HasPrefix(path, "/api/meta/") && len(path) > len("/api/meta/") {
+		return "/api/meta/{column}"
+	}
+	return path
+}
@@ -2,6 +2,8 @@ package models
 
 import (
 	"database/sql"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -39,9 +41,19 @@ type LogEntry struct {
 	MaxUsage           *int       `json:"MaxUsage"`
 	InfoUnitID         *int       `json:"InfoUnitID"`
 	SysLogTag          *string    `json:"SysLogTag"`
+	ProgramName        string     `json:"ProgramName"` // derived from SysLogTag
+	ProcessID          *int       `json:"ProcessID"`   // derived from SysLogTag
 	EventLogType       *string    `json:"EventLogType"`
 	GenericFileName    *string    `json:"GenericFileName"`
 	SystemID           *int       `json:"SystemID"`
+
+	// Source is the name of the [[databases]] entry the row was read from.
+	// Empty when a single [database] is configured.
+	Source string `json:"source,omitempty"`
+
+	// Fields holds structured data extracted from Message (RFC 5424 SD,
+	// JSON or key=value). Omitted when the message has none.
+	Fields map[string]any `json:"Fields,omitempty"`
 }
 
 // ScanFromRows scans a database row into a LogEntry.
@@ -82,5 +94,31 @@ func (e *LogEntry) ScanFromRows(rows *sql.Rows) error {
 		e.FacilityLabel = FacilityLabels[e.Facility]
 	}
 
+	if e.SysLogTag != nil {
+		e.ProgramName, e.ProcessID = ParseSysLogTag(*e.SysLogTag)
+	}
+
 	return nil
 }
+
+// ParseSysLogTag splits a raw syslog tag into program name and PID.
+//
+//	"sshd[1234]:" → ("sshd", 1234)
+//	"kernel:"     → ("kernel", nil)
+//	"CRON[99]:"   → ("CRON", 99)
+//
+// The result matches the ProgramName / ProcessID virtual columns computed in SQL.
+func ParseSysLogTag(tag string) (string, *int) {
+	program := tag
+	var pid *int
+	if i := strings.IndexByte(tag, '['); i >= 0 {
+		program = tag[:i]
+		rest := tag[strings.LastIndexByte(tag, '[')+1:]
+		if j := strings.IndexByte(rest, ']'); j >= 0 {
+			if v, err := strconv.Atoi(rest[:j]); err == nil {
+				pid = &v
+			}
+		}
+	}
+	return strings.TrimRight(program, ":"), pid
+}
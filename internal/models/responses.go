@@ -1,14 +1,29 @@
 package models
 
-import "time"
+import (
+	"time"
 
-// LogsResponse is the response for the /api/logs endpoint.
+	"github.com/phil-bot/rsyslox/internal/fields"
+)
+
+// LogsResponse is the response for the /api/logs endpoint. The handler
+// writes it field by field in this order while the rows are read.
 type LogsResponse struct {
-	Total   int        `json:"total"`    // entries matching the active filters
+	Total   *int       `json:"total"`    // entries matching the active filters; with field filters null unless all rows were read
 	DBTotal int        `json:"db_total"` // total entries in SystemEvents (no filter)
 	Offset  int        `json:"offset"`
 	Limit   int        `json:"limit"`
 	Rows    []LogEntry `json:"rows"`
+
+	// NextCursor continues after the last row; pass it back as ?cursor=.
+	// Empty when the page is not full.
+	NextCursor string `json:"next_cursor,omitempty"`
+	// Warnings lists the database sources that failed and rows that could
+	// not be read. The result is partial when present.
+	Warnings []string `json:"warnings,omitempty"`
+	// Error is set when reading the rows failed after the response was
+	// started; Rows holds the entries read until then.
+	Error string `json:"error,omitempty"`
 }
 
 // MetaValue represents a meta value with optional label (for Severity/Facility).
@@ -19,10 +34,44 @@ type MetaValue struct {
 
 // MetaResponse is the response for the GET /api/meta endpoint.
 type MetaResponse struct {
-	AvailableColumns []string   `json:"available_columns"`
-	Usage            string     `json:"usage"`
-	DBTotal          int        `json:"db_total"`
-	OldestEntry      *time.Time `json:"oldest_entry"`
+	AvailableColumns []string           `json:"available_columns"`
+	Fields           []fields.FieldInfo `json:"fields"` // parser fields, listed as field.<name> in AvailableColumns
+	Usage            string             `json:"usage"`
+	DBTotal          int                `json:"db_total"`
+	OldestEntry      *time.Time         `json:"oldest_entry"`
+	Warnings         []string           `json:"warnings,omitempty"` // failed database sources
+}
+
+// ValueCount is a column value with its number of entries, as returned by
+// GET /api/stats/top and GET /api/meta/{column}?counts=true.
+type ValueCount struct {
+	Value interface{} `json:"value"`           // string, or int for Facility and Severity
+	Label string      `json:"label,omitempty"` // Facility and Severity only
+	Count int64       `json:"count"`
+}
+
+// HistogramBucket is the number of entries received in one bucket.
+type HistogramBucket struct {
+	Time  time.Time `json:"time"` // bucket start
+	Count int64     `json:"count"`
+}
+
+// HistogramResponse is the response for GET /api/stats/histogram.
+type HistogramResponse struct {
+	Source   string            `json:"source"` // "rollup" or "live"
+	Interval string            `json:"interval"`
+	Total    int64             `json:"total"`
+	Buckets  []HistogramBucket `json:"buckets"`
+	Warnings []string          `json:"warnings,omitempty"` // failed database sources
+}
+
+// TopResponse is the response for GET /api/stats/top.
+type TopResponse struct {
+	Source   string       `json:"source"` // "rollup" or "live"
+	Column   string       `json:"column"`
+	Total    int64        `json:"total"` // entries in the range, over all values
+	Values   []ValueCount `json:"values"`
+	Warnings []string     `json:"warnings,omitempty"` // failed database sources
 }
 
 // HealthResponse is the response for the /health endpoint.
@@ -60,6 +109,8 @@ const (
 	ErrCodeInvalidDateRange = "INVALID_DATE_RANGE"
 	ErrCodeInvalidSeverity  = "INVALID_SEVERITY"
 	ErrCodeInvalidFacility  = "INVALID_FACILITY"
+	ErrCodeQuotaExceeded    = "QUOTA_EXCEEDED"
+	ErrCodeOverloaded       = "OVERLOADED"
 	ErrCodeInvalidPriority  = ErrCodeInvalidSeverity // backward compat
 )
 
@@ -0,0 +1,488 @@
+package partition
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// The migration copies SystemEvents into a partitioned shadow table while
+// triggers mirror every insert, update and delete, then swaps the tables
+// with one atomic RENAME. Rows are copied newest first in ID ranges; the
+// lower end of the last copied range is kept in a state table and is the
+// resume point after a restart. The shadow table itself cannot tell: the
+// triggers also copy old rows that are inserted again or updated.
+const (
+	shadowTable    = "SystemEvents_partitioned"
+	oldTable       = "SystemEvents_unpartitioned" // kept after the swap, dropped by the admin
+	stateTable     = "SystemEvents_partition_state"
+	triggerPrefix  = "rsyslox_partition_"
+	maxInitialDays = 1000 // older rows go to pold
+)
+
+// Migration errors.
+var (
+	ErrDisabled           = errors.New("the partition manager is disabled")
+	ErrConfirmRequired    = errors.New("the primary key of SystemEvents does not include ReceivedAt")
+	ErrAlreadyPartitioned = errors.New("SystemEvents is already partitioned")
+	ErrMigrationRunning   = errors.New("a migration is already running")
+)
+
+// MigrationStatus is the progress of a migration.
+type MigrationStatus struct {
+	Running    bool       `json:"running"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	TotalRows  int64      `json:"total_rows"` // estimate at start
+	CopiedRows int64      `json:"copied_rows"`
+	NextID     int64      `json:"next_id"` // rows below this ID remain to be copied
+	Error      string     `json:"error,omitempty"`
+}
+
+// Migrate converts SystemEvents to a partitioned table in the background.
+// MySQL requires the partitioning column in every unique key; when the
+// primary key lacks ReceivedAt it is extended to (…, ReceivedAt), which the
+// caller has to confirm. An interrupted migration resumes where it stopped.
+func (m *Manager) Migrate(confirmPrimaryKey bool) error {
+	if m == nil || !m.cfg.Enabled {
+		return ErrDisabled
+	}
+	return m.startMigration(confirmPrimaryKey)
+}
+
+func (m *Manager) startMigration(confirmPrimaryKey bool) error {
+	if !m.migrateMu.TryLock() {
+		return ErrMigrationRunning
+	}
+	pk, err := m.checkTable(confirmPrimaryKey)
+	if err != nil {
+		m.migrateMu.Unlock()
+		return err
+	}
+
+	m.mu.Lock()
+	m.migration = &MigrationStatus{Running: true, StartedAt: time.Now()}
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer m.migrateMu.Unlock()
+
+		err := m.migrate(pk)
+		now := time.Now()
+		m.mu.Lock()
+		m.migration.Running = false
+		if err != nil {
+			m.migration.Error = err.Error()
+		} else {
+			m.migration.FinishedAt = &now
+		}
+		m.mu.Unlock()
+
+		switch {
+		case errors.Is(err, errStopped):
+			log.Println("Partitions: migration interrupted, resumes on next start")
+		case err != nil:
+			log.Printf("❌ Partitions: migration failed: %v", err)
+		default:
+			log.Printf("✓ Partitions: SystemEvents is partitioned; the old table is kept as %s", oldTable)
+			m.maintain()
+		}
+	}()
+	return nil
+}
+
+var errStopped = errors.New("stopped")
+
+// checkTable verifies that SystemEvents can be partitioned and returns its
+// primary key columns.
+func (m *Manager) checkTable(confirmPrimaryKey bool) ([]string, error) {
+	parts, err := m.partitions()
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) > 0 {
+		return nil, ErrAlreadyPartitioned
+	}
+	if exists, err := m.tableExists(oldTable); err != nil {
+		return nil, err
+	} else if exists {
+		return nil, fmt.Errorf("%s exists from an earlier migration; drop it first", oldTable)
+	}
+
+	keys, err := m.uniqueKeys()
+	if err != nil {
+		return nil, err
+	}
+	pk := keys["PRIMARY"]
+	if len(pk) == 0 {
+		return nil, errors.New("SystemEvents has no primary key")
+	}
+	for name, cols := range keys {
+		if name != "PRIMARY" && !hasColumn(cols, "ReceivedAt") {
+			return nil, fmt.Errorf("unique key %s (%s) does not include ReceivedAt; MySQL cannot partition the table",
+				name, strings.Join(cols, ", "))
+		}
+	}
+	if !hasColumn(pk, "ReceivedAt") && !confirmPrimaryKey {
+		return nil, fmt.Errorf("%w: confirm changing it from (%s) to (%s, ReceivedAt)",
+			ErrConfirmRequired, strings.Join(pk, ", "), strings.Join(pk, ", "))
+	}
+	return pk, nil
+}
+
+func (m *Manager) migrate(pk []string) error {
+	columns, err := m.columns()
+	if err != nil {
+		return err
+	}
+	if err := m.prepareShadow(pk); err != nil {
+		return err
+	}
+	if err := m.createTriggers(pk, columns); err != nil {
+		return err
+	}
+	if err := m.copyRows(columns); err != nil {
+		return err
+	}
+	return m.swap()
+}
+
+// prepareShadow creates the partitioned shadow table, unless a previous run
+// got that far. A shadow table without partitions is incomplete; it has no
+// triggers yet and is recreated.
+func (m *Manager) prepareShadow(pk []string) error {
+	exists, err := m.tableExists(shadowTable)
+	if err != nil {
+		return err
+	}
+	if exists {
+		var n int
+		if err := m.db.QueryRow(`SELECT COUNT(*) FROM information_schema.PARTITIONS
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND PARTITION_NAME IS NOT NULL`,
+			shadowTable).Scan(&n); err != nil {
+			return fmt.Errorf("checking %s: %w", shadowTable, err)
+		}
+		if n > 0 {
+			return nil
+		}
+		if _, err := m.db.Exec("DROP TABLE " + shadowTable); err != nil {
+			return fmt.Errorf("dropping incomplete %s: %w", shadowTable, err)
+		}
+	}
+
+	first, err := m.firstDay()
+	if err != nil {
+		return err
+	}
+	today, err := m.today()
+	if err != nil {
+		return err
+	}
+
+	// A copy position left by an earlier shadow table does not apply.
+	if _, err := m.db.Exec("DROP TABLE IF EXISTS " + stateTable); err != nil {
+		return fmt.Errorf("dropping %s: %w", stateTable, err)
+	}
+	if _, err := m.db.Exec("CREATE TABLE " + shadowTable + " LIKE SystemEvents"); err != nil {
+		return fmt.Errorf("creating %s: %w", shadowTable, err)
+	}
+	// Partitioned InnoDB tables do not support FULLTEXT indexes.
+	fulltext, err := m.fulltextIndexes(shadowTable)
+	if err != nil {
+		return err
+	}
+	for _, name := range fulltext {
+		if _, err := m.db.Exec(fmt.Sprintf("ALTER TABLE %s DROP INDEX `%s`", shadowTable, name)); err != nil {
+			return fmt.Errorf("dropping FULLTEXT index %s: %w", name, err)
+		}
+	}
+	if !hasColumn(pk, "ReceivedAt") {
+		_, err := m.db.Exec(fmt.Sprintf("ALTER TABLE %s DROP PRIMARY KEY, ADD PRIMARY KEY (%s, ReceivedAt)",
+			shadowTable, quoteColumns(pk)))
+		if err != nil {
+			return fmt.Errorf("changing primary key of %s: %w", shadowTable, err)
+		}
+	}
+
+	defs := []string{fmt.Sprintf("PARTITION %s VALUES LESS THAN (TO_DAYS('%s'))", oldPartition, first.Format("2006-01-02"))}
+	for day := first; !day.After(today.AddDate(0, 0, m.cfg.FutureDays)); day = day.AddDate(0, 0, 1) {
+		defs = append(defs, dayPartition(day))
+	}
+	defs = append(defs, "PARTITION "+futurePartition+" VALUES LESS THAN MAXVALUE")
+	_, err = m.db.Exec(fmt.Sprintf("ALTER TABLE %s PARTITION BY RANGE (TO_DAYS(ReceivedAt)) (%s)",
+		shadowTable, strings.Join(defs, ", ")))
+	if err != nil {
+		return fmt.Errorf("partitioning %s: %w", shadowTable, err)
+	}
+	log.Printf("✓ Partitions: created %s with %d partitions from %s", shadowTable, len(defs), first.Format("2006-01-02"))
+	return nil
+}
+
+// firstDay returns the day of the first daily partition: the oldest row,
+// but no earlier than the retention period or maxInitialDays allow.
+func (m *Manager) firstDay() (time.Time, error) {
+	today, err := m.today()
+	if err != nil {
+		return time.Time{}, err
+	}
+	first := today.AddDate(0, 0, -maxInitialDays)
+	if m.cfg.RetentionDays > 0 && m.cfg.RetentionDays < maxInitialDays {
+		first = today.AddDate(0, 0, -m.cfg.RetentionDays)
+	}
+
+	var oldest sql.NullString
+	if err := m.db.QueryRow("SELECT DATE_FORMAT(MIN(ReceivedAt), '%Y-%m-%d') FROM SystemEvents").Scan(&oldest); err != nil {
+		return time.Time{}, fmt.Errorf("reading oldest entry: %w", err)
+	}
+	if !oldest.Valid {
+		return today, nil
+	}
+	day, err := time.Parse("2006-01-02", oldest.String)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if day.After(today) {
+		return today, nil
+	}
+	if day.After(first) {
+		return day, nil
+	}
+	return first, nil
+}
+
+// createTriggers mirrors changes of SystemEvents into the shadow table.
+// Existing triggers of an interrupted run are kept.
+func (m *Manager) createTriggers(pk, columns []string) error {
+	values := func(prefix string) string {
+		v := make([]string, len(columns))
+		for i, c := range columns {
+			v[i] = copyExpr(prefix, c)
+		}
+		return strings.Join(v, ", ")
+	}
+	match := make([]string, len(pk))
+	for i, c := range pk {
+		match[i] = fmt.Sprintf("`%s` = OLD.`%s`", c, c)
+	}
+	where := strings.Join(match, " AND ")
+	replace := fmt.Sprintf("REPLACE INTO %s (%s) VALUES (%s)", shadowTable, quoteColumns(columns), values("NEW."))
+	remove := fmt.Sprintf("DELETE FROM %s WHERE %s", shadowTable, where)
+
+	triggers := []struct{ name, body string }{
+		{"ins", "AFTER INSERT ON SystemEvents FOR EACH ROW " + replace},
+		{"upd", "AFTER UPDATE ON SystemEvents FOR EACH ROW BEGIN " + remove + "; " + replace + "; END"},
+		{"del", "AFTER DELETE ON SystemEvents FOR EACH ROW " + remove},
+	}
+	for _, t := range triggers {
+		name := triggerPrefix + t.name
+		var n int
+		if err := m.db.QueryRow(`SELECT COUNT(*) FROM information_schema.TRIGGERS
+			WHERE TRIGGER_SCHEMA = DATABASE() AND TRIGGER_NAME = ?`, name).Scan(&n); err != nil {
+			return fmt.Errorf("checking trigger %s: %w", name, err)
+		}
+		if n > 0 {
+			continue
+		}
+		if _, err := m.db.Exec("CREATE TRIGGER " + name + " " + t.body); err != nil {
+			return fmt.Errorf("creating trigger %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// copyRows copies the rows below the copy position in ID ranges of
+// ChunkSize, newest first, and moves the position down after every range.
+// INSERT IGNORE skips rows the triggers wrote already.
+func (m *Manager) copyRows(columns []string) error {
+	upper, err := m.copyPosition()
+	if err != nil {
+		return err
+	}
+	var total int64
+	if err := m.db.QueryRow(`SELECT COALESCE(TABLE_ROWS, 0) FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'SystemEvents'`).Scan(&total); err != nil {
+		return fmt.Errorf("reading row count: %w", err)
+	}
+	m.mu.Lock()
+	m.migration.TotalRows = total
+	m.migration.NextID = upper
+	m.mu.Unlock()
+
+	exprs := make([]string, len(columns))
+	for i, c := range columns {
+		exprs[i] = copyExpr("", c)
+	}
+	insert := fmt.Sprintf("INSERT IGNORE INTO %s (%s) SELECT %s FROM SystemEvents WHERE ID >= ? AND ID < ?",
+		shadowTable, quoteColumns(columns), strings.Join(exprs, ", "))
+
+	next := upper
+	for next > 0 {
+		select {
+		case <-m.stopCh:
+			return errStopped
+		default:
+		}
+
+		var lower int64
+		err := m.db.QueryRow("SELECT ID FROM SystemEvents WHERE ID < ? ORDER BY ID DESC LIMIT 1 OFFSET ?",
+			next, m.cfg.ChunkSize-1).Scan(&lower)
+		if errors.Is(err, sql.ErrNoRows) {
+			lower = 0 // last chunk
+		} else if err != nil {
+			return fmt.Errorf("reading next chunk below ID %d: %w", next, err)
+		}
+
+		result, err := m.db.Exec(insert, lower, next)
+		if err != nil {
+			return fmt.Errorf("copying IDs %d to %d: %w", lower, next-1, err)
+		}
+		copied, _ := result.RowsAffected()
+		if _, err := m.db.Exec("UPDATE "+stateTable+" SET NextID = ?", lower); err != nil {
+			return fmt.Errorf("saving copy position: %w", err)
+		}
+
+		m.mu.Lock()
+		m.migration.CopiedRows += copied
+		m.migration.NextID = lower
+		m.mu.Unlock()
+		next = lower
+	}
+	return nil
+}
+
+// copyPosition returns the ID below which rows remain to be copied. A new
+// copy starts above the largest ID: newer rows reach the shadow table
+// through the triggers, which exist by then.
+func (m *Manager) copyPosition() (int64, error) {
+	if _, err := m.db.Exec("CREATE TABLE IF NOT EXISTS " + stateTable + " (NextID BIGINT NOT NULL)"); err != nil {
+		return 0, fmt.Errorf("creating %s: %w", stateTable, err)
+	}
+	var next int64
+	err := m.db.QueryRow("SELECT NextID FROM " + stateTable).Scan(&next)
+	if err == nil {
+		return next, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("reading copy position: %w", err)
+	}
+	if err := m.db.QueryRow("SELECT COALESCE(MAX(ID), 0) + 1 FROM SystemEvents").Scan(&next); err != nil {
+		return 0, fmt.Errorf("reading copy position: %w", err)
+	}
+	if _, err := m.db.Exec("INSERT INTO "+stateTable+" (NextID) VALUES (?)", next); err != nil {
+		return 0, fmt.Errorf("saving copy position: %w", err)
+	}
+	return next, nil
+}
+
+// swap replaces SystemEvents by the shadow table in one statement and
+// removes the triggers, which moved to the old table with the rename.
+func (m *Manager) swap() error {
+	_, err := m.db.Exec(fmt.Sprintf("RENAME TABLE SystemEvents TO %s, %s TO SystemEvents", oldTable, shadowTable))
+	if err != nil {
+		return fmt.Errorf("swapping tables: %w", err)
+	}
+	for _, t := range []string{"ins", "upd", "del"} {
+		if _, err := m.db.Exec("DROP TRIGGER IF EXISTS " + triggerPrefix + t); err != nil {
+			return fmt.Errorf("dropping trigger %s: %w", triggerPrefix+t, err)
+		}
+	}
+	if _, err := m.db.Exec("DROP TABLE IF EXISTS " + stateTable); err != nil {
+		return fmt.Errorf("dropping %s: %w", stateTable, err)
+	}
+	return nil
+}
+
+// uniqueKeys returns the columns of the unique keys of SystemEvents by name.
+func (m *Manager) uniqueKeys() (map[string][]string, error) {
+	rows, err := m.db.Query(`
+		SELECT INDEX_NAME, COLUMN_NAME FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'SystemEvents' AND NON_UNIQUE = 0
+		ORDER BY INDEX_NAME, SEQ_IN_INDEX`)
+	if err != nil {
+		return nil, fmt.Errorf("reading keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := make(map[string][]string)
+	for rows.Next() {
+		var index, column string
+		if err := rows.Scan(&index, &column); err != nil {
+			return nil, err
+		}
+		keys[index] = append(keys[index], column)
+	}
+	return keys, rows.Err()
+}
+
+func (m *Manager) fulltextIndexes(table string) ([]string, error) {
+	rows, err := m.db.Query(`
+		SELECT DISTINCT INDEX_NAME FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_TYPE = 'FULLTEXT'`, table)
+	if err != nil {
+		return nil, fmt.Errorf("reading indexes of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// columns returns the real columns of SystemEvents in table order.
+func (m *Manager) columns() ([]string, error) {
+	rows, err := m.db.Query(`
+		SELECT COLUMN_NAME FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'SystemEvents'
+		ORDER BY ORDINAL_POSITION`)
+	if err != nil {
+		return nil, fmt.Errorf("reading columns: %w", err)
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+// copyExpr returns the value copied into column c. ReceivedAt is part of
+// the new primary key and must not be NULL.
+func copyExpr(prefix, c string) string {
+	if strings.EqualFold(c, "ReceivedAt") {
+		return fmt.Sprintf("COALESCE(%s`%s`, NOW())", prefix, c)
+	}
+	return fmt.Sprintf("%s`%s`", prefix, c)
+}
+
+func quoteColumns(columns []string) string {
+	q := make([]string, len(columns))
+	for i, c := range columns {
+		q[i] = "`" + c + "`"
+	}
+	return strings.Join(q, ", ")
+}
+
+func hasColumn(columns []string, name string) bool {
+	for _, c := range columns {
+		if strings.EqualFold(c, name) {
+			return true
+		}
+	}
+	return false
+}
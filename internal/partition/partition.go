@@ -0,0 +1,444 @@
+// Package partition keeps SystemEvents partitioned by day on MySQL and
+// enforces retention by dropping whole partitions.
+//
+// The table is partitioned BY RANGE (TO_DAYS(ReceivedAt)):
+//
+//	pold      rows before the first daily partition
+//	p20260218 rows received on 2026-02-18
+//	…
+//	pfuture   VALUES LESS THAN MAXVALUE, split off as days are added
+//
+// An unpartitioned table is converted by Migrate (see migrate.go).
+package partition
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/database"
+)
+
+const (
+	oldPartition    = "pold"
+	futurePartition = "pfuture"
+	dayLayout       = "20060102" // partition name suffix
+)
+
+// States of SystemEvents.
+const (
+	StateUnpartitioned = "unpartitioned"
+	StateMigrating     = "migrating"
+	StatePartitioned   = "partitioned"
+)
+
+// ErrForeignLayout is returned when SystemEvents is partitioned, but not by
+// this package; such tables are left alone.
+var ErrForeignLayout = errors.New("SystemEvents is partitioned, but not by day on ReceivedAt")
+
+// Holds exempts rows under a legal hold from deletion: partitions holding
+// such rows are not dropped. *hold.Store implements it.
+type Holds interface {
+	Condition(now time.Time) (string, []interface{})
+}
+
+// Rollups keeps pre-aggregated counts that must not count dropped rows.
+// ForgetRange runs drop and removes the counts of the dropped days.
+// *rollup.Worker implements it.
+type Rollups interface {
+	ForgetRange(ranges []database.TimeRange, drop func() error) error
+}
+
+// Config holds the partition manager configuration.
+type Config struct {
+	Enabled       bool
+	RetentionDays int // drop partitions older than this, 0 = keep all
+	FutureDays    int // partitions created ahead of today
+	Interval      time.Duration
+	ChunkSize     int     // rows copied per statement during migration
+	Holds         Holds   // optional
+	Rollups       Rollups // optional
+}
+
+// Partition is one partition of SystemEvents. Rows and Bytes are the
+// estimates of information_schema.PARTITIONS.
+type Partition struct {
+	Name  string `json:"name"`
+	Day   string `json:"day,omitempty"` // YYYY-MM-DD; empty for pold and pfuture
+	Rows  int64  `json:"rows"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Status is the state of the partition manager, as returned by the admin API.
+type Status struct {
+	Enabled         bool             `json:"enabled"`
+	State           string           `json:"state"`
+	RetentionDays   int              `json:"retention_days"`
+	FutureDays      int              `json:"future_days"`
+	LastMaintenance *time.Time       `json:"last_maintenance,omitempty"`
+	Dropped         int              `json:"dropped"`        // partitions dropped since startup
+	Held            []string         `json:"held,omitempty"` // expired partitions kept for legal holds
+	Error           string           `json:"error,omitempty"`
+	Migration       *MigrationStatus `json:"migration,omitempty"`
+	Partitions      []Partition      `json:"partitions"`
+}
+
+// Manager creates partitions ahead of time and drops expired ones.
+type Manager struct {
+	db     *database.DB
+	cfg    Config
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+
+	migrateMu sync.Mutex // held while a migration runs
+
+	mu              sync.Mutex // guards the fields below
+	lastMaintenance time.Time
+	dropped         int
+	held            []string
+	lastErr         error
+	migration       *MigrationStatus
+}
+
+// New creates a new Manager.
+func New(db *database.DB, cfg Config) *Manager {
+	return &Manager{
+		db:     db,
+		cfg:    cfg,
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Start resumes an interrupted migration and starts the maintenance loop.
+func (m *Manager) Start() {
+	if !m.cfg.Enabled {
+		log.Println("⏭  Partition manager disabled")
+		return
+	}
+	log.Printf("✓ Partition manager started (retention: %d days, future: %d days, interval: %s)",
+		m.cfg.RetentionDays, m.cfg.FutureDays, m.cfg.Interval)
+
+	m.wg.Add(1)
+	go m.run()
+}
+
+// Stop stops the maintenance loop and a running migration, which resumes
+// on the next start.
+func (m *Manager) Stop() {
+	close(m.stopCh)
+	m.wg.Wait()
+}
+
+func (m *Manager) run() {
+	defer m.wg.Done()
+
+	if exists, err := m.tableExists(shadowTable); err != nil {
+		m.setError(err)
+	} else if exists {
+		log.Println("Partitions: resuming interrupted migration")
+		if err := m.startMigration(true); err != nil {
+			m.setError(err)
+		}
+	}
+
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+	m.maintain()
+	for {
+		select {
+		case <-ticker.C:
+			m.maintain()
+		case <-m.stopCh:
+			log.Println("Partition manager stopped")
+			return
+		}
+	}
+}
+
+// maintain adds the partitions up to FutureDays ahead and drops the ones
+// older than RetentionDays. Unpartitioned tables are skipped.
+func (m *Manager) maintain() {
+	parts, err := m.partitions()
+	if err == nil && len(parts) > 0 {
+		err = m.ensureLayout(parts)
+	}
+	if err == nil && len(parts) > 0 {
+		var today time.Time
+		if today, err = m.today(); err == nil {
+			if err = m.addFuture(parts, today); err == nil {
+				err = m.dropExpired(parts, today)
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("⚠️  Partitions: maintenance failed: %v", err)
+	}
+
+	m.mu.Lock()
+	m.lastMaintenance = time.Now()
+	m.lastErr = err
+	m.mu.Unlock()
+}
+
+// ensureLayout checks that the partitions were created by this package.
+func (m *Manager) ensureLayout(parts []Partition) error {
+	if parts[len(parts)-1].Name != futurePartition {
+		return ErrForeignLayout
+	}
+	for _, p := range parts[:len(parts)-1] {
+		if p.Name != oldPartition && p.Day == "" {
+			return ErrForeignLayout
+		}
+	}
+	return nil
+}
+
+// addFuture splits daily partitions up to today+FutureDays off pfuture.
+// pfuture is normally empty, so the reorganization is quick.
+func (m *Manager) addFuture(parts []Partition, today time.Time) error {
+	last := today.AddDate(0, 0, -1)
+	if day, ok := lastDay(parts); ok && day.After(last) {
+		last = day
+	}
+	end := today.AddDate(0, 0, m.cfg.FutureDays)
+	if !last.Before(end) {
+		return nil
+	}
+
+	var defs []string
+	for day := last.AddDate(0, 0, 1); !day.After(end); day = day.AddDate(0, 0, 1) {
+		defs = append(defs, dayPartition(day))
+	}
+	defs = append(defs, "PARTITION "+futurePartition+" VALUES LESS THAN MAXVALUE")
+	_, err := m.db.Exec(fmt.Sprintf("ALTER TABLE SystemEvents REORGANIZE PARTITION %s INTO (%s)",
+		futurePartition, strings.Join(defs, ", ")))
+	if err != nil {
+		return fmt.Errorf("adding partitions: %w", err)
+	}
+	log.Printf("✓ Partitions: added %d daily partitions up to %s", len(defs)-1, end.Format("2006-01-02"))
+	return nil
+}
+
+// dropExpired drops the partitions holding only days before
+// today-RetentionDays. pold goes once the first daily partition is expired.
+func (m *Manager) dropExpired(parts []Partition, today time.Time) error {
+	if m.cfg.RetentionDays <= 0 {
+		return nil
+	}
+	cutoff := today.AddDate(0, 0, -m.cfg.RetentionDays)
+
+	var names []string
+	days := make(map[string]database.TimeRange) // name → days it holds
+	for i, p := range parts {
+		switch {
+		case p.Name == oldPartition:
+			// pold holds everything before the next partition.
+			if i+1 < len(parts) && parts[i+1].Day != "" && !dayOf(parts[i+1]).After(cutoff) {
+				names = append(names, p.Name)
+				days[p.Name] = database.TimeRange{End: localDay(dayOf(parts[i+1]))}
+			}
+		case p.Day != "" && dayOf(p).Before(cutoff):
+			names = append(names, p.Name)
+			days[p.Name] = database.TimeRange{Start: localDay(dayOf(p)), End: localDay(dayOf(p).AddDate(0, 0, 1))}
+		}
+	}
+	names, held, err := m.withoutHeld(names)
+	m.mu.Lock()
+	m.held = held
+	m.mu.Unlock()
+	if err != nil || len(names) == 0 {
+		return err
+	}
+
+	drop := func() error {
+		_, err := m.db.Exec("ALTER TABLE SystemEvents DROP PARTITION " + strings.Join(names, ", "))
+		return err
+	}
+	if m.cfg.Rollups != nil {
+		ranges := make([]database.TimeRange, len(names))
+		for i, name := range names {
+			ranges[i] = days[name]
+		}
+		err = m.cfg.Rollups.ForgetRange(ranges, drop)
+	} else {
+		err = drop()
+	}
+	if err != nil {
+		return fmt.Errorf("dropping partitions: %w", err)
+	}
+	log.Printf("✓ Partitions: dropped %d partitions before %s (%s)",
+		len(names), cutoff.Format("2006-01-02"), strings.Join(names, ", "))
+
+	m.mu.Lock()
+	m.dropped += len(names)
+	m.mu.Unlock()
+	return nil
+}
+
+// withoutHeld splits the partitions to drop into those without rows under
+// an active legal hold and the held ones, which are kept.
+func (m *Manager) withoutHeld(names []string) (drop, held []string, err error) {
+	if m.cfg.Holds == nil {
+		return names, nil, nil
+	}
+	cond, args := m.cfg.Holds.Condition(time.Now())
+	if cond == "" {
+		return names, nil, nil
+	}
+	for _, name := range names {
+		var one int
+		err := m.db.QueryRow(fmt.Sprintf("SELECT 1 FROM SystemEvents PARTITION (%s) WHERE %s LIMIT 1",
+			name, cond), args...).Scan(&one)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			drop = append(drop, name)
+		case err != nil:
+			return nil, nil, fmt.Errorf("checking legal holds in %s: %w", name, err)
+		default:
+			held = append(held, name)
+		}
+	}
+	if len(held) > 0 {
+		log.Printf("Partitions: keeping %d expired partitions with rows under legal hold (%s)",
+			len(held), strings.Join(held, ", "))
+	}
+	return drop, held, nil
+}
+
+// partitions returns the partitions of SystemEvents in order, or none when
+// the table is not partitioned.
+func (m *Manager) partitions() ([]Partition, error) {
+	rows, err := m.db.Query(`
+		SELECT PARTITION_NAME, COALESCE(TABLE_ROWS, 0), COALESCE(DATA_LENGTH + INDEX_LENGTH, 0)
+		FROM information_schema.PARTITIONS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'SystemEvents' AND PARTITION_NAME IS NOT NULL
+		ORDER BY PARTITION_ORDINAL_POSITION`)
+	if err != nil {
+		return nil, fmt.Errorf("reading partitions: %w", err)
+	}
+	defer rows.Close()
+
+	parts := []Partition{}
+	for rows.Next() {
+		var p Partition
+		if err := rows.Scan(&p.Name, &p.Rows, &p.Bytes); err != nil {
+			return nil, err
+		}
+		if day, err := time.Parse(dayLayout, strings.TrimPrefix(p.Name, "p")); err == nil && strings.HasPrefix(p.Name, "p") {
+			p.Day = day.Format("2006-01-02")
+		}
+		parts = append(parts, p)
+	}
+	return parts, rows.Err()
+}
+
+// today returns the current date of the database server, which is the time
+// zone ReceivedAt is stored in.
+func (m *Manager) today() (time.Time, error) {
+	var s string
+	if err := m.db.QueryRow("SELECT DATE_FORMAT(CURDATE(), '%Y-%m-%d')").Scan(&s); err != nil {
+		return time.Time{}, fmt.Errorf("reading current date: %w", err)
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+func (m *Manager) tableExists(name string) (bool, error) {
+	var n int
+	err := m.db.QueryRow(`SELECT COUNT(*) FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?`, name).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("checking table %s: %w", name, err)
+	}
+	return n > 0, nil
+}
+
+func (m *Manager) setError(err error) {
+	log.Printf("⚠️  Partitions: %v", err)
+	m.mu.Lock()
+	m.lastErr = err
+	m.mu.Unlock()
+}
+
+// Status returns the state of SystemEvents, its partitions and the progress
+// of a migration. It is safe to call on a nil Manager.
+func (m *Manager) Status() Status {
+	if m == nil {
+		return Status{State: StateUnpartitioned, Partitions: []Partition{}}
+	}
+
+	s := Status{
+		Enabled:       m.cfg.Enabled,
+		State:         StateUnpartitioned,
+		RetentionDays: m.cfg.RetentionDays,
+		FutureDays:    m.cfg.FutureDays,
+		Partitions:    []Partition{},
+	}
+	if !m.cfg.Enabled {
+		return s
+	}
+	parts, err := m.partitions()
+	if err == nil && len(parts) > 0 {
+		s.State = StatePartitioned
+		s.Partitions = parts
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.lastMaintenance.IsZero() {
+		t := m.lastMaintenance
+		s.LastMaintenance = &t
+	}
+	s.Dropped = m.dropped
+	s.Held = m.held
+	if err == nil {
+		err = m.lastErr
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	if m.migration != nil {
+		mig := *m.migration
+		s.Migration = &mig
+		if mig.Running {
+			s.State = StateMigrating
+		}
+	}
+	return s
+}
+
+// dayPartition returns the definition of the partition holding day.
+func dayPartition(day time.Time) string {
+	return fmt.Sprintf("PARTITION p%s VALUES LESS THAN (TO_DAYS('%s'))",
+		day.Format(dayLayout), day.AddDate(0, 0, 1).Format("2006-01-02"))
+}
+
+func dayOf(p Partition) time.Time {
+	day, _ := time.Parse("2006-01-02", p.Day)
+	return day
+}
+
+// localDay returns the start of day in the server's time zone, where
+// ReceivedAt, and so TO_DAYS, counts days.
+func localDay(day time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// lastDay returns the day of the newest daily partition.
+func lastDay(parts []Partition) (time.Time, bool) {
+	var days []time.Time
+	for _, p := range parts {
+		if p.Day != "" {
+			days = append(days, dayOf(p))
+		}
+	}
+	if len(days) == 0 {
+		return time.Time{}, false
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days[len(days)-1], true
+}
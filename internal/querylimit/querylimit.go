@@ -0,0 +1,335 @@
+// Package querylimit bounds the database calls that API requests run at the
+// same time, so that a few expensive searches cannot take all pooled
+// connections. Calls draw weight from one of two budgets: cheap lookups
+// (metadata, single rows) and scans (log pages and counts over a time
+// window). Each API key may hold only part of a budget, and a call waits at
+// most MaxWait for its weight before it fails with an *OverloadedError.
+package querylimit
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Class is the kind of a database call; it selects the budget and weight.
+type Class int
+
+const (
+	Lookup Class = iota // metadata and single rows: weight 1 of the lookup budget
+	Scan                // a page of log entries: weight 1 of the scan budget
+	Count               // COUNT or GROUP BY over a time window: weight 2 of the scan budget
+)
+
+func (c Class) String() string {
+	switch c {
+	case Scan:
+		return "scan"
+	case Count:
+		return "count"
+	default:
+		return "lookup"
+	}
+}
+
+// Weight is the weight of one call of class c.
+func (c Class) Weight() int {
+	if c == Count {
+		return 2
+	}
+	return 1
+}
+
+type classKey struct{}
+
+// WithClass returns ctx for database calls of class c. Calls made with a
+// context without a class are lookups.
+func WithClass(ctx context.Context, c Class) context.Context {
+	return context.WithValue(ctx, classKey{}, c)
+}
+
+// ClassFrom returns the class set by WithClass, or Lookup.
+func ClassFrom(ctx context.Context) Class {
+	c, _ := ctx.Value(classKey{}).(Class)
+	return c
+}
+
+type reservedKey struct{}
+
+// WithReserved returns ctx for calls whose weight was acquired in advance
+// with AcquireN; they are not limited again.
+func WithReserved(ctx context.Context) context.Context {
+	return context.WithValue(ctx, reservedKey{}, true)
+}
+
+// Reserved reports whether ctx was returned by WithReserved.
+func Reserved(ctx context.Context) bool {
+	r, _ := ctx.Value(reservedKey{}).(bool)
+	return r
+}
+
+// ErrOverloaded is matched by errors.Is for every *OverloadedError.
+var ErrOverloaded = errors.New("too many concurrent database queries")
+
+// OverloadedError is returned by Acquire when a call waited MaxWait without
+// getting its weight.
+type OverloadedError struct {
+	Class      Class
+	Key        string
+	RetryAfter time.Duration // suggested delay before the request is repeated
+}
+
+func (e *OverloadedError) Error() string {
+	return fmt.Sprintf("%v (%s budget, key %q)", ErrOverloaded, e.budgetName(), e.Key)
+}
+
+func (e *OverloadedError) Is(target error) bool { return target == ErrOverloaded }
+
+func (e *OverloadedError) budgetName() string {
+	if e.Class == Lookup {
+		return "lookup"
+	}
+	return "scan"
+}
+
+// RetryAfterSeconds is RetryAfter rounded up to whole seconds, at least 1,
+// for the Retry-After header.
+func (e *OverloadedError) RetryAfterSeconds() int {
+	s := int(math.Ceil(e.RetryAfter.Seconds()))
+	if s < 1 {
+		s = 1
+	}
+	return s
+}
+
+// Config holds the budgets of a Limiter.
+type Config struct {
+	LookupSlots    int           // weight of concurrent lookups
+	ScanSlots      int           // weight of concurrent scans and counts
+	KeyLookupSlots int           // lookup weight one key may hold, 0 = LookupSlots
+	KeyScanSlots   int           // scan weight one key may hold, 0 = ScanSlots
+	MaxWait        time.Duration // how long a call waits for its weight
+}
+
+// Limiter is a weighted semaphore with a lookup and a scan budget. A nil
+// *Limiter does not limit.
+type Limiter struct {
+	maxWait time.Duration
+
+	mu      sync.Mutex
+	lookups budget
+	scans   budget
+}
+
+// budget is one weighted semaphore with a limit per key. Waiters are served
+// in order; one that only its key's limit holds back does not block the
+// waiters behind it.
+type budget struct {
+	size, keySize int
+	used          int
+	keys          map[string]int
+	waiters       list.List // of *waiter
+	rejected      int64
+}
+
+type waiter struct {
+	key   string
+	n     int
+	ready chan struct{}
+}
+
+// New creates a Limiter.
+func New(cfg Config) *Limiter {
+	l := &Limiter{maxWait: cfg.MaxWait}
+	l.lookups.init(cfg.LookupSlots, cfg.KeyLookupSlots)
+	l.scans.init(cfg.ScanSlots, cfg.KeyScanSlots)
+	return l
+}
+
+func (b *budget) init(size, keySize int) {
+	if size < 1 {
+		size = 1
+	}
+	if keySize < 1 || keySize > size {
+		keySize = size
+	}
+	b.size, b.keySize = size, keySize
+	b.keys = make(map[string]int)
+}
+
+func (l *Limiter) budget(c Class) *budget {
+	if c == Lookup {
+		return &l.lookups
+	}
+	return &l.scans
+}
+
+// Acquire waits until key may run a call of class c and returns the function
+// that gives the weight back. It fails with an *OverloadedError after
+// MaxWait, or with the error of ctx when ctx ends first.
+func (l *Limiter) Acquire(ctx context.Context, key string, c Class) (release func(), err error) {
+	p, err := l.AcquireN(ctx, key, c, c.Weight())
+	if err != nil {
+		return nil, err
+	}
+	return func() { p.Release(-1) }, nil
+}
+
+// AcquireN is Acquire for n units of the budget of class c at once, for
+// calls that run together: taking their weights one by one could leave
+// every request holding a part and waiting for the rest. n is capped at
+// the share of one key.
+func (l *Limiter) AcquireN(ctx context.Context, key string, c Class, n int) (*Permit, error) {
+	if l == nil {
+		return nil, nil
+	}
+	b := l.budget(c)
+	w := &waiter{key: key, n: n, ready: make(chan struct{})}
+	if w.n > b.keySize {
+		w.n = b.keySize
+	}
+	permit := &Permit{l: l, b: b, key: key, held: w.n}
+
+	l.mu.Lock()
+	elem := b.waiters.PushBack(w)
+	b.grant()
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.maxWait)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-w.ready:
+		return permit, nil
+	case <-timer.C:
+		err = &OverloadedError{Class: c, Key: key, RetryAfter: l.maxWait}
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-w.ready:
+		// Granted while timing out: keep it.
+		return permit, nil
+	default:
+	}
+	b.waiters.Remove(elem)
+	if errors.Is(err, ErrOverloaded) {
+		b.rejected++
+	}
+	// Removing w may let waiters behind it run.
+	b.grant()
+	return nil, err
+}
+
+// Permit is weight acquired with AcquireN. A nil *Permit holds nothing.
+type Permit struct {
+	l    *Limiter
+	b    *budget
+	key  string
+	held int
+}
+
+// Release gives back n units of the weight, or all that is left when n is
+// negative or larger.
+func (p *Permit) Release(n int) {
+	if p == nil {
+		return
+	}
+	p.l.mu.Lock()
+	defer p.l.mu.Unlock()
+	if n < 0 || n > p.held {
+		n = p.held
+	}
+	if n == 0 {
+		return
+	}
+	p.held -= n
+	p.b.release(p.key, n)
+}
+
+// Held returns the weight p still holds.
+func (p *Permit) Held() int {
+	if p == nil {
+		return 0
+	}
+	p.l.mu.Lock()
+	defer p.l.mu.Unlock()
+	return p.held
+}
+
+// grant hands out weight to the waiters that fit, in order. l.mu must be held.
+func (b *budget) grant() {
+	for e := b.waiters.Front(); e != nil; {
+		w := e.Value.(*waiter)
+		if b.used+w.n > b.size {
+			// Keep the order for the budget as a whole.
+			return
+		}
+		next := e.Next()
+		if b.keys[w.key]+w.n <= b.keySize {
+			b.used += w.n
+			b.keys[w.key] += w.n
+			b.waiters.Remove(e)
+			close(w.ready)
+		}
+		e = next
+	}
+}
+
+// release gives back n units held by key. l.mu must be held.
+func (b *budget) release(key string, n int) {
+	b.used -= n
+	if b.keys[key] -= n; b.keys[key] <= 0 {
+		delete(b.keys, key)
+	}
+	b.grant()
+}
+
+// Status is the state of a Limiter, for GET /api/admin/db.
+type Status struct {
+	MaxWait string       `json:"max_wait"`
+	Lookups BudgetStatus `json:"lookups"`
+	Scans   BudgetStatus `json:"scans"`
+}
+
+// BudgetStatus is the state of one budget.
+type BudgetStatus struct {
+	Slots    int   `json:"slots"`
+	KeySlots int   `json:"key_slots"`
+	InUse    int   `json:"in_use"`
+	Waiting  int   `json:"waiting"`
+	Keys     int   `json:"keys"`     // keys holding weight
+	Rejected int64 `json:"rejected"` // calls that timed out since the start
+}
+
+// Status returns the state of the budgets, or nil when l does not limit.
+func (l *Limiter) Status() *Status {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return &Status{
+		MaxWait: l.maxWait.String(),
+		Lookups: l.lookups.status(),
+		Scans:   l.scans.status(),
+	}
+}
+
+func (b *budget) status() BudgetStatus {
+	return BudgetStatus{
+		Slots:    b.size,
+		KeySlots: b.keySize,
+		InUse:    b.used,
+		Waiting:  b.waiters.Len(),
+		Keys:     len(b.keys),
+		Rejected: b.rejected,
+	}
+}
@@ -0,0 +1,197 @@
+package querylimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pageWeight is the weight one /api/logs page reserves: a scan and two counts.
+var pageWeight = Scan.Weight() + 2*Count.Weight()
+
+func TestAcquireNPagesDoNotDeadlock(t *testing.T) {
+	l := New(Config{ScanSlots: pageWeight, LookupSlots: 1, MaxWait: 2 * time.Second})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, err := l.AcquireN(context.Background(), "key", Scan, pageWeight)
+			if err != nil {
+				errs <- err
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+			p.Release(p.Held() - Scan.Weight()) // counts done
+			time.Sleep(10 * time.Millisecond)
+			p.Release(-1) // rows closed
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("AcquireN: %v", err)
+	}
+	if s := l.Status().Scans; s.InUse != 0 || s.Waiting != 0 || s.Keys != 0 {
+		t.Errorf("budget not empty after release: %+v", s)
+	}
+}
+
+func TestPermitPartialRelease(t *testing.T) {
+	l := New(Config{ScanSlots: 5, LookupSlots: 1, MaxWait: time.Second})
+	p, err := l.AcquireN(context.Background(), "a", Scan, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Release(4)
+	if got := l.Status().Scans.InUse; got != 1 {
+		t.Fatalf("InUse after partial release = %d, want 1", got)
+	}
+	p.Release(-1)
+	p.Release(-1) // releasing twice gives nothing back twice
+	if got := l.Status().Scans.InUse; got != 0 {
+		t.Fatalf("InUse after release = %d, want 0", got)
+	}
+}
+
+func TestAcquireTimeout(t *testing.T) {
+	l := New(Config{ScanSlots: 2, LookupSlots: 1, MaxWait: 20 * time.Millisecond})
+	release, err := l.Acquire(context.Background(), "a", Count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	_, err = l.Acquire(context.Background(), "b", Scan)
+	var oe *OverloadedError
+	if !errors.As(err, &oe) || !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("err = %v, want *OverloadedError", err)
+	}
+	if oe.Key != "b" || oe.RetryAfterSeconds() != 1 {
+		t.Errorf("OverloadedError = %+v", oe)
+	}
+	if s := l.Status().Scans; s.Rejected != 1 || s.Waiting != 0 {
+		t.Errorf("status after timeout: %+v", s)
+	}
+}
+
+func TestAcquireContextCanceled(t *testing.T) {
+	l := New(Config{ScanSlots: 1, LookupSlots: 1, MaxWait: time.Second})
+	release, err := l.Acquire(context.Background(), "a", Scan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.Acquire(ctx, "a", Scan); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if s := l.Status().Scans; s.Rejected != 0 || s.Waiting != 0 {
+		t.Errorf("status after cancel: %+v", s)
+	}
+}
+
+// A waiter held back only by its key's limit must not block other keys.
+func TestKeyLimitDoesNotBlockOtherKeys(t *testing.T) {
+	l := New(Config{ScanSlots: 4, KeyScanSlots: 2, LookupSlots: 1, MaxWait: time.Second})
+	releaseA, err := l.Acquire(context.Background(), "a", Count)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aDone := make(chan error, 1)
+	go func() {
+		release, err := l.Acquire(context.Background(), "a", Scan)
+		if err == nil {
+			release()
+		}
+		aDone <- err
+	}()
+	waitFor(t, l, 1)
+
+	releaseB, err := l.Acquire(context.Background(), "b", Scan)
+	if err != nil {
+		t.Fatalf("key b waited behind key a: %v", err)
+	}
+	releaseB()
+
+	select {
+	case <-aDone:
+		t.Fatal("key a went over its limit")
+	default:
+	}
+	releaseA()
+	if err := <-aDone; err != nil {
+		t.Fatalf("key a after release: %v", err)
+	}
+}
+
+// A waiter that does not fit the budget as a whole keeps its place: calls
+// behind it wait even when they would fit.
+func TestGlobalOrder(t *testing.T) {
+	l := New(Config{ScanSlots: 3, LookupSlots: 1, MaxWait: time.Second})
+	releaseA, err := l.Acquire(context.Background(), "a", Count)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	start := func(key string, c Class) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := l.Acquire(context.Background(), key, c)
+			if err != nil {
+				t.Errorf("%s: %v", key, err)
+				return
+			}
+			release()
+		}()
+	}
+	start("b", Count) // needs 2, only 1 free
+	waitFor(t, l, 1)
+	start("c", Scan) // would fit, but b is first
+	waitFor(t, l, 2)
+
+	time.Sleep(10 * time.Millisecond)
+	if s := l.Status().Scans; s.InUse != 2 || s.Waiting != 2 {
+		t.Fatalf("c went ahead of b: %+v", s)
+	}
+	releaseA()
+	wg.Wait()
+}
+
+func TestNilLimiter(t *testing.T) {
+	var l *Limiter
+	release, err := l.Acquire(context.Background(), "a", Scan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	p, err := l.AcquireN(context.Background(), "a", Scan, 5)
+	if err != nil || p.Held() != 0 {
+		t.Fatalf("AcquireN on nil = %v, %v", p, err)
+	}
+	p.Release(-1)
+	if l.Status() != nil {
+		t.Fatal("Status of nil limiter is not nil")
+	}
+}
+
+// waitFor waits until n calls wait for the scan budget.
+func waitFor(t *testing.T, l *Limiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for l.Status().Scans.Waiting < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d calls waiting, want %d", l.Status().Scans.Waiting, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,72 @@
+package querylog
+
+import "time"
+
+// histogram counts durations into Buckets; the last count is for durations
+// above the largest bound.
+type histogram struct {
+	counts []int64
+	count  int64
+	sum    time.Duration
+	max    time.Duration
+}
+
+func (h *histogram) add(d time.Duration) {
+	if h.counts == nil {
+		h.counts = make([]int64, len(Buckets)+1)
+	}
+	i := 0
+	for i < len(Buckets) && d > Buckets[i] {
+		i++
+	}
+	h.counts[i]++
+	h.count++
+	h.sum += d
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// HistogramData is a latency histogram as returned by the admin API.
+type HistogramData struct {
+	Count   int64    `json:"count"`
+	SumMs   float64  `json:"sum_ms"`
+	MeanMs  float64  `json:"mean_ms"`
+	MaxMs   float64  `json:"max_ms"`
+	Buckets []Bucket `json:"buckets"`
+}
+
+// Bucket is the number of durations above the previous bound and at most
+// LE ("+Inf" for the last bucket).
+type Bucket struct {
+	LE    string `json:"le"`
+	Count int64  `json:"count"`
+}
+
+func (h *histogram) data() HistogramData {
+	d := HistogramData{
+		Count:   h.count,
+		SumMs:   ms(h.sum),
+		MaxMs:   ms(h.max),
+		Buckets: make([]Bucket, 0, len(Buckets)+1),
+	}
+	if h.count > 0 {
+		d.MeanMs = d.SumMs / float64(h.count)
+	}
+	for i := 0; i <= len(Buckets); i++ {
+		var c int64
+		if h.counts != nil {
+			c = h.counts[i]
+		}
+		le := "+Inf"
+		if i < len(Buckets) {
+			le = Buckets[i].String()
+		}
+		d.Buckets = append(d.Buckets, Bucket{LE: le, Count: c})
+	}
+	return d
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
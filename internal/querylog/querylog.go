@@ -0,0 +1,288 @@
+// Package querylog times the database calls of rsyslox. It keeps the
+// slowest recent queries in a ring buffer, together with the API request
+// that caused them, and latency histograms per API endpoint, so that the
+// dashboards and API consumers that load the database can be identified.
+package querylog
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Buckets are the upper bounds of the latency histograms.
+var Buckets = []time.Duration{
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond,
+	50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond,
+	500 * time.Millisecond, time.Second, 2500 * time.Millisecond,
+	5 * time.Second, 10 * time.Second,
+}
+
+const (
+	// maxEndpoints and maxKeys bound the aggregated statistics; further
+	// endpoints and keys are counted under overflowName.
+	maxEndpoints = 64
+	maxKeys      = 256
+	overflowName = "(other)"
+
+	// backgroundName is the endpoint of queries run by background
+	// services (cleanup, rollups, forwarders, …) rather than a request.
+	backgroundName = "(background)"
+
+	maxParamsLen = 1024
+	maxSQLLen    = 2000
+)
+
+// Config holds the query log settings.
+type Config struct {
+	SlowThreshold time.Duration // queries taking at least this long are kept
+	Size          int           // slow queries kept; 0 keeps none
+}
+
+// Trace attributes the database calls of an API request to its endpoint,
+// API key and parameters. It travels in the request context.
+type Trace struct {
+	Endpoint string
+	Key      string // API key name; "admin" for an admin session
+	Params   string // query string of the request
+
+	queries atomic.Int64
+	dbTime  atomic.Int64 // nanoseconds
+}
+
+type traceKey struct{}
+
+// NewContext returns ctx carrying t.
+func NewContext(ctx context.Context, t *Trace) context.Context {
+	return context.WithValue(ctx, traceKey{}, t)
+}
+
+// FromContext returns the trace of ctx, or nil.
+func FromContext(ctx context.Context) *Trace {
+	t, _ := ctx.Value(traceKey{}).(*Trace)
+	return t
+}
+
+// SlowQuery is a database call that took at least the slow threshold.
+type SlowQuery struct {
+	Time       time.Time `json:"time"`
+	Endpoint   string    `json:"endpoint"`
+	Key        string    `json:"key,omitempty"`
+	Params     string    `json:"params,omitempty"`
+	SQL        string    `json:"sql"`
+	DurationMs float64   `json:"duration_ms"`
+	Rows       int64     `json:"rows"` // returned, or affected by a statement
+	Error      string    `json:"error,omitempty"`
+}
+
+// Recorder collects the timings. A nil *Recorder records nothing.
+type Recorder struct {
+	cfg   Config
+	since time.Time
+
+	mu        sync.Mutex
+	slow      []SlowQuery // ring buffer of cfg.Size entries
+	next      int         // position of the next entry in slow
+	endpoints map[string]*endpointStats
+	keys      map[string]*keyStats
+}
+
+type endpointStats struct {
+	requests histogram
+	queries  histogram
+}
+
+type keyStats struct {
+	requests int64
+	queries  int64
+	dbTime   time.Duration
+}
+
+// New creates a Recorder.
+func New(cfg Config) *Recorder {
+	return &Recorder{
+		cfg:       cfg,
+		since:     time.Now(),
+		endpoints: make(map[string]*endpointStats),
+		keys:      make(map[string]*keyStats),
+	}
+}
+
+// Query records a database call. ctx carries the trace of the request that
+// made it, if any; rows is the number of rows returned or affected.
+func (r *Recorder) Query(ctx context.Context, sql string, d time.Duration, rows int64, err error) {
+	if r == nil {
+		return
+	}
+	t := FromContext(ctx)
+	endpoint := backgroundName
+	if t != nil {
+		t.queries.Add(1)
+		t.dbTime.Add(int64(d))
+		endpoint = t.Endpoint
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.endpoint(endpoint).queries.add(d)
+
+	if r.cfg.Size <= 0 || d < r.cfg.SlowThreshold {
+		return
+	}
+	q := SlowQuery{
+		Time:       time.Now(),
+		Endpoint:   endpoint,
+		SQL:        truncate(CompactSQL(sql), maxSQLLen),
+		DurationMs: ms(d),
+		Rows:       rows,
+	}
+	if t != nil {
+		q.Key = t.Key
+		q.Params = truncate(t.Params, maxParamsLen)
+	}
+	if err != nil {
+		q.Error = err.Error()
+	}
+	if len(r.slow) < r.cfg.Size {
+		r.slow = append(r.slow, q)
+	} else {
+		r.slow[r.next] = q
+	}
+	r.next = (r.next + 1) % r.cfg.Size
+}
+
+// Request records the latency of an API request traced by t.
+func (r *Recorder) Request(t *Trace, d time.Duration) {
+	if r == nil || t == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.endpoint(t.Endpoint).requests.add(d)
+
+	k, ok := r.keys[t.Key]
+	if !ok {
+		if len(r.keys) >= maxKeys {
+			t.Key = overflowName
+		}
+		if k, ok = r.keys[t.Key]; !ok {
+			k = &keyStats{}
+			r.keys[t.Key] = k
+		}
+	}
+	k.requests++
+	k.queries += t.queries.Load()
+	k.dbTime += time.Duration(t.dbTime.Load())
+}
+
+// endpoint returns the statistics of name. r.mu must be held.
+func (r *Recorder) endpoint(name string) *endpointStats {
+	if e, ok := r.endpoints[name]; ok {
+		return e
+	}
+	if len(r.endpoints) >= maxEndpoints {
+		name = overflowName
+		if e, ok := r.endpoints[name]; ok {
+			return e
+		}
+	}
+	e := &endpointStats{}
+	r.endpoints[name] = e
+	return e
+}
+
+// Report is the content of the query log, as returned by the admin API.
+type Report struct {
+	Since         time.Time       `json:"since"`
+	SlowThreshold string          `json:"slow_threshold"`
+	Size          int             `json:"size"`
+	Slow          []SlowQuery     `json:"slow"` // slowest first
+	Endpoints     []EndpointStats `json:"endpoints"`
+	Keys          []KeyStats      `json:"keys"`
+}
+
+// EndpointStats are the latencies of one endpoint: of its requests and of
+// the database calls they made.
+type EndpointStats struct {
+	Endpoint string        `json:"endpoint"`
+	Requests HistogramData `json:"requests"`
+	Queries  HistogramData `json:"queries"`
+}
+
+// KeyStats is the database load caused by one API key.
+type KeyStats struct {
+	Key      string  `json:"key"`
+	Requests int64   `json:"requests"`
+	Queries  int64   `json:"queries"`
+	DBTimeMs float64 `json:"db_time_ms"`
+}
+
+// Report returns the recorded slow queries and statistics.
+func (r *Recorder) Report() Report {
+	if r == nil {
+		return Report{Slow: []SlowQuery{}, Endpoints: []EndpointStats{}, Keys: []KeyStats{}}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rep := Report{
+		Since:         r.since,
+		SlowThreshold: r.cfg.SlowThreshold.String(),
+		Size:          r.cfg.Size,
+		Slow:          append([]SlowQuery{}, r.slow...),
+		Endpoints:     make([]EndpointStats, 0, len(r.endpoints)),
+		Keys:          make([]KeyStats, 0, len(r.keys)),
+	}
+	sort.SliceStable(rep.Slow, func(i, j int) bool { return rep.Slow[i].DurationMs > rep.Slow[j].DurationMs })
+
+	for name, e := range r.endpoints {
+		rep.Endpoints = append(rep.Endpoints, EndpointStats{
+			Endpoint: name,
+			Requests: e.requests.data(),
+			Queries:  e.queries.data(),
+		})
+	}
+	// Most database time first.
+	sort.Slice(rep.Endpoints, func(i, j int) bool {
+		a, b := rep.Endpoints[i].Queries.SumMs, rep.Endpoints[j].Queries.SumMs
+		if a != b {
+			return a > b
+		}
+		return rep.Endpoints[i].Endpoint < rep.Endpoints[j].Endpoint
+	})
+
+	for name, k := range r.keys {
+		rep.Keys = append(rep.Keys, KeyStats{
+			Key:      name,
+			Requests: k.requests,
+			Queries:  k.queries,
+			DBTimeMs: ms(k.dbTime),
+		})
+	}
+	sort.Slice(rep.Keys, func(i, j int) bool {
+		if rep.Keys[i].DBTimeMs != rep.Keys[j].DBTimeMs {
+			return rep.Keys[i].DBTimeMs > rep.Keys[j].DBTimeMs
+		}
+		return rep.Keys[i].Key < rep.Keys[j].Key
+	})
+	return rep
+}
+
+// CompactSQL puts a query written over several indented lines on one line.
+func CompactSQL(query string) string {
+	lines := strings.Split(strings.TrimSpace(query), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSpace(l)
+	}
+	return strings.Join(lines, " ")
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "…"
+}
@@ -0,0 +1,171 @@
+package receiver
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"time"
+)
+
+// maxMessageSize bounds a single message; longer ones are truncated (UDP,
+// newline framing) or rejected (octet counting).
+const maxMessageSize = 64 * 1024
+
+// maxCountDigits bounds the digits read as an octet count; counts above
+// maxMessageSize are rejected.
+const maxCountDigits = 9
+
+// idleTimeout closes stream connections that sent nothing for this long.
+const idleTimeout = 10 * time.Minute
+
+// serveUDP reads one message per datagram.
+func (r *Receiver) serveUDP(pc net.PacketConn) {
+	defer r.wg.Done()
+
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("⚠️  Syslog receiver: udp read failed: %v", err)
+			continue
+		}
+		r.accept(string(buf[:n]), hostOf(addr), false)
+	}
+}
+
+// serveStream accepts TCP or TLS connections.
+func (r *Receiver) serveStream(ln net.Listener) {
+	defer r.wg.Done()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("⚠️  Syslog receiver: accept failed: %v", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		r.mu.Lock()
+		select {
+		case <-r.stopCh:
+			r.mu.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		r.conns[conn] = struct{}{}
+		r.wg.Add(1)
+		r.mu.Unlock()
+
+		go r.serveConn(conn)
+	}
+}
+
+// serveConn reads the messages of one connection. Each frame is either
+// octet-counted ("<length> <message>", RFC 6587 3.4.1) or terminated by a
+// newline (RFC 6587 3.4.2); senders may mix both.
+func (r *Receiver) serveConn(conn net.Conn) {
+	defer r.wg.Done()
+	defer func() {
+		r.mu.Lock()
+		delete(r.conns, conn)
+		r.mu.Unlock()
+		conn.Close()
+	}()
+
+	peer := hostOf(conn.RemoteAddr())
+	br := bufio.NewReaderSize(conn, maxMessageSize)
+	for {
+		conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		msg, err := readFrame(br)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("⚠️  Syslog receiver: connection from %s closed: %v", peer, err)
+			}
+			return
+		}
+		r.accept(msg, peer, true)
+	}
+}
+
+// errFrameTooLarge is returned for octet counts above maxMessageSize.
+var errFrameTooLarge = errors.New("octet-counted frame exceeds the maximum message size")
+
+// readFrame reads the next octet-counted or newline-terminated message.
+func readFrame(br *bufio.Reader) (string, error) {
+	if _, err := br.Peek(1); err != nil {
+		return "", err
+	}
+
+	if n, header, ok := octetCount(br); ok {
+		if n > maxMessageSize {
+			return "", errFrameTooLarge
+		}
+		br.Discard(header)
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return "", err
+		}
+		return string(buf), nil
+	}
+
+	line, err := br.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		// Keep the first maxMessageSize bytes and skip the rest of the line.
+		msg := string(line)
+		for errors.Is(err, bufio.ErrBufferFull) {
+			_, err = br.ReadSlice('\n')
+		}
+		return msg, err
+	}
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(line) > 0 {
+			return string(line), nil
+		}
+		return "", err
+	}
+	return string(line), nil
+}
+
+// octetCount parses the "LEN " header of an octet-counted frame without
+// consuming it and returns LEN and the header length. Newline-terminated
+// messages can start with digits too (RSYSLOG_FileFormat, RFC 3164 without
+// PRI), so a frame only counts as octet-counted when LEN is followed by a
+// space and the "<" of a PRI.
+func octetCount(br *bufio.Reader) (n, header int, ok bool) {
+	for i := 0; ; i++ {
+		b, err := br.Peek(i + 1)
+		if err != nil {
+			return 0, 0, false
+		}
+		c := b[i]
+		if c >= '0' && c <= '9' && i < maxCountDigits && (i > 0 || c != '0') {
+			n = n*10 + int(c-'0')
+			continue
+		}
+		if i == 0 || c != ' ' {
+			return 0, 0, false
+		}
+		if b, err = br.Peek(i + 2); err != nil || b[i+1] != '<' {
+			return 0, 0, false
+		}
+		return n, i + 1, true
+	}
+}
+
+// hostOf returns the IP address of a network address.
+func hostOf(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,254 @@
+// Package receiver is a small syslog server. It accepts messages over UDP,
+// TCP and TLS, parses them (RFC 3164 and RFC 5424) and writes them to
+// SystemEvents in batches, with the column mapping of rsyslog's ommysql.
+package receiver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/syslog"
+)
+
+// queueBatches is the queue length in batches. UDP messages are dropped when
+// the queue is full; TCP and TLS senders are slowed down instead.
+const queueBatches = 20
+
+// Writer stores received messages.
+// *database.DB implements it for every supported driver.
+type Writer interface {
+	InsertEvents(msgs []syslog.Message) error
+}
+
+// Config holds the receiver settings.
+type Config struct {
+	// Enabled enables or disables the receiver.
+	Enabled bool
+
+	// UDPAddr, TCPAddr and TLSAddr are the listen addresses; empty disables
+	// the listener.
+	UDPAddr string
+	TCPAddr string
+	TLSAddr string
+
+	// TLSCertFile and TLSKeyFile are the server certificate of TLSAddr.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// BatchSize is the number of messages written per INSERT.
+	BatchSize int
+
+	// FlushInterval is the maximum time a message waits for its batch.
+	FlushInterval time.Duration
+
+	// RateLimit is the sustained number of messages per second accepted
+	// from one sender address; 0 disables rate limiting.
+	RateLimit float64
+
+	// RateBurst is the number of messages a sender may send at once.
+	// Defaults to RateLimit (at least 1).
+	RateBurst int
+}
+
+// Receiver listens for syslog messages and writes them to the database.
+type Receiver struct {
+	db     Writer
+	cfg    Config
+	stopCh chan struct{}
+	queue  chan syslog.Message
+	stats  *stats
+
+	mu        sync.Mutex
+	listeners []net.Listener
+	udp       net.PacketConn
+	conns     map[net.Conn]struct{}
+	wg        sync.WaitGroup // listeners and connections
+	writerWG  sync.WaitGroup
+}
+
+// New creates a new Receiver writing to db.
+func New(db Writer, cfg Config) *Receiver {
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.RateBurst <= 0 {
+		cfg.RateBurst = max(int(cfg.RateLimit), 1)
+	}
+	return &Receiver{
+		db:     db,
+		cfg:    cfg,
+		stopCh: make(chan struct{}),
+		queue:  make(chan syslog.Message, cfg.BatchSize*queueBatches),
+		stats:  newStats(cfg.RateLimit, cfg.RateBurst),
+		conns:  make(map[net.Conn]struct{}),
+	}
+}
+
+// Enabled reports whether the receiver is running.
+func (r *Receiver) Enabled() bool {
+	return r != nil && r.cfg.Enabled
+}
+
+// Start opens the configured listeners and launches the receive and write
+// loops. An error is returned when a listener cannot be opened.
+func (r *Receiver) Start() error {
+	if !r.cfg.Enabled {
+		log.Println("⏭  Syslog receiver disabled")
+		return nil
+	}
+
+	if r.cfg.UDPAddr != "" {
+		pc, err := net.ListenPacket("udp", r.cfg.UDPAddr)
+		if err != nil {
+			r.closeListeners()
+			return fmt.Errorf("failed to listen on udp %s: %w", r.cfg.UDPAddr, err)
+		}
+		r.udp = pc
+		r.wg.Add(1)
+		go r.serveUDP(pc)
+	}
+	if r.cfg.TCPAddr != "" {
+		ln, err := net.Listen("tcp", r.cfg.TCPAddr)
+		if err != nil {
+			r.closeListeners()
+			return fmt.Errorf("failed to listen on tcp %s: %w", r.cfg.TCPAddr, err)
+		}
+		r.listeners = append(r.listeners, ln)
+		r.wg.Add(1)
+		go r.serveStream(ln)
+	}
+	if r.cfg.TLSAddr != "" {
+		cert, err := tls.LoadX509KeyPair(r.cfg.TLSCertFile, r.cfg.TLSKeyFile)
+		if err != nil {
+			r.closeListeners()
+			return fmt.Errorf("failed to load receiver TLS certificate: %w", err)
+		}
+		ln, err := tls.Listen("tcp", r.cfg.TLSAddr, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		})
+		if err != nil {
+			r.closeListeners()
+			return fmt.Errorf("failed to listen on tls %s: %w", r.cfg.TLSAddr, err)
+		}
+		r.listeners = append(r.listeners, ln)
+		r.wg.Add(1)
+		go r.serveStream(ln)
+	}
+
+	log.Printf("✓ Syslog receiver started (udp: %s, tcp: %s, tls: %s, batch: %d)",
+		addrOrOff(r.cfg.UDPAddr), addrOrOff(r.cfg.TCPAddr), addrOrOff(r.cfg.TLSAddr), r.cfg.BatchSize)
+
+	r.writerWG.Add(1)
+	go r.write()
+	return nil
+}
+
+// Stop closes the listeners and open connections and writes the messages
+// still queued.
+func (r *Receiver) Stop() {
+	if !r.cfg.Enabled {
+		return
+	}
+	close(r.stopCh)
+	r.closeListeners()
+	r.mu.Lock()
+	for c := range r.conns {
+		c.Close()
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+
+	close(r.queue)
+	r.writerWG.Wait()
+	log.Println("Syslog receiver stopped")
+}
+
+func (r *Receiver) closeListeners() {
+	if r.udp != nil {
+		r.udp.Close()
+	}
+	for _, ln := range r.listeners {
+		ln.Close()
+	}
+}
+
+// accept parses one message from peer and queues it. block selects
+// backpressure (stream transports) over dropping (UDP) when the queue is full.
+func (r *Receiver) accept(raw string, peer string, block bool) {
+	now := time.Now()
+	if !r.stats.allow(peer, now) {
+		return
+	}
+	msg, ok := syslog.Parse(raw, now)
+	if !ok {
+		return
+	}
+	if msg.FromHost == "" {
+		msg.FromHost = peer
+	}
+
+	if block {
+		select {
+		case r.queue <- msg:
+		case <-r.stopCh:
+		}
+		return
+	}
+	select {
+	case r.queue <- msg:
+	default:
+		r.stats.queueFull.Add(1)
+	}
+}
+
+// write collects queued messages into batches and inserts them.
+func (r *Receiver) write() {
+	defer r.writerWG.Done()
+
+	ticker := time.NewTicker(r.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]syslog.Message, 0, r.cfg.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := r.db.InsertEvents(batch); err != nil {
+			r.stats.insertErrors.Add(1)
+			r.stats.lost.Add(int64(len(batch)))
+			log.Printf("❌ Syslog receiver: failed to write %d messages: %v", len(batch), err)
+		} else {
+			r.stats.inserted.Add(int64(len(batch)))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case msg, ok := <-r.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, msg)
+			if len(batch) >= r.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+			r.stats.prune(time.Now())
+		}
+	}
+}
+
+func addrOrOff(addr string) string {
+	if addr == "" {
+		return "off"
+	}
+	return addr
+}
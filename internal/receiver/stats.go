@@ -0,0 +1,134 @@
+package receiver
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// senderTTL is how long an idle sender keeps its counters and bucket.
+const senderTTL = time.Hour
+
+// Stats is a snapshot of the ingest counters.
+type Stats struct {
+	Enabled      bool          `json:"enabled"`
+	Received     int64         `json:"received"`      // messages accepted from the network
+	RateLimited  int64         `json:"rate_limited"`  // dropped by the per-sender rate limit
+	QueueFull    int64         `json:"queue_full"`    // UDP messages dropped while the queue was full
+	Inserted     int64         `json:"inserted"`      // rows written to SystemEvents
+	Lost         int64         `json:"lost"`          // messages of failed batches
+	InsertErrors int64         `json:"insert_errors"` // failed batches
+	Queued       int           `json:"queued"`        // messages waiting to be written
+	Senders      []SenderStats `json:"senders"`       // senders active within the last hour
+}
+
+// SenderStats are the counters of one sender address.
+type SenderStats struct {
+	Address     string    `json:"address"`
+	Received    int64     `json:"received"`
+	RateLimited int64     `json:"rate_limited"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// sender is the token bucket and counters of one sender address.
+type sender struct {
+	tokens      float64
+	updated     time.Time
+	received    int64
+	rateLimited int64
+}
+
+// stats holds the ingest counters and per-sender rate limits.
+type stats struct {
+	rate  float64
+	burst float64
+
+	received     atomic.Int64
+	rateLimited  atomic.Int64
+	queueFull    atomic.Int64
+	inserted     atomic.Int64
+	lost         atomic.Int64
+	insertErrors atomic.Int64
+
+	mu      sync.Mutex
+	senders map[string]*sender
+}
+
+func newStats(rate float64, burst int) *stats {
+	return &stats{rate: rate, burst: float64(burst), senders: make(map[string]*sender)}
+}
+
+// allow counts a message from addr and reports whether the rate limit
+// admits it.
+func (s *stats) allow(addr string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snd, ok := s.senders[addr]
+	if !ok {
+		snd = &sender{tokens: s.burst, updated: now}
+		s.senders[addr] = snd
+	}
+	if s.rate > 0 {
+		snd.tokens = min(s.burst, snd.tokens+now.Sub(snd.updated).Seconds()*s.rate)
+		if snd.tokens < 1 {
+			snd.updated = now
+			snd.rateLimited++
+			s.rateLimited.Add(1)
+			return false
+		}
+		snd.tokens--
+	}
+	snd.updated = now
+	snd.received++
+	s.received.Add(1)
+	return true
+}
+
+// prune forgets senders idle for longer than senderTTL.
+func (s *stats) prune(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for addr, snd := range s.senders {
+		if now.Sub(snd.updated) > senderTTL {
+			delete(s.senders, addr)
+		}
+	}
+}
+
+// Stats returns the current ingest counters. It is safe to call on a nil
+// or disabled Receiver.
+func (r *Receiver) Stats() Stats {
+	if !r.Enabled() {
+		return Stats{Senders: []SenderStats{}}
+	}
+	s := r.stats
+	out := Stats{
+		Enabled:      true,
+		Received:     s.received.Load(),
+		RateLimited:  s.rateLimited.Load(),
+		QueueFull:    s.queueFull.Load(),
+		Inserted:     s.inserted.Load(),
+		Lost:         s.lost.Load(),
+		InsertErrors: s.insertErrors.Load(),
+		Queued:       len(r.queue),
+	}
+
+	s.mu.Lock()
+	out.Senders = make([]SenderStats, 0, len(s.senders))
+	for addr, snd := range s.senders {
+		out.Senders = append(out.Senders, SenderStats{
+			Address:     addr,
+			Received:    snd.received,
+			RateLimited: snd.rateLimited,
+			LastSeen:    snd.updated,
+		})
+	}
+	s.mu.Unlock()
+
+	sort.Slice(out.Senders, func(i, j int) bool {
+		return out.Senders[i].Received > out.Senders[j].Received
+	})
+	return out
+}
@@ -0,0 +1,584 @@
+// Package rollup keeps pre-aggregated entry counts of SystemEvents in
+// rsyslox-owned tables, so that histograms and top-N statistics over months
+// of logs do not scan the log table.
+//
+// The worker counts new rows incrementally from the last processed ID into
+// per-minute and per-hour buckets by host, program name, facility and
+// severity. Minute buckets are kept for MinuteRetention, hour buckets as
+// long as the logs they count. Both can be rebuilt from scratch.
+//
+// A row can commit after rows with a higher ID were counted. The IDs the
+// worker passes without a row are read again for lateCommitWait. Rows that
+// rsyslox deletes (cleanup, partition drops) are removed from the counts as
+// they are deleted, see Forget and ForgetRange.
+package rollup
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/phil-bot/rsyslox/internal/database"
+)
+
+// ErrDisabled is returned by Rebuild when rollups are disabled.
+var ErrDisabled = errors.New("rollups are disabled")
+
+// ErrUnavailable is returned by Counts when the rollups cannot answer the
+// query; the caller falls back to a live query.
+var ErrUnavailable = errors.New("rollups cannot answer the query")
+
+// lateCommitWait is how long a passed ID is read again for a row that
+// commits late.
+const lateCommitWait = time.Minute
+
+// tailFactor limits the rows not yet counted that Counts reads live, in
+// multiples of ChunkSize. A longer tail means the worker has fallen behind.
+const tailFactor = 10
+
+// Config holds the rollup worker configuration.
+type Config struct {
+	Enabled         bool
+	Interval        time.Duration // how often new rows are counted
+	ChunkSize       int           // rows read per query
+	MinuteRetention time.Duration // how long minute buckets are kept
+}
+
+// Status is the state of the rollup worker, as returned by the admin API.
+type Status struct {
+	Enabled         bool       `json:"enabled"`
+	Ready           bool       `json:"ready"` // caught up; statistics use the rollups
+	Rebuilding      bool       `json:"rebuilding"`
+	LastID          int        `json:"last_id"` // last SystemEvents ID counted
+	Counted         int64      `json:"counted"` // rows counted since startup
+	MinuteRetention string     `json:"minute_retention"`
+	LastRun         *time.Time `json:"last_run,omitempty"`
+	Error           string     `json:"error,omitempty"`
+}
+
+// Query is a count over the rollup dimensions in [Start, End). Start and
+// End must be aligned to Granularity.
+type Query struct {
+	Granularity int // database.RollupMinute or database.RollupHour
+	Start, End  time.Time
+	Filter      database.RollupFilter
+	GroupBy     string // a key of database.RollupDimensions
+}
+
+// Worker counts new SystemEvents rows into the rollup tables.
+type Worker struct {
+	db     *database.DB
+	cfg    Config
+	stopCh chan struct{}
+	wakeCh chan struct{}
+	wg     sync.WaitGroup
+
+	// countMu is held while rows are read and counted and while Forget
+	// deletes rows, so that a row is deleted either before it is read or
+	// after it is counted. It guards gaps. Lock order: countMu, applyMu, mu.
+	countMu sync.Mutex
+	gaps    *database.IDGaps
+
+	// applyMu is held for writing while the rollups and lastID change and
+	// for reading while Counts reads them, so that both are consistent.
+	applyMu sync.RWMutex
+
+	mu          sync.Mutex // guards the fields below
+	initialized bool
+	lastID      int
+	ready       bool
+	rebuild     bool // requested, performed by the next run
+	rebuilding  bool
+	counted     int64
+	lastRun     time.Time
+	lastErr     error
+}
+
+// New creates a new Worker.
+func New(db *database.DB, cfg Config) *Worker {
+	return &Worker{
+		db:     db,
+		cfg:    cfg,
+		stopCh: make(chan struct{}),
+		wakeCh: make(chan struct{}, 1),
+		gaps:   database.NewIDGaps(lateCommitWait),
+	}
+}
+
+// Start starts the background loop.
+func (w *Worker) Start() {
+	if !w.cfg.Enabled {
+		log.Println("⏭  Rollups disabled")
+		return
+	}
+	log.Printf("✓ Rollups started (interval: %s, minute retention: %s)", w.cfg.Interval, w.cfg.MinuteRetention)
+
+	w.wg.Add(1)
+	go w.loop()
+}
+
+// Stop stops the background loop. A run in progress stops after its
+// current chunk and continues from there on the next start.
+func (w *Worker) Stop() {
+	close(w.stopCh)
+	w.wg.Wait()
+}
+
+// Rebuild discards all rollups and counts every row again, in the
+// background. Until the rebuild has caught up, statistics use live queries.
+func (w *Worker) Rebuild() error {
+	if w == nil || !w.cfg.Enabled {
+		return ErrDisabled
+	}
+	w.mu.Lock()
+	w.rebuild = true
+	w.ready = false
+	w.mu.Unlock()
+
+	select {
+	case w.wakeCh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Status returns the current state. Safe on a nil Worker.
+func (w *Worker) Status() Status {
+	if w == nil {
+		return Status{}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	s := Status{
+		Enabled:         w.cfg.Enabled,
+		Ready:           w.usableLocked(),
+		Rebuilding:      w.rebuild || w.rebuilding,
+		LastID:          w.lastID,
+		Counted:         w.counted,
+		MinuteRetention: w.cfg.MinuteRetention.String(),
+	}
+	if !w.lastRun.IsZero() {
+		t := w.lastRun
+		s.LastRun = &t
+	}
+	if w.lastErr != nil {
+		s.Error = w.lastErr.Error()
+	}
+	return s
+}
+
+// usableLocked reports whether the rollups are caught up and maintained.
+// w.mu must be held.
+func (w *Worker) usableLocked() bool {
+	return w.cfg.Enabled && w.ready && time.Since(w.lastRun) < 3*w.cfg.Interval
+}
+
+func (w *Worker) loop() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+	w.run()
+	for {
+		select {
+		case <-ticker.C:
+			w.run()
+		case <-w.wakeCh:
+			w.run()
+		case <-w.stopCh:
+			log.Println("Rollups stopped")
+			return
+		}
+	}
+}
+
+// run counts all rows added since the last run and prunes expired buckets.
+func (w *Worker) run() {
+	err := w.update()
+	if err == nil {
+		err = w.prune()
+	}
+	if err != nil {
+		log.Printf("⚠️  Rollups: %v", err)
+	}
+
+	w.mu.Lock()
+	w.lastRun = time.Now()
+	w.lastErr = err
+	if err != nil {
+		w.ready = false
+	}
+	w.mu.Unlock()
+}
+
+// update counts new rows chunk by chunk. The rollups are ready once a run
+// has reached the end of the table.
+func (w *Worker) update() error {
+	if err := w.init(); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	rebuild := w.rebuild
+	w.rebuild = false
+	w.mu.Unlock()
+	if rebuild {
+		if err := w.reset(); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-w.stopCh:
+			return nil
+		default:
+		}
+		w.mu.Lock()
+		rebuild := w.rebuild
+		w.mu.Unlock()
+		if rebuild {
+			// Requested during the run; the loop wakes up again for it.
+			return nil
+		}
+
+		n, err := w.countNext()
+		if err != nil {
+			return err
+		}
+		if n < w.cfg.ChunkSize {
+			break
+		}
+	}
+	if err := w.countLate(); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	if w.rebuilding {
+		log.Printf("Rollups: caught up at ID %d", w.lastID)
+	}
+	w.ready = true
+	w.rebuilding = false
+	w.mu.Unlock()
+	return nil
+}
+
+// init creates the tables and loads the last counted ID once.
+func (w *Worker) init() error {
+	w.mu.Lock()
+	initialized := w.initialized
+	w.mu.Unlock()
+	if initialized {
+		return nil
+	}
+
+	if err := w.db.EnsureRollupTables(); err != nil {
+		return err
+	}
+	lastID, err := w.db.RollupLastID()
+	if err != nil {
+		return err
+	}
+	if lastID == 0 {
+		log.Println("Rollups: counting existing rows")
+	}
+
+	w.mu.Lock()
+	w.initialized = true
+	w.lastID = lastID
+	w.rebuilding = lastID == 0
+	w.mu.Unlock()
+	return nil
+}
+
+// countNext counts the next chunk of rows after lastID and returns the
+// number of rows read.
+func (w *Worker) countNext() (int, error) {
+	w.countMu.Lock()
+	defer w.countMu.Unlock()
+
+	w.mu.Lock()
+	lastID := w.lastID
+	w.mu.Unlock()
+	rows, err := w.db.RollupRows(lastID, w.cfg.ChunkSize)
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+	upTo := rows[len(rows)-1].ID
+	if err := w.apply(rows, upTo); err != nil {
+		return 0, err
+	}
+	w.gaps.Pass(lastID, upTo, rowIDs(rows))
+	return len(rows), nil
+}
+
+// countLate counts the rows that committed after higher IDs were counted.
+func (w *Worker) countLate() error {
+	w.countMu.Lock()
+	defer w.countMu.Unlock()
+
+	open := w.gaps.Open()
+	if len(open) == 0 {
+		return nil
+	}
+	rows, err := w.db.RollupRowsByID(open)
+	if err != nil || len(rows) == 0 {
+		return err
+	}
+	w.mu.Lock()
+	lastID := w.lastID
+	w.mu.Unlock()
+	if err := w.apply(rows, lastID); err != nil {
+		return err
+	}
+	w.gaps.Found(rowIDs(rows))
+	return nil
+}
+
+// reset discards all rollups.
+func (w *Worker) reset() error {
+	w.countMu.Lock()
+	defer w.countMu.Unlock()
+	w.applyMu.Lock()
+	defer w.applyMu.Unlock()
+	if err := w.db.ResetRollups(); err != nil {
+		return err
+	}
+	w.gaps.Reset()
+	log.Println("Rollups: rebuilding from scratch")
+
+	w.mu.Lock()
+	w.lastID = 0
+	w.ready = false
+	w.rebuilding = true
+	w.mu.Unlock()
+	return nil
+}
+
+// apply adds rows to the minute and hour buckets and stores lastID as the
+// last counted ID. w.countMu must be held.
+func (w *Worker) apply(rows []database.RollupRow, lastID int) error {
+	counts := make(map[database.RollupKey]int64)
+	for _, r := range rows {
+		addRow(counts, r)
+	}
+
+	w.applyMu.Lock()
+	defer w.applyMu.Unlock()
+	if err := w.db.AddRollups(counts, lastID); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.lastID = lastID
+	w.counted += int64(len(rows))
+	w.mu.Unlock()
+	return nil
+}
+
+// addRow adds r to the counts of its minute and hour bucket. Rows without
+// ReceivedAt are not counted.
+func addRow(counts map[database.RollupKey]int64, r database.RollupRow) {
+	if r.ReceivedAt.IsZero() {
+		return
+	}
+	for _, g := range []int{database.RollupMinute, database.RollupHour} {
+		counts[database.RollupKey{
+			Granularity: g,
+			Bucket:      Bucket(r.ReceivedAt, g),
+			Host:        r.Host,
+			Tag:         r.Tag,
+			Facility:    r.Facility,
+			Severity:    r.Severity,
+		}]++
+	}
+}
+
+func rowIDs(rows []database.RollupRow) []int {
+	ids := make([]int, len(rows))
+	for i, r := range rows {
+		ids[i] = r.ID
+	}
+	return ids
+}
+
+// Forget runs del, which deletes the rows with the given IDs, and removes
+// those already counted from the rollups. No rows are counted meanwhile.
+// When the rollups cannot be updated, they are rebuilt. Safe on a nil
+// Worker.
+func (w *Worker) Forget(ids []int, del func() (int64, error)) (int64, error) {
+	if w == nil || !w.cfg.Enabled {
+		return del()
+	}
+	w.countMu.Lock()
+	defer w.countMu.Unlock()
+	if err := w.init(); err != nil {
+		return 0, err
+	}
+	rows, err := w.db.RollupRowsByID(ids)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := del()
+	if err != nil {
+		return deleted, err
+	}
+
+	w.mu.Lock()
+	lastID := w.lastID
+	w.mu.Unlock()
+	counts := make(map[database.RollupKey]int64)
+	for _, r := range rows {
+		if r.ID <= lastID && !w.gaps.Missing(r.ID) {
+			addRow(counts, r)
+		}
+	}
+	w.applyMu.Lock()
+	err = w.db.RemoveRollups(counts)
+	w.applyMu.Unlock()
+	if err != nil {
+		log.Printf("⚠️  Rollups: %v; rebuilding", err)
+		w.Rebuild()
+	}
+	return deleted, nil
+}
+
+// ForgetRange runs drop, which deletes all rows received in ranges, and
+// deletes the buckets of ranges. Ranges must start and end at minute and
+// hour bucket boundaries, such as the local days of partitions. Safe on a
+// nil Worker.
+func (w *Worker) ForgetRange(ranges []database.TimeRange, drop func() error) error {
+	if w == nil || !w.cfg.Enabled {
+		return drop()
+	}
+	w.countMu.Lock()
+	defer w.countMu.Unlock()
+	if err := drop(); err != nil {
+		return err
+	}
+
+	w.applyMu.Lock()
+	defer w.applyMu.Unlock()
+	for _, r := range ranges {
+		if _, err := w.db.DeleteRollupRange(r); err != nil {
+			log.Printf("⚠️  Rollups: %v; rebuilding", err)
+			w.Rebuild()
+			break
+		}
+	}
+	return nil
+}
+
+// prune deletes minute buckets older than MinuteRetention and all buckets
+// before the oldest remaining log entry, for rows deleted outside rsyslox.
+// Rows under a legal hold keep old buckets; the rows rsyslox deletes around
+// them are removed by Forget and ForgetRange.
+func (w *Worker) prune() error {
+	minuteBefore := time.Now().Add(-w.cfg.MinuteRetention)
+	hourBefore := time.Time{}
+	if oldest, err := w.db.OldestEntryTime(context.Background()); err == nil && oldest != nil {
+		hourBefore = time.Unix(Bucket(*oldest, database.RollupHour), 0)
+		minuteBefore = latest(minuteBefore, time.Unix(Bucket(*oldest, database.RollupMinute), 0))
+	}
+
+	w.applyMu.Lock()
+	defer w.applyMu.Unlock()
+	if _, err := w.db.PruneRollups(database.RollupMinute, minuteBefore); err != nil {
+		return err
+	}
+	if !hourBefore.IsZero() {
+		if _, err := w.db.PruneRollups(database.RollupHour, hourBefore); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Counts answers q from the rollups plus the rows not counted yet, which
+// are read live. Returns ErrUnavailable when the rollups are disabled, not
+// caught up, or do not cover the range at the granularity. Safe on a nil
+// Worker.
+func (w *Worker) Counts(q Query) (map[string]int64, error) {
+	if w == nil || !w.covers(q) {
+		return nil, ErrUnavailable
+	}
+	if _, ok := database.RollupDimensions[q.GroupBy]; !ok {
+		return nil, ErrUnavailable
+	}
+
+	w.applyMu.RLock()
+	w.mu.Lock()
+	lastID := w.lastID
+	w.mu.Unlock()
+	sums, err := w.db.RollupSums(q.Granularity, q.Start, q.End, q.Filter, q.GroupBy)
+	w.applyMu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	limit := tailFactor * w.cfg.ChunkSize
+	tail, err := w.db.RollupRows(lastID, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(tail) > limit {
+		return nil, ErrUnavailable
+	}
+	for _, r := range tail {
+		if r.ReceivedAt.Before(q.Start) || !r.ReceivedAt.Before(q.End) || !q.Filter.Match(r) {
+			continue
+		}
+		sums[groupKey(r, q)]++
+	}
+	return sums, nil
+}
+
+// covers reports whether the rollups can answer a query over q's range.
+func (w *Worker) covers(q Query) bool {
+	w.mu.Lock()
+	usable := w.usableLocked()
+	w.mu.Unlock()
+	if !usable || q.Granularity <= 0 || !q.Start.Before(q.End) {
+		return false
+	}
+	if q.Start.Unix()%int64(q.Granularity) != 0 || q.End.Unix()%int64(q.Granularity) != 0 {
+		return false
+	}
+	if q.Granularity == database.RollupMinute {
+		// Minute buckets are pruned; keep a bucket of margin.
+		return q.Start.After(time.Now().Add(-w.cfg.MinuteRetention + time.Minute))
+	}
+	return true
+}
+
+// groupKey returns the key of a live row as RollupSums formats it.
+func groupKey(r database.RollupRow, q Query) string {
+	switch q.GroupBy {
+	case "FromHost":
+		return r.Host
+	case "ProgramName":
+		return r.Tag
+	case "Facility":
+		return strconv.Itoa(r.Facility)
+	case "Severity":
+		return strconv.Itoa(r.Severity)
+	}
+	return strconv.FormatInt(Bucket(r.ReceivedAt, q.Granularity), 10)
+}
+
+// Bucket returns the start of the bucket of t in Unix seconds.
+func Bucket(t time.Time, granularity int) int64 {
+	s := t.Unix()
+	return s - s%int64(granularity)
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
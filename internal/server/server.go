@@ -12,6 +12,8 @@
 //	/api/logs          → log entries (read-only key or admin token)
 //	/api/meta          → metadata (read-only key or admin token)
 //	/api/meta/         → metadata column values (read-only key or admin token)
+//	/api/anomalies     → message-rate anomalies (read-only key or admin token)
+//	/api/stats/        → histograms and top values (read-only key or admin token)
 package server
 
 import (
@@ -21,32 +23,56 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/phil-bot/rsyslox/internal/anomaly"
+	"github.com/phil-bot/rsyslox/internal/archive"
 	"github.com/phil-bot/rsyslox/internal/auth"
+	"github.com/phil-bot/rsyslox/internal/cleanup"
 	"github.com/phil-bot/rsyslox/internal/config"
 	"github.com/phil-bot/rsyslox/internal/database"
+	"github.com/phil-bot/rsyslox/internal/forwarder"
 	"github.com/phil-bot/rsyslox/internal/handlers"
 	"github.com/phil-bot/rsyslox/internal/handlers/admin"
 	"github.com/phil-bot/rsyslox/internal/handlers/setup"
+	"github.com/phil-bot/rsyslox/internal/hold"
 	"github.com/phil-bot/rsyslox/internal/middleware"
+	"github.com/phil-bot/rsyslox/internal/partition"
+	"github.com/phil-bot/rsyslox/internal/receiver"
+	"github.com/phil-bot/rsyslox/internal/rollup"
 )
 
 // Server represents the HTTP server.
 type Server struct {
 	cfg          *config.Config
-	db           *database.DB
+	sources      *database.Sources
 	router       *http.ServeMux
 	version      string
 	setupMode    bool
 	authMgr      *auth.Manager
 	sessionStore *auth.SessionStore
+	services     Services
+}
+
+// Services bundles the background services whose state is exposed through
+// the HTTP API. Fields are nil in setup mode.
+type Services struct {
+	Anomalies  *anomaly.Detector
+	Cleaner    *cleanup.Cleaner
+	Receiver   *receiver.Receiver
+	Forwarders *forwarder.Manager
+	Archives   *archive.Store // nil when cleanup.archive_dir is empty
+	Partitions *partition.Manager
+	Holds      *hold.Store
+	Rollups    *rollup.Worker
 }
 
 // New creates a new Server instance.
-// setupMode=true means no config file was found; only the setup wizard is enabled.
-func New(cfg *config.Config, db *database.DB, version string, setupMode bool) *Server {
+// setupMode=true means no config file was found; only the setup wizard is enabled
+// and sources is nil.
+func New(cfg *config.Config, sources *database.Sources, version string, setupMode bool, services Services) *Server {
 	return &Server{
 		cfg:          cfg,
-		db:           db,
+		sources:      sources,
+		services:     services,
 		router:       http.NewServeMux(),
 		version:      version,
 		setupMode:    setupMode,
@@ -61,6 +87,7 @@ func (s *Server) SetupRoutes() {
 	logging := middleware.Logging()
 	authRO := middleware.AuthReadOnly(s.authMgr, s.sessionStore)
 	authAdmin := middleware.AuthAdmin(s.sessionStore)
+	authWrite := middleware.AuthWrite(s.authMgr)
 	localhostOnly := middleware.LocalhostOnly()
 
 	// --- Frontend ---
@@ -76,7 +103,7 @@ func (s *Server) SetupRoutes() {
 	s.router.Handle("/docs/", cors(logging(docsHandler)))
 
 	// --- Health (public) ---
-	healthHandler := handlers.NewHealthHandler(s.db, s.version)
+	healthHandler := handlers.NewHealthHandler(s.sources, s.version)
 	s.router.Handle("/health", cors(logging(healthHandler)))
 
 	// --- Setup wizard ---
@@ -100,24 +127,64 @@ func (s *Server) SetupRoutes() {
 	s.router.Handle("/api/admin/logout", cors(logging(authAdmin(logoutHandler))))
 
 	// --- Admin: config and key management (admin token required) ---
-	configHandler  := admin.NewConfigHandler(s.cfg)
-	keysHandler    := admin.NewKeysHandler(s.cfg)
-	sslHandler     := admin.NewSSLHandler(s.cfg)
-	restartHandler := admin.NewRestartHandler()
-	diskHandler    := admin.NewDiskHandler(s.cfg)
-	s.router.Handle("/api/admin/config",  cors(logging(authAdmin(configHandler))))
-	s.router.Handle("/api/admin/keys",    cors(logging(authAdmin(keysHandler))))
-	s.router.Handle("/api/admin/keys/",   cors(logging(authAdmin(keysHandler))))
-	s.router.Handle("/api/admin/ssl/",    cors(logging(authAdmin(sslHandler))))
-	s.router.Handle("/api/admin/restart", cors(logging(authAdmin(restartHandler))))
-	s.router.Handle("/api/admin/disk",    cors(logging(authAdmin(diskHandler))))
+	configHandler     := admin.NewConfigHandler(s.cfg)
+	keysHandler       := admin.NewKeysHandler(s.cfg)
+	sslHandler        := admin.NewSSLHandler(s.cfg)
+	restartHandler    := admin.NewRestartHandler()
+	diskHandler       := admin.NewDiskHandler(s.cfg, s.sources.Primary())
+	cleanupHandler    := admin.NewCleanupHandler(s.services.Cleaner)
+	receiverHandler   := admin.NewReceiverHandler(s.services.Receiver)
+	forwardersHandler := admin.NewForwardersHandler(s.services.Forwarders)
+	archivesHandler   := admin.NewArchivesHandler(s.services.Archives)
+	partitionsHandler := admin.NewPartitionsHandler(s.services.Partitions)
+	holdsHandler      := admin.NewHoldsHandler(s.services.Holds)
+	rollupsHandler    := admin.NewRollupsHandler(s.services.Rollups)
+	dbHandler         := admin.NewDBHandler(s.sources.Primary())
+	explainHandler    := handlers.NewExplainHandler(s.sources)
+	queriesHandler    := admin.NewQueriesHandler(s.sources.Queries())
+	s.router.Handle("/api/admin/config",      cors(logging(authAdmin(configHandler))))
+	s.router.Handle("/api/admin/keys",        cors(logging(authAdmin(keysHandler))))
+	s.router.Handle("/api/admin/keys/",       cors(logging(authAdmin(keysHandler))))
+	s.router.Handle("/api/admin/ssl/",        cors(logging(authAdmin(sslHandler))))
+	s.router.Handle("/api/admin/restart",     cors(logging(authAdmin(restartHandler))))
+	s.router.Handle("/api/admin/disk",        cors(logging(authAdmin(diskHandler))))
+	s.router.Handle("/api/admin/cleanup",     cors(logging(authAdmin(cleanupHandler))))
+	s.router.Handle("/api/admin/cleanup/",    cors(logging(authAdmin(cleanupHandler))))
+	s.router.Handle("/api/admin/receiver",    cors(logging(authAdmin(receiverHandler))))
+	s.router.Handle("/api/admin/forwarders",  cors(logging(authAdmin(forwardersHandler))))
+	s.router.Handle("/api/admin/archives",    cors(logging(authAdmin(archivesHandler))))
+	s.router.Handle("/api/admin/archives/",   cors(logging(authAdmin(archivesHandler))))
+	s.router.Handle("/api/admin/partitions",  cors(logging(authAdmin(partitionsHandler))))
+	s.router.Handle("/api/admin/partitions/", cors(logging(authAdmin(partitionsHandler))))
+	s.router.Handle("/api/admin/holds",       cors(logging(authAdmin(holdsHandler))))
+	s.router.Handle("/api/admin/holds/",      cors(logging(authAdmin(holdsHandler))))
+	s.router.Handle("/api/admin/rollups",     cors(logging(authAdmin(rollupsHandler))))
+	s.router.Handle("/api/admin/rollups/",    cors(logging(authAdmin(rollupsHandler))))
+	s.router.Handle("/api/admin/db",          cors(logging(authAdmin(dbHandler))))
+	s.router.Handle("/api/admin/db/",         cors(logging(authAdmin(dbHandler))))
+	s.router.Handle("/api/admin/explain",     cors(logging(authAdmin(explainHandler))))
+	s.router.Handle("/api/admin/queries/",    cors(logging(authAdmin(queriesHandler))))
 
 	// --- API: logs and meta (read-only key or admin token) ---
-	logsHandler := handlers.NewLogsHandler(s.db)
-	metaHandler := handlers.NewMetaHandler(s.db)
-	s.router.Handle("/api/logs", cors(logging(authRO(logsHandler))))
-	s.router.Handle("/api/meta", cors(logging(authRO(metaHandler))))
-	s.router.Handle("/api/meta/", cors(logging(authRO(metaHandler))))
+	// QueryTrace attributes their database calls to the endpoint and key.
+	trace := middleware.QueryTrace(s.sources.Queries())
+	logsHandler := handlers.NewLogsHandler(s.sources)
+	metaHandler := handlers.NewMetaHandler(s.sources, s.services.Rollups)
+	s.router.Handle("/api/logs", cors(logging(authRO(trace(logsHandler)))))
+	s.router.Handle("/api/meta", cors(logging(authRO(trace(metaHandler)))))
+	s.router.Handle("/api/meta/", cors(logging(authRO(trace(metaHandler)))))
+
+	// --- API: ingest (write key) ---
+	ingestHandler := handlers.NewIngestHandler(s.sources)
+	s.router.Handle("/api/ingest", cors(logging(authWrite(ingestHandler))))
+
+	// --- API: anomalies (read-only key or admin token) ---
+	anomaliesHandler := handlers.NewAnomaliesHandler(s.services.Anomalies)
+	s.router.Handle("/api/anomalies", cors(logging(authRO(anomaliesHandler))))
+
+	// --- API: statistics (read-only key or admin token) ---
+	statsHandler := handlers.NewStatsHandler(s.sources, s.services.Rollups)
+	s.router.Handle("/api/stats/", cors(logging(authRO(trace(statsHandler)))))
 
 	log.Println("✓ Routes configured")
 }
@@ -0,0 +1,222 @@
+// Package syslog parses syslog messages as they appear on the wire and in
+// rsyslog's text files.
+//
+// Recognised formats (an optional "<PRI>" prefix is accepted on all of them):
+//
+//   - RFC 5424:           <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG
+//   - RSYSLOG_FileFormat: 2026-02-23T10:30:15.123456+01:00 host tag: msg
+//   - RFC 3164 / RSYSLOG_TraditionalFileFormat: Feb 23 10:30:15 host tag: msg
+//
+// Lines without PRI get facility user and severity notice (PRI 13), the
+// default RFC 3164 prescribes.
+package syslog
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultPRI is user.notice, used when a line carries no PRI.
+const defaultPRI = 13
+
+// maxTagLen bounds the tag of RFC 3164 lines; a longer first word is taken
+// as part of the message (RFC 3164 allows 32 characters, rsyslog more).
+const maxTagLen = 64
+
+// Message is a parsed syslog message in the shape of an rsyslog
+// SystemEvents row.
+type Message struct {
+	ReceivedAt         time.Time
+	DeviceReportedTime time.Time
+	Facility           int
+	Severity           int
+	FromHost           string
+	SysLogTag          string // as stored by rsyslog, e.g. "sshd[1234]:"
+	Message            string
+}
+
+// Parse parses one line. now supplies the receive time and, for RFC 3164
+// timestamps, the missing year. ok is false for empty lines; any other line
+// yields a message, falling back to the whole line as text.
+func Parse(line string, now time.Time) (msg Message, ok bool) {
+	return ParseWithYear(line, now, now)
+}
+
+// ParseWithYear is Parse with the year of RFC 3164 timestamps taken from ref
+// instead of now: the year of ref, or the one before when the timestamp would
+// be more than a day after ref.
+func ParseWithYear(line string, now, ref time.Time) (msg Message, ok bool) {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.TrimSpace(line) == "" {
+		return Message{}, false
+	}
+
+	pri, rest := parsePRI(line)
+	msg = Message{
+		ReceivedAt:         now,
+		DeviceReportedTime: now,
+		Facility:           pri / 8,
+		Severity:           pri % 8,
+	}
+
+	switch {
+	case strings.HasPrefix(rest, "1 "):
+		if parse5424(rest[2:], &msg) {
+			return msg, true
+		}
+	case len(rest) > 4 && isDigit(rest[0]) && rest[4] == '-':
+		if ts, after, ok := cutField(rest); ok {
+			if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+				msg.DeviceReportedTime = t
+				parseHostTagMsg(after, &msg)
+				return msg, true
+			}
+		}
+	default:
+		if t, after, ok := parse3164Time(rest, ref); ok {
+			msg.DeviceReportedTime = t
+			parseHostTagMsg(after, &msg)
+			return msg, true
+		}
+	}
+
+	msg.Message = rest
+	return msg, true
+}
+
+// parsePRI strips a leading "<PRI>" and returns its value, or defaultPRI.
+func parsePRI(line string) (int, string) {
+	if len(line) < 3 || line[0] != '<' {
+		return defaultPRI, line
+	}
+	end := strings.IndexByte(line, '>')
+	if end < 2 || end > 4 {
+		return defaultPRI, line
+	}
+	pri, err := strconv.Atoi(line[1:end])
+	if err != nil || pri < 0 || pri > 191 {
+		return defaultPRI, line
+	}
+	return pri, line[end+1:]
+}
+
+// parse5424 parses the part after the version of an RFC 5424 message.
+// Structured data is kept in front of the text so field extraction sees it.
+func parse5424(s string, msg *Message) bool {
+	// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID; MSGID is not stored.
+	var header [5]string
+	for i := range header {
+		var ok bool
+		if header[i], s, ok = cutField(s); !ok && i < 4 {
+			return false
+		}
+	}
+	ts, host, app, procID := header[0], header[1], header[2], header[3]
+
+	if ts != "-" {
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return false
+		}
+		msg.DeviceReportedTime = t
+	}
+	if host != "-" {
+		msg.FromHost = host
+	}
+	if app != "-" {
+		msg.SysLogTag = app
+		if procID != "-" {
+			msg.SysLogTag += "[" + procID + "]"
+		}
+		msg.SysLogTag += ":"
+	}
+
+	sd, text := cutStructuredData(s)
+	text = strings.TrimPrefix(text, "\ufeff") // BOM before UTF-8 MSG
+	if sd != "" {
+		text = strings.TrimSpace(sd + " " + text)
+	}
+	msg.Message = text
+	return true
+}
+
+// cutStructuredData splits "[…][…] MSG" or "- MSG" into SD and MSG.
+func cutStructuredData(s string) (sd, rest string) {
+	if strings.HasPrefix(s, "-") {
+		return "", strings.TrimPrefix(strings.TrimPrefix(s, "-"), " ")
+	}
+	i, inQuotes := 0, false
+	for i < len(s) && s[i] == '[' {
+		j := i + 1
+		for ; j < len(s); j++ {
+			c := s[j]
+			if c == '\\' {
+				j++
+				continue
+			}
+			if c == '"' {
+				inQuotes = !inQuotes
+			} else if c == ']' && !inQuotes {
+				break
+			}
+		}
+		if j >= len(s) {
+			break
+		}
+		i = j + 1
+	}
+	return s[:i], strings.TrimPrefix(s[i:], " ")
+}
+
+// parse3164Time parses "Mmm dd hh:mm:ss " (day may be space-padded) and
+// infers the year: a date more than a day in the future belongs to last year.
+func parse3164Time(s string, now time.Time) (time.Time, string, bool) {
+	if len(s) < 16 || s[15] != ' ' {
+		return time.Time{}, s, false
+	}
+	t, err := time.ParseInLocation(time.Stamp, s[:15], time.Local)
+	if err != nil {
+		return time.Time{}, s, false
+	}
+	t = t.AddDate(now.Year(), 0, 0)
+	if t.After(now.Add(24 * time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t, s[16:], true
+}
+
+// parseHostTagMsg parses "host tag: msg" after the timestamp. Senders that
+// omit the hostname ("<13>Feb 23 10:30:15 su: msg") leave FromHost empty.
+func parseHostTagMsg(s string, msg *Message) {
+	host, rest, _ := cutField(s)
+	if strings.HasSuffix(host, ":") || strings.HasSuffix(host, "]") {
+		host, rest = "", s
+	}
+	msg.FromHost = host
+
+	tag, text, ok := cutField(rest)
+	if ok && len(tag) <= maxTagLen && strings.HasSuffix(tag, ":") {
+		msg.SysLogTag = tag
+		msg.Message = text
+		return
+	}
+	// "tag[pid]" without colon, as some daemons write it.
+	if ok && len(tag) <= maxTagLen && strings.HasSuffix(tag, "]") && strings.Contains(tag, "[") {
+		msg.SysLogTag = tag + ":"
+		msg.Message = text
+		return
+	}
+	msg.Message = rest
+}
+
+// cutField splits off the first space-separated field.
+func cutField(s string) (field, rest string, ok bool) {
+	i := strings.IndexByte(s, ' ')
+	if i < 0 {
+		return s, "", s != ""
+	}
+	return s[:i], s[i+1:], true
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
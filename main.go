@@ -4,11 +4,20 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
+	"github.com/phil-bot/rsyslox/internal/anomaly"
+	"github.com/phil-bot/rsyslox/internal/archive"
 	"github.com/phil-bot/rsyslox/internal/auth"
 	"github.com/phil-bot/rsyslox/internal/cleanup"
 	"github.com/phil-bot/rsyslox/internal/config"
 	"github.com/phil-bot/rsyslox/internal/database"
+	"github.com/phil-bot/rsyslox/internal/filesource"
+	"github.com/phil-bot/rsyslox/internal/forwarder"
+	"github.com/phil-bot/rsyslox/internal/hold"
+	"github.com/phil-bot/rsyslox/internal/partition"
+	"github.com/phil-bot/rsyslox/internal/receiver"
+	"github.com/phil-bot/rsyslox/internal/rollup"
 	"github.com/phil-bot/rsyslox/internal/server"
 )
 
@@ -46,7 +55,7 @@ func main() {
 	if setupMode {
 		log.Println("⚠️  No configuration found — starting in setup mode")
 		log.Printf("   Setup wizard available at http://<this-host>:%d", cfg.Server.Port)
-		srv := server.New(cfg, nil, Version, true)
+		srv := server.New(cfg, nil, Version, true, server.Services{})
 		srv.SetupRoutes()
 		if err := srv.Start(); err != nil {
 			log.Fatalf("❌ Server error: %v", err)
@@ -54,26 +63,166 @@ func main() {
 		return
 	}
 
-	// Connect to database.
-	db, err := database.Connect(cfg)
+	// Connect to the database(s). Sources that are down are retried later;
+	// startup fails only when none is reachable.
+	sources, err := database.ConnectAll(cfg)
 	if err != nil {
 		log.Fatalf("❌ Failed to connect to database: %v", err)
 	}
-	defer db.Close()
+	defer sources.Close()
+	db := sources.Primary()
 
-	// Start cleanup service.
-	cleaner := cleanup.New(db.DB, cleanup.Config{
+	// Index rsyslog text files of file-backed sources.
+	for _, src := range sources.List() {
+		if src.Config().DriverName() != config.DriverFile {
+			continue
+		}
+		indexDB, err := src.DB()
+		if err != nil {
+			log.Fatalf("❌ Failed to open file index: %v", err)
+		}
+		tailer := filesource.New(indexDB, filesource.Config{Files: src.Config().Files})
+		if err := tailer.Start(); err != nil {
+			log.Fatalf("❌ Failed to start file source: %v", err)
+		}
+		defer tailer.Stop()
+	}
+
+	// Open the archive that cleanup writes to before deleting.
+	cleanupCfg := cleanup.Config{
 		Enabled:          cfg.Cleanup.Enabled,
+		Mode:             cfg.Cleanup.Mode,
 		DiskPath:         cfg.Cleanup.DiskPath,
 		ThresholdPercent: cfg.Cleanup.ThresholdPercent,
+		MaxTableBytes:    cfg.Cleanup.MaxTableBytes,
 		BatchSize:        cfg.Cleanup.BatchSize,
+		BatchLatency:     cfg.Cleanup.BatchLatency,
+		BatchPause:       cfg.Cleanup.BatchPause,
+		LowWaterPercent:  cfg.Cleanup.LowWaterPercent,
 		Interval:         cfg.Cleanup.Interval,
+		Reclaim:          cfg.Cleanup.Reclaim,
+		ReclaimMinFree:   int64(cfg.Cleanup.ReclaimMinFreeMB) << 20,
+	}
+	if cfg.Cleanup.Reclaim != "" {
+		// Validated on load.
+		cleanupCfg.ReclaimWindow, _ = config.ParseWindow(cfg.Cleanup.ReclaimWindow)
+	}
+	for _, r := range cfg.Cleanup.Retention {
+		cleanupCfg.Retention = append(cleanupCfg.Retention, cleanup.RetentionRule{
+			Name:        r.Name,
+			MaxAge:      time.Duration(r.Days) * 24 * time.Hour,
+			Severity:    r.Severity,
+			Facility:    r.Facility,
+			FromHost:    r.FromHost,
+			ProgramName: r.ProgramName,
+		})
+	}
+	// Legal holds exempt rows from cleanup and partition drops; without
+	// them nothing may be deleted.
+	holds, err := hold.Open(cfg.Cleanup.HoldsFile)
+	if err != nil {
+		log.Fatalf("❌ Failed to load legal holds: %v", err)
+	}
+	cleanupCfg.Holds = holds
+
+	var archives *archive.Store
+	if cfg.Cleanup.ArchiveDir != "" {
+		archives, err = archive.Open(db, cfg.Cleanup.ArchiveDir)
+		if err != nil {
+			log.Fatalf("❌ Failed to open archive directory: %v", err)
+		}
+		cleanupCfg.Archiver = archives
+	}
+
+	// Start rollup worker.
+	rollups := rollup.New(db, rollup.Config{
+		Enabled:         cfg.Rollups.Enabled,
+		Interval:        cfg.Rollups.Interval,
+		ChunkSize:       cfg.Rollups.ChunkSize,
+		MinuteRetention: cfg.Rollups.MinuteRetention,
 	})
+	rollups.Start()
+	defer rollups.Stop()
+
+	// Deleted rows are removed from the rollups as they are deleted.
+	partitionCfg := partition.Config{
+		Enabled:       cfg.Partitions.Enabled,
+		RetentionDays: cfg.Partitions.RetentionDays,
+		FutureDays:    cfg.Partitions.FutureDays,
+		Interval:      cfg.Partitions.Interval,
+		ChunkSize:     cfg.Partitions.ChunkSize,
+		Holds:         holds,
+	}
+	if cfg.Rollups.Enabled {
+		cleanupCfg.Rollups = rollups
+		partitionCfg.Rollups = rollups
+	}
+
+	// Start cleanup service.
+	cleaner := cleanup.New(db, cleanupCfg)
 	cleaner.Start()
 	defer cleaner.Stop()
 
+	// Start partition manager.
+	partitions := partition.New(db, partitionCfg)
+	partitions.Start()
+	defer partitions.Stop()
+
+	// Start anomaly detector.
+	detector := anomaly.New(sources, anomaly.Config{
+		Enabled:    cfg.Anomaly.Enabled,
+		Interval:   cfg.Anomaly.Interval,
+		Alpha:      cfg.Anomaly.Alpha,
+		Threshold:  cfg.Anomaly.Threshold,
+		MinSamples: cfg.Anomaly.MinSamples,
+		LearnHours: cfg.Anomaly.LearnHours,
+	})
+	detector.Start()
+	defer detector.Stop()
+
+	// Start syslog receiver.
+	rcv := receiver.New(db, receiver.Config{
+		Enabled:       cfg.Receiver.Enabled,
+		UDPAddr:       cfg.Receiver.UDP,
+		TCPAddr:       cfg.Receiver.TCP,
+		TLSAddr:       cfg.Receiver.TLS,
+		TLSCertFile:   cfg.Receiver.TLSCertFile,
+		TLSKeyFile:    cfg.Receiver.TLSKeyFile,
+		BatchSize:     cfg.Receiver.BatchSize,
+		FlushInterval: cfg.Receiver.FlushInterval,
+		RateLimit:     cfg.Receiver.RateLimit,
+		RateBurst:     cfg.Receiver.RateBurst,
+	})
+	if err := rcv.Start(); err != nil {
+		log.Fatalf("❌ Failed to start syslog receiver: %v", err)
+	}
+	defer rcv.Stop()
+
+	// Start SIEM forwarders.
+	fwd := forwarder.New(db, forwarder.Config{
+		StateDir:      cfg.Forwarding.StateDir,
+		Interval:      cfg.Forwarding.Interval,
+		BatchSize:     cfg.Forwarding.BatchSize,
+		MaxQueueBytes: int64(cfg.Forwarding.MaxQueueMB) << 20,
+		Version:       Version,
+		Targets:       cfg.Forwarders,
+	})
+	if err := fwd.Start(); err != nil {
+		log.Fatalf("❌ Failed to start forwarders: %v", err)
+	}
+	defer fwd.Stop()
+
 	// Start server.
-	srv := server.New(cfg, db, Version, false)
+	srv := server.New(cfg, sources, Version, false, server.Services{
+		Anomalies:  detector,
+		Cleaner:    cleaner,
+		Receiver:   rcv,
+		Forwarders: fwd,
+		Archives:   archives,
+		Partitions: partitions,
+		Holds:      holds,
+		Rollups:    rollups,
+	})
 	srv.SetupRoutes()
 
 	log.Println("========================================")